@@ -3,8 +3,11 @@ AI Service for PDF Summarization
 Pure AI service - handles only summarization using Google Gemini
 """
 
-from fastapi import FastAPI, UploadFile, File, HTTPException, Form
+from fastapi import FastAPI, UploadFile, File, HTTPException, Form, Request
 from fastapi.middleware.cors import CORSMiddleware
+from fastapi.encoders import jsonable_encoder
+from fastapi.responses import JSONResponse, StreamingResponse
+from google.api_core import exceptions as google_exceptions
 from pydantic import BaseModel
 import uvicorn
 import os
@@ -12,9 +15,13 @@ from PyPDF2 import PdfReader
 from dotenv import load_dotenv
 import google.generativeai as genai
 import io
-from typing import List, Optional
+from typing import Callable, List, Optional
 import re
 import json
+import queue
+import threading
+import contextvars
+from contextvars import ContextVar
 from langdetect import detect, LangDetectException
 
 load_dotenv()
@@ -39,19 +46,31 @@ if not gemini_api_key:
     raise RuntimeError("GEMINI_API_KEY is required. Set it in your .env.")
 
 genai.configure(api_key=gemini_api_key)
-gemini_model = genai.GenerativeModel("gemini-2.5-flash")
+GEMINI_MODEL_NAME = "gemini-2.5-flash"
+gemini_model = genai.GenerativeModel(GEMINI_MODEL_NAME)
 
 # ==================== RESPONSE MODELS ====================
 
+class Usage(BaseModel):
+    """Token usage accumulated over every Gemini call made for one request"""
+    model: str = GEMINI_MODEL_NAME
+    prompt_tokens: int = 0
+    completion_tokens: int = 0
+    input_chars: int = 0
+    output_chars: int = 0
+    calls: int = 0
+
 class SummaryResponse(BaseModel):
     summary: str
     provider: str = "gemini"
+    usage: Optional[Usage] = None
 
 class StructuredSummaryResponse(BaseModel):
     executive_summary: str
     bullets: List[str]
     highlights: List[str]
     provider: str = "gemini"
+    usage: Optional[Usage] = None
 
 class MultiSummaryItem(BaseModel):
     filename: str
@@ -63,10 +82,193 @@ class MultiSummaryResponse(BaseModel):
     items: List[MultiSummaryItem]
     combined_summary: str
     provider: str = "gemini"
+    usage: Optional[Usage] = None
 
 class QAResponse(BaseModel):
     answer: str
     provider: str = "gemini"
+    usage: Optional[Usage] = None
+
+class ExtractResponse(BaseModel):
+    data: dict
+    provider: str = "gemini"
+    usage: Optional[Usage] = None
+
+class TranslateRequest(BaseModel):
+    texts: List[str]
+    language: str
+
+class TranslateResponse(BaseModel):
+    translations: List[str]
+    provider: str = "gemini"
+    usage: Optional[Usage] = None
+
+class CompareRequest(BaseModel):
+    diff: str
+    old_name: str
+    new_name: str
+    language: Optional[str] = None
+
+class CompareChange(BaseModel):
+    description: str
+    section: Optional[str] = None
+    old_pages: List[int] = []
+    new_pages: List[int] = []
+
+class CompareResponse(BaseModel):
+    summary: str
+    added: List[CompareChange]
+    removed: List[CompareChange]
+    changed: List[CompareChange]
+    provider: str = "gemini"
+    usage: Optional[Usage] = None
+
+class CombineRequest(BaseModel):
+    summaries: List[str]
+    language: Optional[str] = None
+    question: Optional[str] = None
+    instructions: Optional[str] = None
+
+class CombineResponse(BaseModel):
+    summary: str
+    provider: str = "gemini"
+    usage: Optional[Usage] = None
+
+# ==================== ERRORS ====================
+
+class AIServiceError(Exception):
+    """Error returned to the backend as {"error": {code, message, retryable, retry_after}}"""
+    def __init__(self, status_code: int, code: str, message: str, retryable: bool = False, retry_after: Optional[float] = None):
+        super().__init__(message)
+        self.status_code = status_code
+        self.code = code
+        self.message = message
+        self.retryable = retryable
+        self.retry_after = retry_after
+
+@app.exception_handler(AIServiceError)
+async def ai_service_error_handler(request: Request, exc: AIServiceError):
+    headers = {"Retry-After": str(int(exc.retry_after))} if exc.retry_after else None
+    return JSONResponse(
+        status_code=exc.status_code,
+        content={"error": {
+            "code": exc.code,
+            "message": exc.message,
+            "retryable": exc.retryable,
+            "retry_after": exc.retry_after,
+        }},
+        headers=headers,
+    )
+
+def classify_gemini_error(e: Exception) -> AIServiceError:
+    """Map a Gemini client exception to a structured service error"""
+    if isinstance(e, google_exceptions.ResourceExhausted):
+        return AIServiceError(429, "rate_limited", str(e), retryable=True, retry_after=30)
+    if isinstance(e, google_exceptions.DeadlineExceeded):
+        return AIServiceError(504, "timeout", str(e), retryable=True)
+    if isinstance(e, (google_exceptions.InvalidArgument, google_exceptions.FailedPrecondition)):
+        return AIServiceError(422, "invalid_request", str(e))
+    return AIServiceError(503, "upstream_error", str(e), retryable=True)
+
+# ==================== USAGE TRACKING ====================
+
+_request_usage: ContextVar[Optional[Usage]] = ContextVar("request_usage", default=None)
+
+@app.middleware("http")
+async def track_usage(request, call_next):
+    """Start a fresh usage counter for every request"""
+    _request_usage.set(Usage())
+    return await call_next(request)
+
+def current_usage() -> Optional[Usage]:
+    return _request_usage.get()
+
+# ==================== OUTPUT STYLE ====================
+
+_request_instructions: ContextVar[Optional[str]] = ContextVar("request_instructions", default=None)
+_request_citations: ContextVar[bool] = ContextVar("request_citations", default=False)
+
+# Structured and qa statements end with the pages they come from; the backend
+# parses the markers and checks them against the page text
+CITATION_RULES = """PAGE CITATIONS: The document is split into pages, each starting with a [Page N] line.
+End every bullet, every highlight and every sentence of an answer with the page(s) it is based on, written as [p. N] or [pp. N, M], e.g. "Payment is due within 30 days. [p. 4]".
+Cite only pages the statement is taken from."""
+
+def use_instructions(instructions: Optional[str], citations: bool = False):
+    """Append the backend's output requirements (length, audience, tone, format) to every prompt of this request.
+    With citations, the prompts also ask for page markers; the text must then be extracted with labeled=True."""
+    _request_instructions.set(instructions.strip() if instructions and instructions.strip() else None)
+    _request_citations.set(citations)
+
+def generate_content(prompt, on_token: Optional[Callable[[str], None]] = None, **kwargs):
+    """Call Gemini and add its token usage to the current request's counter.
+    With on_token, the response is streamed and each piece of text is passed to it."""
+    instructions = _request_instructions.get()
+    if instructions and isinstance(prompt, str):
+        prompt = f"{prompt}\n\n{instructions}"
+    if _request_citations.get() and isinstance(prompt, str):
+        prompt = f"{prompt}\n\n{CITATION_RULES}"
+    
+    try:
+        if on_token:
+            response = gemini_model.generate_content(prompt, stream=True, **kwargs)
+            for chunk in response:
+                if chunk.text:
+                    on_token(chunk.text)
+        else:
+            response = gemini_model.generate_content(prompt, **kwargs)
+    except Exception as e:
+        raise classify_gemini_error(e)
+    
+    usage = _request_usage.get()
+    if usage is not None:
+        usage.calls += 1
+        usage.input_chars += len(prompt)
+        metadata = getattr(response, "usage_metadata", None)
+        if metadata:
+            usage.prompt_tokens += getattr(metadata, "prompt_token_count", 0) or 0
+            usage.completion_tokens += getattr(metadata, "candidates_token_count", 0) or 0
+        try:
+            usage.output_chars += len(response.text or "")
+        except Exception:
+            pass
+    
+    return response
+
+# ==================== STREAMING ====================
+
+def stream_ndjson(work: Callable[[Callable[[str], None]], BaseModel]) -> StreamingResponse:
+    """
+    Run work(on_token) in a thread and stream NDJSON lines as it goes:
+    {"delta": "..."} for every piece of generated text, then the final
+    response model, or {"error": {...}} if the work failed midway.
+    """
+    events: queue.Queue = queue.Queue()
+    
+    def run():
+        try:
+            result = work(lambda text: events.put({"delta": text}))
+            events.put(jsonable_encoder(result))
+        except AIServiceError as e:
+            events.put({"error": {
+                "code": e.code,
+                "message": e.message,
+                "retryable": e.retryable,
+                "retry_after": e.retry_after,
+            }})
+        except Exception as e:
+            events.put({"error": {"code": "upstream_error", "message": str(e), "retryable": True}})
+        finally:
+            events.put(None)
+    
+    # Copy the request context so Gemini usage lands on this request's counter
+    threading.Thread(target=contextvars.copy_context().run, args=(run,), daemon=True).start()
+    
+    def lines():
+        while (event := events.get()) is not None:
+            yield json.dumps(event) + "\n"
+    
+    return StreamingResponse(lines(), media_type="application/x-ndjson")
 
 # ==================== HELPER FUNCTIONS ====================
 
@@ -104,18 +306,21 @@ def chunk_text(text: str, chunk_size: int = 10000, overlap: int = 500) -> List[s
     
     return chunks
 
-def combine_summaries(summaries: List[str], target_language: str) -> str:
+def combine_summaries(summaries: List[str], target_language: str, on_token: Optional[Callable[[str], None]] = None) -> str:
     """
     Combine multiple chunk summaries into one cohesive summary
     
     Args:
         summaries: List of summaries from each chunk
         target_language: Target language for output
+        on_token: Optional callback receiving the combined summary as it is generated
     
     Returns:
         Combined summary
     """
-    if len(summaries) == 1:
+    if len(summaries) == 1 and not _request_instructions.get():
+        if on_token:
+            on_token(summaries[0])
         return summaries[0]
     
     combined = "\n\n--- Next Section ---\n\n".join(summaries)
@@ -144,11 +349,14 @@ OUTPUT: Combined summary in {target_language} language ONLY
 """
     
     try:
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
+            on_token=on_token,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
         return response.text
+    except AIServiceError:
+        raise
     except Exception as e:
         # If combining fails, return concatenated summaries
         return "\n\n".join(summaries)
@@ -203,10 +411,12 @@ def parse_page_range(page_range_str: str, total_pages: int) -> List[int]:
     
     return sorted(list(pages))
 
-def extract_text_from_pdf(file_stream, page_numbers: List[int] = None):
-    """Extract text from PDF file"""
+def extract_text_from_pdf(file_stream, page_numbers: List[int] = None, labeled: bool = False):
+    """Extract text from PDF file; labeled puts a [Page N] line before each page, for page citations"""
     try:
         reader = PdfReader(file_stream)
+        if reader.is_encrypted:
+            raise AIServiceError(422, "encrypted_pdf", "PDF is encrypted")
         total_pages = len(reader.pages)
         
         if page_numbers is None:
@@ -215,11 +425,43 @@ def extract_text_from_pdf(file_stream, page_numbers: List[int] = None):
         text = ""
         for page_num in page_numbers:
             if 0 <= page_num < total_pages:
+                if labeled:
+                    text += f"[Page {page_num + 1}]\n"
                 text += reader.pages[page_num].extract_text() + "\n"
         
         return text
+    except AIServiceError:
+        raise
     except Exception as e:
-        raise HTTPException(status_code=400, detail=f"Error reading PDF: {str(e)}")
+        raise AIServiceError(422, "invalid_pdf", f"Error reading PDF: {str(e)}")
+
+def conversation_section(history: Optional[str]) -> str:
+    """Render the earlier turns of a QA thread, sent by the backend as a JSON list"""
+    if not history:
+        return ""
+    try:
+        turns = json.loads(history)
+    except json.JSONDecodeError:
+        raise AIServiceError(422, "invalid_history", "history must be a JSON list of question and answer turns")
+    if not isinstance(turns, list):
+        raise AIServiceError(422, "invalid_history", "history must be a JSON list of question and answer turns")
+    
+    lines = [f"Q: {turn.get('question', '')}\nA: {turn.get('answer', '')}" for turn in turns if isinstance(turn, dict)]
+    if not lines:
+        return ""
+    return "Conversation so far (use it to understand follow-up questions; answer only from the document):\n" + "\n\n".join(lines) + "\n\n"
+
+def generate_from_template(template: str, document: str, on_token: Optional[Callable[[str], None]] = None) -> str:
+    """
+    Run a custom prompt template managed by the backend.
+    The backend fills every variable except {{document}}, which is the extracted PDF text.
+    """
+    response = generate_content(
+        template.replace("{{document}}", document),
+        on_token=on_token,
+        generation_config=genai.types.GenerationConfig(temperature=0.3)
+    )
+    return response.text or ""
 
 def extract_json(text: str) -> Optional[dict]:
     """Extract JSON from AI response"""
@@ -285,7 +527,7 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
 """
     
     try:
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
@@ -297,6 +539,8 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
                 "highlights": []
             }
         return data
+    except AIServiceError:
+        raise
     except Exception as e:
         return {
             "executive_summary": "",
@@ -325,10 +569,22 @@ def highlight_sentences(text: str, top_k: int = 5) -> List[str]:
     scores.sort(key=lambda x: x[0], reverse=True)
     return [s for _, s in scores[:top_k]]
 
+def cited_highlights(text: str, top_k: int = 5) -> List[str]:
+    """highlight_sentences over page-labeled text, each sentence followed by the [p. N] of its page"""
+    parts = re.split(r"\[Page (\d+)\]", text)
+    page_of = {}
+    for number, page in zip(parts[1::2], parts[2::2]):
+        for sentence in re.split(r"(?<=[.!?])\s+", page.strip()):
+            page_of.setdefault(sentence, number)
+    
+    plain = re.sub(r"\[Page \d+\]\n?", "", text)
+    return [f"{s} [p. {page_of[s]}]" if s in page_of else s for s in highlight_sentences(plain, top_k)]
+
 # ==================== AI SUMMARIZATION FUNCTIONS ====================
 
-def summarize_text(text: str, target_language: str = None) -> str:
-    """Generate simple summary with chunking support"""
+def summarize_text(text: str, target_language: str = None, on_token: Optional[Callable[[str], None]] = None) -> str:
+    """Generate simple summary with chunking support.
+    on_token receives the final summary as it is generated (the combine step for large documents)."""
     try:
         if not target_language:
             target_language = detect_language(text[:1000])
@@ -368,7 +624,7 @@ Section:
 OUTPUT LANGUAGE: {target_language} ONLY
 """
                 
-                response = gemini_model.generate_content(
+                response = generate_content(
                     prompt,
                     generation_config=genai.types.GenerationConfig(temperature=0.3)
                 )
@@ -376,7 +632,7 @@ OUTPUT LANGUAGE: {target_language} ONLY
             
             # Combine all chunk summaries
             print(f"🔗 Combining {len(chunk_summaries)} summaries")
-            return combine_summaries(chunk_summaries, target_language)
+            return combine_summaries(chunk_summaries, target_language, on_token)
         
         # Original logic for small documents
         lang_examples = {
@@ -407,11 +663,14 @@ Document:
 OUTPUT LANGUAGE: {target_language} ONLY
 """
         
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
+            on_token=on_token,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
         return response.text
+    except AIServiceError:
+        raise
     except Exception as e:
         return f"Error generating summary: {str(e)}"
 
@@ -454,7 +713,7 @@ Section:
 OUTPUT LANGUAGE: {target_language} ONLY
 """
                 
-                response = gemini_model.generate_content(
+                response = generate_content(
                     prompt,
                     generation_config=genai.types.GenerationConfig(temperature=0.3)
                 )
@@ -495,11 +754,13 @@ Document:
 OUTPUT LANGUAGE: {target_language} ONLY
 """
         
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
         return response.text
+    except AIServiceError:
+        raise
     except Exception as e:
         return f"Error generating summary: {str(e)}"
 
@@ -596,7 +857,7 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
 """
     
     try:
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
@@ -608,6 +869,8 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
                 "highlights": []
             }
         return data
+    except AIServiceError:
+        raise
     except Exception as e:
         return {
             "executive_summary": f"Error: {str(e)}",
@@ -677,7 +940,7 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
 """
     
     try:
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
@@ -689,6 +952,8 @@ OUTPUT: Valid JSON with ALL text in {target_language} language ONLY
                 "highlights": []
             }
         return data
+    except AIServiceError:
+        raise
     except Exception as e:
         return {
             "executive_summary": f"Error: {str(e)}",
@@ -704,136 +969,165 @@ async def root():
         "service": "PDF AI Summarization Service",
         "version": "1.0.0",
         "status": "running",
-        "endpoints": ["/summarize", "/summarize-structured", "/summarize-multi", "/qa"]
+        "endpoints": ["/summarize", "/summarize-stream", "/summarize-structured", "/summarize-multi", "/qa", "/extract", "/translate", "/compare", "/combine", "/combine-stream"]
     }
 
-@app.post("/summarize", response_model=SummaryResponse)
-async def summarize_pdf(
-    files: List[UploadFile] = File(...),
-    language: str = Form(None),
-    pages: str = Form(None)
-):
-    """Generate simple summary from PDF(s)"""
-    all_texts = []
+async def read_documents(files: Optional[List[UploadFile]], documents: Optional[str], pages: Optional[str], labeled: bool = False):
+    """
+    Return (name, text) for every document. The backend sends the text of the
+    requested pages it extracted on upload as `documents`
+    ([{"name": ..., "pages": [{"number": 3, "text": ...}]}]); PDFs uploaded
+    as `files` are read here.
+    """
+    result = []
     
-    for file in files:
-        if not file.filename.endswith(".pdf"):
-            raise HTTPException(status_code=400, detail=f"{file.filename} must be a PDF")
-        
-        content = await file.read()
-        file_stream = io.BytesIO(content)
-        
-        page_numbers = None
-        if pages:
-            reader = PdfReader(file_stream)
-            total_pages = len(reader.pages)
-            page_numbers = parse_page_range(pages, total_pages)
-            file_stream.seek(0)
-        
-        text = extract_text_from_pdf(file_stream, page_numbers)
-        
-        if not text.strip():
-            raise HTTPException(status_code=400, detail=f"Could not extract text from {file.filename}")
+    if documents:
+        try:
+            parsed = json.loads(documents)
+        except json.JSONDecodeError:
+            raise AIServiceError(422, "invalid_documents", "documents must be a JSON list of documents and their pages")
+        if not isinstance(parsed, list):
+            raise AIServiceError(422, "invalid_documents", "documents must be a JSON list of documents and their pages")
         
-        all_texts.append(text)
-    
-    combined_text = "\n\n--- Next Document ---\n\n".join(all_texts)
+        for doc in parsed:
+            text = ""
+            for page in doc.get("pages") or []:
+                if labeled:
+                    text += f"[Page {page.get('number')}]\n"
+                text += str(page.get("text", "")) + "\n"
+            result.append((doc.get("name") or "document", text))
+    else:
+        for file in files or []:
+            if not file.filename.endswith(".pdf"):
+                raise AIServiceError(415, "invalid_file_format", f"{file.filename} must be a PDF")
+            
+            content = await file.read()
+            
+            page_numbers = None
+            if pages:
+                reader = PdfReader(io.BytesIO(content))
+                page_numbers = parse_page_range(pages, len(reader.pages))
+            
+            result.append((file.filename, extract_text_from_pdf(io.BytesIO(content), page_numbers, labeled=labeled)))
     
-    # Use user-selected language or auto-detect
+    if not result:
+        raise AIServiceError(422, "no_text", "No PDF or document text in the request")
+    for name, text in result:
+        if not text.strip():
+            raise AIServiceError(422, "no_text", f"Could not extract text from {name}")
+    return result
+
+def resolve_language(language: Optional[str], text: str) -> str:
+    """Use user-selected language or auto-detect"""
     if language and language.strip():
-        target_language = language.capitalize()
-    else:
-        target_language = detect_language(combined_text)
+        return language.capitalize()
+    return detect_language(text)
+
+async def read_summary_input(files: Optional[List[UploadFile]], documents: Optional[str], language: Optional[str], pages: Optional[str], labeled: bool = False):
+    """Read the document text(s) and resolve the target language; also returns the number of documents"""
+    docs = await read_documents(files, documents, pages, labeled)
+    combined_text = "\n\n--- Next Document ---\n\n".join(text for _, text in docs)
+    return combined_text, resolve_language(language, combined_text), len(docs)
+
+@app.post("/summarize", response_model=SummaryResponse)
+async def summarize_pdf(
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
+    language: str = Form(None),
+    pages: str = Form(None),
+    prompt: str = Form(None),
+    instructions: str = Form(None)
+):
+    """Generate simple summary from PDF(s), with the backend's prompt template if given"""
+    use_instructions(instructions)
+    combined_text, target_language, count = await read_summary_input(files, documents, language, pages)
     
-    if len(files) > 1:
+    if prompt:
+        summary = generate_from_template(prompt, combined_text)
+    elif count > 1:
         summary = summarize_hierarchical(combined_text, target_language)
     else:
         summary = summarize_text(combined_text, target_language)
     
-    return SummaryResponse(summary=summary)
+    return SummaryResponse(summary=summary, usage=current_usage())
+
+@app.post("/summarize-stream")
+async def summarize_pdf_stream(
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
+    language: str = Form(None),
+    pages: str = Form(None),
+    prompt: str = Form(None),
+    instructions: str = Form(None)
+):
+    """Same as /summarize, streamed as NDJSON (see stream_ndjson)"""
+    use_instructions(instructions)
+    combined_text, target_language, count = await read_summary_input(files, documents, language, pages)
+    
+    def work(on_token):
+        if prompt:
+            summary = generate_from_template(prompt, combined_text, on_token)
+        elif count > 1:
+            summary = summarize_hierarchical(combined_text, target_language)
+            on_token(summary)
+        else:
+            summary = summarize_text(combined_text, target_language, on_token)
+        return SummaryResponse(summary=summary, usage=current_usage())
+    
+    return stream_ndjson(work)
 
 @app.post("/summarize-structured", response_model=StructuredSummaryResponse)
 async def summarize_pdf_structured(
-    files: List[UploadFile] = File(...),
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
     language: str = Form(None),
-    pages: str = Form(None)
+    pages: str = Form(None),
+    prompt: str = Form(None),
+    instructions: str = Form(None)
 ):
     """Generate structured summary (executive summary, bullets, highlights)"""
-    all_texts = []
+    use_instructions(instructions, citations=True)
+    combined_text, target_language, count = await read_summary_input(files, documents, language, pages, labeled=True)
     
-    for file in files:
-        if not file.filename.endswith(".pdf"):
-            raise HTTPException(status_code=400, detail=f"{file.filename} must be a PDF")
-        
-        content = await file.read()
-        
-        page_numbers = None
-        if pages:
-            file_stream = io.BytesIO(content)
-            reader = PdfReader(file_stream)
-            total_pages = len(reader.pages)
-            page_numbers = parse_page_range(pages, total_pages)
-        
-        text = extract_text_from_pdf(io.BytesIO(content), page_numbers)
-        if not text.strip():
-            raise HTTPException(status_code=400, detail=f"Could not extract text from {file.filename}")
-        all_texts.append(text)
-    
-    combined_text = "\n\n--- Next Document ---\n\n".join(all_texts)
-    
-    # Use user-selected language or auto-detect
-    if language and language.strip():
-        target_language = language.capitalize()
-    else:
-        target_language = detect_language(combined_text)
-    
-    if len(files) > 1:
+    if prompt:
+        # The backend appends the JSON format to the template
+        result = extract_json(generate_from_template(prompt, combined_text))
+        if not isinstance(result, dict) or not result.get("executive_summary"):
+            raise AIServiceError(502, "schema_mismatch", "Template response was not the structured JSON", retryable=True)
+    elif count > 1:
         result = summarize_structured_hierarchical(combined_text, target_language)
     else:
         result = summarize_structured(combined_text, target_language)
     
     if not result.get("highlights") or len(result.get("highlights", [])) < 3:
-        result["highlights"] = highlight_sentences(combined_text, top_k=5)
+        result["highlights"] = cited_highlights(combined_text, top_k=5)
     
     return StructuredSummaryResponse(
         executive_summary=result.get("executive_summary", ""),
         bullets=result.get("bullets", []),
-        highlights=result.get("highlights", [])
+        highlights=result.get("highlights", []),
+        usage=current_usage()
     )
 
 @app.post("/summarize-multi", response_model=MultiSummaryResponse)
 async def summarize_multi(
-    files: List[UploadFile] = File(...),
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
     language: str = Form(None),
-    pages: str = Form(None)
+    pages: str = Form(None),
+    instructions: str = Form(None)
 ):
     """Generate summary for multiple PDFs (per-file + combined)"""
+    use_instructions(instructions)
     items = []
     combined_texts = []
+    docs = await read_documents(files, documents, pages)
     
-    for f in files:
-        if not f.filename.endswith(".pdf"):
-            raise HTTPException(status_code=400, detail=f"{f.filename} must be a PDF")
-        
-        content = await f.read()
-        
-        page_numbers = None
-        if pages:
-            file_stream = io.BytesIO(content)
-            reader = PdfReader(file_stream)
-            total_pages = len(reader.pages)
-            page_numbers = parse_page_range(pages, total_pages)
-        
-        text = extract_text_from_pdf(io.BytesIO(content), page_numbers)
+    for filename, text in docs:
         combined_texts.append(text)
+        target_language = resolve_language(language, text)
         
-        # Use user-selected language or auto-detect
-        if language and language.strip():
-            target_language = language.capitalize()
-        else:
-            target_language = detect_language(text)
-        
-        if len(files) > 1:
+        if len(docs) > 1:
             res = summarize_structured_hierarchical(text, target_language)
         else:
             res = summarize_structured(text, target_language)
@@ -842,65 +1136,76 @@ async def summarize_multi(
             res["highlights"] = highlight_sentences(text, top_k=5)
         
         items.append(MultiSummaryItem(
-            filename=f.filename,
+            filename=filename,
             executive_summary=res.get("executive_summary", ""),
             bullets=res.get("bullets", []),
             highlights=res.get("highlights", [])
         ))
     
     combined_text = "\n\n".join(combined_texts)
+    target_language = resolve_language(language, combined_text)
     
-    # Use user-selected language or auto-detect
-    if language and language.strip():
-        target_language = language.capitalize()
-    else:
-        target_language = detect_language(combined_text)
-    
-    if len(files) > 1:
+    if len(docs) > 1:
         combined_summary = summarize_hierarchical(combined_text, target_language)
     else:
         combined_summary = summarize_text(combined_text, target_language)
     
     return MultiSummaryResponse(
         items=items,
-        combined_summary=combined_summary
+        combined_summary=combined_summary,
+        usage=current_usage()
     )
 
-@app.post("/qa", response_model=QAResponse)
-async def qa_pdf(
-    question: str = Form(...),
-    files: List[UploadFile] = File(...),
+@app.post("/extract", response_model=ExtractResponse)
+async def extract_pdf(
+    prompt: str = Form(...),
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
     language: str = Form(None),
     pages: str = Form(None)
 ):
-    """Answer questions based on PDF content"""
-    all_texts = []
+    """
+    Fill in a JSON Schema from the PDF. The backend builds the prompt (schema,
+    instructions, problems of a previous reply) and validates the result itself.
+    """
+    combined_text, _, _ = await read_summary_input(files, documents, language, pages)
     
-    for file in files:
-        if not file.filename.endswith(".pdf"):
-            raise HTTPException(status_code=400, detail=f"{file.filename} must be a PDF")
-        
-        content = await file.read()
-        
-        page_numbers = None
-        if pages:
-            file_stream = io.BytesIO(content)
-            reader = PdfReader(file_stream)
-            total_pages = len(reader.pages)
-            page_numbers = parse_page_range(pages, total_pages)
-        
-        text = extract_text_from_pdf(io.BytesIO(content), page_numbers)
-        if not text.strip():
-            raise HTTPException(status_code=400, detail=f"Could not extract text from {file.filename}")
-        all_texts.append(text)
+    response = generate_content(
+        prompt.replace("{{document}}", combined_text),
+        generation_config=genai.types.GenerationConfig(
+            temperature=0.1,
+            response_mime_type="application/json"
+        )
+    )
+    data = extract_json(response.text or "")
+    if not isinstance(data, dict):
+        raise AIServiceError(502, "schema_mismatch", "Extraction response was not a JSON object", retryable=True)
     
-    combined_text = "\n\n--- Next Document ---\n\n".join(all_texts)
+    return ExtractResponse(data=data, usage=current_usage())
+
+@app.post("/qa", response_model=QAResponse)
+async def qa_pdf(
+    question: str = Form(...),
+    files: List[UploadFile] = File(None),
+    documents: str = Form(None),
+    language: str = Form(None),
+    pages: str = Form(None),
+    prompt: str = Form(None),
+    instructions: str = Form(None),
+    history: str = Form(None)
+):
+    """Answer questions based on PDF content, following up on earlier turns of a thread"""
+    use_instructions(instructions, citations=True)
+    conversation = conversation_section(history)
+    combined_text, target_language, _ = await read_summary_input(files, documents, language, pages, labeled=True)
     
-    # Use user-selected language or auto-detect
-    if language and language.strip():
-        target_language = language.capitalize()
-    else:
-        target_language = detect_language(combined_text)
+    if prompt:
+        try:
+            return QAResponse(answer=generate_from_template(prompt, combined_text), usage=current_usage())
+        except AIServiceError:
+            raise
+        except Exception as e:
+            raise HTTPException(status_code=500, detail=str(e))
     
     # Language-specific examples
     lang_examples = {
@@ -929,20 +1234,153 @@ Task: Answer the question based ONLY on the document(s) below.
 Document(s):
 {combined_text[:30000]}
 
-Question:
+{conversation}Question:
 {question}
 
 OUTPUT LANGUAGE: {target_language} ONLY
 """
     
     try:
-        response = gemini_model.generate_content(
+        response = generate_content(
             prompt,
             generation_config=genai.types.GenerationConfig(temperature=0.3)
         )
-        return QAResponse(answer=response.text or "")
+        return QAResponse(answer=response.text or "", usage=current_usage())
+    except AIServiceError:
+        raise
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+
+@app.post("/translate", response_model=TranslateResponse)
+async def translate(request: TranslateRequest):
+    """Translate stored summary texts; one translation per text, in order"""
+    if not request.texts:
+        raise AIServiceError(422, "no_text", "No texts to translate")
+    
+    target_language = request.language.capitalize()
+    prompt = f"""You are a professional translator.
+Translate every string of the JSON array below into {target_language}. Keep the meaning, tone and formatting; do not summarize.
+Respond ONLY with valid JSON in this format, with exactly {len(request.texts)} translations in the same order:
+{{"translations": ["..."]}}
+
+TEXTS:
+{json.dumps(request.texts, ensure_ascii=False)}"""
+    
+    response = generate_content(
+        prompt,
+        generation_config=genai.types.GenerationConfig(
+            temperature=0.2,
+            response_mime_type="application/json"
+        )
+    )
+    result = extract_json(response.text or "")
+    translations = result.get("translations") if isinstance(result, dict) else None
+    if not isinstance(translations, list) or len(translations) != len(request.texts):
+        raise AIServiceError(502, "schema_mismatch", "Translation response did not match the input texts", retryable=True)
+    
+    return TranslateResponse(translations=[str(t) for t in translations], usage=current_usage())
+
+@app.post("/compare", response_model=CompareResponse)
+async def compare(request: CompareRequest):
+    """Summarize the line diff of two document versions, computed by the backend"""
+    if not request.diff.strip():
+        raise AIServiceError(422, "no_text", "No differences to compare")
+    
+    target_language = request.language.capitalize() if request.language else detect_language(request.diff[:1000])
+    prompt = f"""You are a legal and policy analyst comparing two versions of a document.
+The differences below were computed line by line: "-" lines were removed from the old version, "+" lines were added in the new one.
+Summarize what changed in {target_language}. Focus on obligations, rights, deadlines, amounts and conditions; ignore formatting and typo fixes.
+Respond ONLY with valid JSON in this format:
+{{"summary": "...", "added": [{{"description": "...", "section": "...", "old_pages": [], "new_pages": [3]}}], "removed": [...], "changed": [...]}}
+- added: obligations only in the new version; removed: only in the old version; changed: in both, but different
+- Copy section and pages from the header of each difference
+
+OLD VERSION: {request.old_name}
+NEW VERSION: {request.new_name}
+
+DIFFERENCES:
+{request.diff}"""
+    
+    response = generate_content(
+        prompt,
+        generation_config=genai.types.GenerationConfig(
+            temperature=0.2,
+            response_mime_type="application/json"
+        )
+    )
+    result = extract_json(response.text or "")
+    try:
+        comparison = CompareResponse(**result, usage=current_usage())
+    except Exception as e:
+        raise AIServiceError(502, "schema_mismatch", f"Comparison response did not match the schema: {e}", retryable=True)
+    if not comparison.summary.strip():
+        raise AIServiceError(502, "schema_mismatch", "Comparison response has no summary", retryable=True)
+    return comparison
+
+@app.post("/combine", response_model=CombineResponse)
+async def combine(request: CombineRequest):
+    """Combine per-chunk summaries (or per-chunk answers) produced by the backend"""
+    use_instructions(request.instructions)
+    try:
+        return combine_texts(request)
+    except AIServiceError:
+        raise
     except Exception as e:
         raise HTTPException(status_code=500, detail=str(e))
 
+@app.post("/combine-stream")
+async def combine_stream(request: CombineRequest):
+    """Same as /combine, streamed as NDJSON (see stream_ndjson)"""
+    use_instructions(request.instructions)
+    if not any(s and s.strip() for s in request.summaries):
+        raise AIServiceError(422, "no_text", "No summaries to combine")
+    return stream_ndjson(lambda on_token: combine_texts(request, on_token))
+
+def combine_texts(request: CombineRequest, on_token: Optional[Callable[[str], None]] = None) -> CombineResponse:
+    summaries = [s for s in request.summaries if s and s.strip()]
+    if not summaries:
+        raise AIServiceError(422, "no_text", "No summaries to combine")
+    
+    # Use user-selected language or auto-detect
+    if request.language and request.language.strip():
+        target_language = request.language.capitalize()
+    else:
+        target_language = detect_language(summaries[0])
+    
+    if not request.question:
+        return CombineResponse(summary=combine_summaries(summaries, target_language, on_token), usage=current_usage())
+    
+    if len(summaries) == 1 and not request.instructions:
+        if on_token:
+            on_token(summaries[0])
+        return CombineResponse(summary=summaries[0], usage=current_usage())
+    
+    combined = "\n\n--- Next Section ---\n\n".join(summaries)
+    prompt = f"""You are a helpful AI assistant.
+
+ABSOLUTE REQUIREMENT: Write your ENTIRE answer in {target_language} language ONLY.
+
+Task: The question below was answered separately for each section of a document.
+Combine the partial answers into one concise, factual answer.
+- Ignore sections that say the answer was not found
+- Keep the page citations such as [p. 4] after the statements they support
+- If no section contains the answer, say so in {target_language}
+
+Question:
+{request.question}
+
+Partial answers:
+{combined[:25000]}
+
+OUTPUT LANGUAGE: {target_language} ONLY
+"""
+    
+    response = generate_content(
+        prompt,
+        on_token=on_token,
+        generation_config=genai.types.GenerationConfig(temperature=0.3)
+    )
+    return CombineResponse(summary=response.text or "", usage=current_usage())
+
 if __name__ == "__main__":
     uvicorn.run("main:app", host="0.0.0.0", port=8000, reload=True)
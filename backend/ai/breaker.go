@@ -0,0 +1,213 @@
+package ai
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker - Circuit breaker for one provider. After threshold consecutive
+// transient failures (or any rate limit) it opens for the cooldown; then a
+// single probe call decides whether it closes again.
+type Breaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reserves a call, or returns a circuit_open error while the breaker is open
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && time.Now().After(b.openUntil) {
+		b.state = breakerHalfOpen
+		b.probing = false
+	}
+
+	switch b.state {
+	case breakerOpen:
+		return b.openError()
+	case breakerHalfOpen:
+		if b.probing {
+			return b.openError()
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record updates the breaker with a call's outcome. Permanent errors mean the
+// service answered, so they count as success.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A reply that does not fit the mode's schema still means the provider is up
+	aiErr, ok := AsError(err)
+	if err == nil || (ok && (aiErr.Kind == KindPermanent || aiErr.Code == CodeSchemaMismatch)) {
+		if b.state != breakerClosed {
+			log.Printf("✅ AI circuit for %s closed", b.name)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+
+	cooldown := b.cooldown
+	if ok && aiErr.Kind == KindRateLimited && aiErr.RetryAfter > cooldown {
+		cooldown = aiErr.RetryAfter
+	}
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold || (ok && aiErr.Kind == KindRateLimited) {
+		b.state = breakerOpen
+		b.probing = false
+		b.openUntil = time.Now().Add(cooldown)
+		log.Printf("⚠️  AI circuit for %s open for %v after %d failures: %v", b.name, cooldown, b.failures, err)
+	}
+}
+
+// Wait blocks while the breaker is open (or a probe is in flight)
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		wait := time.Duration(0)
+		switch {
+		case b.state == breakerOpen:
+			wait = time.Until(b.openUntil)
+		case b.state == breakerHalfOpen && b.probing:
+			wait = time.Second
+		}
+		b.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// State returns "closed", "open" or "half-open"
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Now().After(b.openUntil) {
+		return breakerHalfOpen.String()
+	}
+	return b.state.String()
+}
+
+func (b *Breaker) openError() *Error {
+	return &Error{
+		Kind:       KindTransient,
+		Code:       CodeCircuitOpen,
+		Message:    "AI provider " + b.name + " is unavailable, circuit open",
+		RetryAfter: time.Until(b.openUntil),
+	}
+}
+
+// guardedProvider - Runs every call of a provider through its breaker
+type guardedProvider struct {
+	Provider
+	breaker *Breaker
+}
+
+func guard(provider Provider, breaker *Breaker) *guardedProvider {
+	return &guardedProvider{Provider: provider, breaker: breaker}
+}
+
+// guarded runs fn through g's breaker
+func guarded[T any](g *guardedProvider, fn func() (T, error)) (T, error) {
+	if err := g.breaker.Allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := fn()
+	g.breaker.Record(err)
+	return result, err
+}
+
+func (g *guardedProvider) Summarize(ctx context.Context, req Request) (*SummaryResponse, error) {
+	return guarded(g, func() (*SummaryResponse, error) { return g.Provider.Summarize(ctx, req) })
+}
+
+func (g *guardedProvider) SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error) {
+	return guarded(g, func() (*StructuredResponse, error) { return g.Provider.SummarizeStructured(ctx, req) })
+}
+
+func (g *guardedProvider) SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error) {
+	return guarded(g, func() (*MultiResponse, error) { return g.Provider.SummarizeMulti(ctx, req) })
+}
+
+func (g *guardedProvider) Answer(ctx context.Context, req Request) (*QAResponse, error) {
+	return guarded(g, func() (*QAResponse, error) { return g.Provider.Answer(ctx, req) })
+}
+
+func (g *guardedProvider) Extract(ctx context.Context, req Request) (*ExtractResponse, error) {
+	return guarded(g, func() (*ExtractResponse, error) { return g.Provider.Extract(ctx, req) })
+}
+
+func (g *guardedProvider) Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error) {
+	return guarded(g, func() (*TranslateResponse, error) { return g.Provider.Translate(ctx, texts, language) })
+}
+
+func (g *guardedProvider) Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error) {
+	return guarded(g, func() (*CompareResponse, error) { return g.Provider.Compare(ctx, req) })
+}
+
+func (g *guardedProvider) Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error) {
+	return guarded(g, func() (*SummaryResponse, error) { return g.Provider.Combine(ctx, texts, language, question, style) })
+}
+
+func (g *guardedProvider) SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error) {
+	return guarded(g, func() (*SummaryResponse, error) { return g.Provider.SummarizeStream(ctx, req, onToken) })
+}
+
+func (g *guardedProvider) CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error) {
+	return guarded(g, func() (*SummaryResponse, error) {
+		return g.Provider.CombineStream(ctx, texts, language, question, style, onToken)
+	})
+}
@@ -0,0 +1,76 @@
+package ai
+
+import (
+	"pdf-summarizer-backend/citation"
+	"strings"
+)
+
+// citationRules asks for a page marker after every statement of the
+// structured and qa modes; the markers are parsed and checked by package citation
+const citationRules = `PAGE CITATIONS: The document is split into pages, each starting with a [Page N] line.
+End every bullet, every highlight and every sentence of an answer with the page(s) it is based on, written as [p. N] or [pp. N, M], e.g. "Payment is due within 30 days. [p. 4]".
+Cite only pages the statement is taken from.`
+
+// combineCitationRules keeps the markers of partial answers when they are merged
+const combineCitationRules = `Keep the page citations such as [p. 4] after the statements they support.`
+
+// quotedText - Sentences of a document or of cited texts, with the pages each came from
+type quotedText struct {
+	sentences []string
+	pages     map[string][]int
+}
+
+func (q *quotedText) add(sentence string, pages ...int) {
+	if q.pages == nil {
+		q.pages = make(map[string][]int)
+	}
+	if _, seen := q.pages[sentence]; !seen {
+		q.sentences = append(q.sentences, sentence)
+	}
+	q.pages[sentence] = append(q.pages[sentence], pages...)
+}
+
+// pageSentences splits each page into sentences
+func pageSentences(pages []Page) *quotedText {
+	q := &quotedText{}
+	for _, page := range pages {
+		for _, sentence := range splitSentences(page.Text) {
+			q.add(sentence, page.Number)
+		}
+	}
+	return q
+}
+
+// citedSentences splits texts that carry page markers, such as per-chunk
+// answers, into sentences without the markers
+func citedSentences(texts []string) *quotedText {
+	q := &quotedText{}
+	for _, text := range texts {
+		for _, statement := range citation.Sentences(text) {
+			q.add(statement.Text, statement.Pages...)
+		}
+	}
+	return q
+}
+
+// cite appends to each selected sentence the marker of its pages
+func (q *quotedText) cite(selected []string) []string {
+	cited := make([]string, len(selected))
+	for i, sentence := range selected {
+		cited[i] = sentence
+		if pages := q.pages[sentence]; len(pages) > 0 {
+			cited[i] += " " + citation.Marker(pages...)
+		}
+	}
+	return cited
+}
+
+// citeJoined cites the selected sentences and joins them into one text
+func (q *quotedText) citeJoined(selected []string) string {
+	return strings.Join(q.cite(selected), " ")
+}
+
+// withCitations asks for page citations, after any style requirements
+func withCitations(prompt string) string {
+	return prompt + "\n\n" + citationRules
+}
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/diff"
+	"strings"
+)
+
+// maxChangeChars bounds the quoted text of one change built without a model
+const maxChangeChars = 240
+
+// CompareRequest - Input of Compare: the Go-side diff of two versions of a document
+type CompareRequest struct {
+	OldName  string
+	NewName  string
+	Diff     *diff.Result
+	Language string // "" = the language of the documents
+}
+
+// Change - One added, removed or changed obligation and where it is
+type Change struct {
+	Description string `json:"description"`
+	Section     string `json:"section,omitempty"`
+	OldPages    []int  `json:"old_pages,omitempty"`
+	NewPages    []int  `json:"new_pages,omitempty"`
+}
+
+// CompareResponse - Compare
+type CompareResponse struct {
+	Summary  string   `json:"summary"`
+	Added    []Change `json:"added"`
+	Removed  []Change `json:"removed"`
+	Changed  []Change `json:"changed"`
+	Provider string   `json:"provider,omitempty"`
+	Usage    *Usage   `json:"usage,omitempty"`
+}
+
+func (r *CompareResponse) Validate() error {
+	if strings.TrimSpace(r.Summary) == "" {
+		return schemaError("compare", "summary is empty")
+	}
+	for kind, changes := range map[string][]Change{"added": r.Added, "removed": r.Removed, "changed": r.Changed} {
+		for i, change := range changes {
+			if strings.TrimSpace(change.Description) == "" {
+				return schemaError("compare", fmt.Sprintf("%s change %d has no description", kind, i+1))
+			}
+		}
+	}
+	return nil
+}
+
+// comparePrompt asks for the structured comparison of req's diff
+func comparePrompt(req CompareRequest) string {
+	return fmt.Sprintf(`You are a legal and policy analyst comparing two versions of a document.
+The differences below were computed line by line: "-" lines were removed from the old version, "+" lines were added in the new one.
+Summarize what changed in %s. Focus on obligations, rights, deadlines, amounts and conditions; ignore formatting and typo fixes.
+Respond ONLY with valid JSON in this format:
+{"summary": "...", "added": [{"description": "...", "section": "...", "old_pages": [], "new_pages": [3]}], "removed": [...], "changed": [...]}
+- added: obligations only in the new version; removed: only in the old version; changed: in both, but different
+- Copy section and pages from the header of each difference
+
+OLD VERSION: %s
+NEW VERSION: %s
+
+DIFFERENCES:
+%s`, targetLanguage(req.Language), req.OldName, req.NewName, req.Diff.Format(maxInputChars))
+}
+
+// diffChanges builds a comparison straight from the diff, one change per
+// hunk, for the providers that run without a model
+func diffChanges(req CompareRequest) *CompareResponse {
+	resp := &CompareResponse{Added: []Change{}, Removed: []Change{}, Changed: []Change{}}
+	for _, hunk := range req.Diff.Hunks {
+		change := Change{Section: hunk.Section, OldPages: pageList(hunk.OldPage), NewPages: pageList(hunk.NewPage)}
+		switch hunk.Kind {
+		case diff.Added:
+			change.Description = quoteLines(hunk.New)
+			resp.Added = append(resp.Added, change)
+		case diff.Removed:
+			change.Description = quoteLines(hunk.Old)
+			resp.Removed = append(resp.Removed, change)
+		default:
+			change.Description = quoteLines(hunk.Old) + " → " + quoteLines(hunk.New)
+			resp.Changed = append(resp.Changed, change)
+		}
+	}
+
+	if req.Diff.Empty() {
+		resp.Summary = fmt.Sprintf("No differences found between %s and %s.", req.OldName, req.NewName)
+	} else {
+		resp.Summary = fmt.Sprintf("%s differs from %s in %d places: %d added, %d removed and %d changed passages (%d lines added, %d removed).",
+			req.NewName, req.OldName, len(req.Diff.Hunks), len(resp.Added), len(resp.Removed), len(resp.Changed),
+			req.Diff.AddedLines, req.Diff.RemovedLines)
+	}
+	return resp
+}
+
+// quoteLines joins lines into one quoted passage, shortened to maxChangeChars
+func quoteLines(lines []string) string {
+	text := strings.Join(lines, " ")
+	if runes := []rune(text); len(runes) > maxChangeChars {
+		text = string(runes[:maxChangeChars]) + "…"
+	}
+	return fmt.Sprintf("%q", text)
+}
+
+func pageList(page int) []int {
+	if page == 0 {
+		return nil
+	}
+	return []int{page}
+}
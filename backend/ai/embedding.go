@@ -0,0 +1,220 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"pdf-summarizer-backend/config"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedding provider names
+const (
+	EmbedderLocal  = "local"  // Feature hashing in Go; deterministic and offline, for tests and local development
+	EmbedderOpenAI = "openai" // Any OpenAI-compatible /embeddings endpoint
+)
+
+// localDimensions - Length of the local embedder's vectors
+const localDimensions = 512
+
+// Embedder - Turns texts into vectors; the more related two texts are, the
+// higher the cosine similarity of their vectors. Vectors of different
+// models are not comparable.
+type Embedder interface {
+	Name() string
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var embedders = map[string]Embedder{}
+
+// initEmbedders registers the embedding providers; called by Init
+func initEmbedders(baseURL, apiKey, model string, timeout time.Duration) {
+	embedders = map[string]Embedder{
+		EmbedderLocal:  NewLocalEmbedder(),
+		EmbedderOpenAI: NewOpenAIEmbedder(baseURL, apiKey, model, timeout),
+	}
+}
+
+// GetEmbedder returns the named embedding provider
+func GetEmbedder(name string) (Embedder, error) {
+	embedder, ok := embedders[name]
+	if !ok {
+		return nil, Permanent("unknown_provider", "unknown embedding provider %q", name)
+	}
+	return embedder, nil
+}
+
+// DefaultEmbedder returns the deployment's embedding provider
+func DefaultEmbedder() (Embedder, error) {
+	return GetEmbedder(config.AppConfig.EmbeddingProvider)
+}
+
+// EmbedderNames lists the registered embedding providers
+func EmbedderNames() []string {
+	names := make([]string, 0, len(embedders))
+	for name := range embedders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cosine returns the cosine similarity of two vectors, 0 when their lengths differ
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// LocalEmbedder - Hashes the words of a text and their character trigrams
+// into a fixed-length vector. It captures shared vocabulary, not meaning, but
+// needs no model and always returns the same vector for the same text.
+type LocalEmbedder struct{}
+
+// NewLocalEmbedder creates the local embedding provider
+func NewLocalEmbedder() *LocalEmbedder {
+	return &LocalEmbedder{}
+}
+
+func (e *LocalEmbedder) Name() string { return EmbedderLocal }
+
+func (e *LocalEmbedder) Model() string { return fmt.Sprintf("hash-%d", localDimensions) }
+
+func (e *LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = hashVector(text)
+	}
+	return vectors, nil
+}
+
+// hashVector adds each word with weight 1 and each of its trigrams with
+// weight 0.5 at a hashed position and sign, then scales the vector to unit length
+func hashVector(text string) []float32 {
+	vector := make([]float32, localDimensions)
+	add := func(feature string, weight float32) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		vector[sum%localDimensions] += weight
+	}
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		add(word, 1)
+		runes := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			add(string(runes[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector
+}
+
+// OpenAIEmbedder - The /embeddings endpoint of an OpenAI-compatible server
+// (OpenAI, Ollama, llama.cpp server, vLLM, ...)
+type OpenAIEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder creates an embedding provider for an OpenAI-compatible server
+func NewOpenAIEmbedder(baseURL, apiKey, model string, timeout time.Duration) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *OpenAIEmbedder) Name() string { return EmbedderOpenAI }
+
+func (e *OpenAIEmbedder) Model() string { return e.model }
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embedding request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpError(resp, respBody)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, Transient(CodeBadResponse, "failed to parse embeddings: %v", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, Transient(CodeBadResponse, "expected %d embeddings, got %d", len(texts), len(result.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) || len(item.Embedding) == 0 {
+			return nil, Transient(CodeBadResponse, "invalid embedding at index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
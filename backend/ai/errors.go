@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind - How a failed AI call should be handled
+type ErrorKind string
+
+const (
+	KindPermanent   ErrorKind = "permanent"    // Retrying cannot help (bad input)
+	KindTransient   ErrorKind = "transient"    // Service or network trouble; retry later
+	KindRateLimited ErrorKind = "rate_limited" // Retry after RetryAfter
+	KindTimeout     ErrorKind = "timeout"      // No answer in time; retry later
+)
+
+// Error codes shared with the Python service's structured error body
+const (
+	CodeInvalidFile    = "invalid_file_format"
+	CodeInvalidPDF     = "invalid_pdf"
+	CodeEncryptedPDF   = "encrypted_pdf"
+	CodeNoText         = "no_text"
+	CodeFileNotFound   = "file_not_found"
+	CodeBudgetExceeded = "budget_exceeded"
+	CodeCircuitOpen    = "circuit_open"
+	CodeRateLimited    = "rate_limited"
+	CodeTimeout        = "timeout"
+	CodeUpstream       = "upstream_error"
+	CodeBadResponse    = "bad_response"
+	CodeUnsupported    = "unsupported" // The provider can't run this kind of call
+)
+
+// Error - A classified AI failure
+type Error struct {
+	Kind       ErrorKind
+	Code       string
+	Message    string
+	StatusCode int           // HTTP status from the provider, 0 if none
+	RetryAfter time.Duration // Rate-limited only
+	Err        error         // Underlying transport error, if any
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Kind, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Permanent creates a non-retryable error
+func Permanent(code, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindPermanent, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Transient creates a retryable error
+func Transient(code, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindTransient, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// AsError returns the classified error in err's chain
+func AsError(err error) (*Error, bool) {
+	var aiErr *Error
+	if errors.As(err, &aiErr) {
+		return aiErr, true
+	}
+	return nil, false
+}
+
+// IsPermanent reports whether err can't be fixed by retrying.
+// Unclassified errors are treated as retryable.
+func IsPermanent(err error) bool {
+	aiErr, ok := AsError(err)
+	return ok && aiErr.Kind == KindPermanent
+}
+
+// HasCode reports whether err carries the given error code
+func HasCode(err error, code string) bool {
+	aiErr, ok := AsError(err)
+	return ok && aiErr.Code == code
+}
+
+// errorBody - Structured error returned by the Python service;
+// FastAPI's default {"detail": "..."} is accepted too
+type errorBody struct {
+	Error *struct {
+		Code       string  `json:"code"`
+		Message    string  `json:"message"`
+		Retryable  *bool   `json:"retryable"`
+		RetryAfter float64 `json:"retry_after"`
+	} `json:"error"`
+	Detail interface{} `json:"detail"`
+}
+
+// httpError classifies a non-200 response by status code and error body
+func httpError(resp *http.Response, body []byte) *Error {
+	aiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+
+	var parsed errorBody
+	if json.Unmarshal(body, &parsed) == nil {
+		switch {
+		case parsed.Error != nil:
+			aiErr.Code = parsed.Error.Code
+			aiErr.Message = parsed.Error.Message
+			aiErr.RetryAfter = time.Duration(parsed.Error.RetryAfter * float64(time.Second))
+		case parsed.Detail != nil:
+			aiErr.Message = fmt.Sprintf("%v", parsed.Detail)
+		}
+	}
+	if aiErr.Message == "" {
+		aiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		aiErr.Kind = KindRateLimited
+		if aiErr.Code == "" {
+			aiErr.Code = CodeRateLimited
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			aiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		aiErr.Kind = KindTimeout
+		if aiErr.Code == "" {
+			aiErr.Code = CodeTimeout
+		}
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		// Auth failures are deployment problems, not the job's fault
+		aiErr.Kind = KindTransient
+		if aiErr.Code == "" {
+			aiErr.Code = CodeUpstream
+		}
+	default:
+		aiErr.Kind = KindPermanent
+	}
+
+	// The service knows best whether its own failure is worth retrying
+	if parsed.Error != nil && parsed.Error.Retryable != nil && aiErr.Kind != KindRateLimited {
+		if *parsed.Error.Retryable && aiErr.Kind == KindPermanent {
+			aiErr.Kind = KindTransient
+		} else if !*parsed.Error.Retryable {
+			aiErr.Kind = KindPermanent
+		}
+	}
+
+	return aiErr
+}
+
+// streamError classifies an error reported inside a streamed 200 response,
+// using the status the non-streaming endpoint would have answered with
+func streamError(body []byte) *Error {
+	var parsed errorBody
+	status := http.StatusServiceUnavailable
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != nil {
+		switch {
+		case parsed.Error.Code == CodeRateLimited:
+			status = http.StatusTooManyRequests
+		case parsed.Error.Code == CodeTimeout:
+			status = http.StatusGatewayTimeout
+		case parsed.Error.Retryable != nil && !*parsed.Error.Retryable:
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	return httpError(&http.Response{StatusCode: status, Header: http.Header{}}, body)
+}
+
+// transportError classifies a failure to get any response
+func transportError(err error) *Error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &Error{Kind: KindTimeout, Code: CodeTimeout, Message: err.Error(), Err: err}
+	}
+	return &Error{Kind: KindTransient, Code: CodeUpstream, Message: err.Error(), Err: err}
+}
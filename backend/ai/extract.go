@@ -0,0 +1,234 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// extractAttempts is how often extract mode asks the provider before giving up
+// on a reply that violates the schema
+const extractAttempts = 3
+
+// maxFeedbackViolations caps the violations quoted back to the provider
+const maxFeedbackViolations = 10
+
+// extract runs extract mode: the provider fills in req.Schema and the reply
+// is validated here, re-asking with the list of violations until it fits.
+// The usage of every attempt is added up.
+func extract(ctx context.Context, provider Provider, req Request) (*ExtractResponse, error) {
+	if req.Schema == nil {
+		return nil, Permanent(CodeInvalidSchema, "extract mode needs a schema")
+	}
+
+	var (
+		total      *Usage
+		violations []string
+	)
+	for attempt := 1; attempt <= extractAttempts; attempt++ {
+		req.Violations = violations
+		resp, err := provider.Extract(ctx, req)
+		if HasCode(err, CodeSchemaMismatch) {
+			// Not even a JSON object; ask again
+			violations = []string{"$: " + err.Error()}
+			log.Printf("⚠️  %s extract attempt %d/%d: %v", provider.Name(), attempt, extractAttempts, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		total = addUsage(total, resp.Usage)
+
+		violations = req.Schema.Validate(resp.Data, req.Partial)
+		if len(violations) == 0 {
+			resp.Usage = total
+			return resp, nil
+		}
+		log.Printf("⚠️  %s extract attempt %d/%d violates the schema: %s",
+			provider.Name(), attempt, extractAttempts, strings.Join(violations, "; "))
+	}
+	return nil, Transient(CodeSchemaMismatch, "extracted data does not match the schema after %d attempts: %s",
+		extractAttempts, strings.Join(first(violations, maxFeedbackViolations), "; "))
+}
+
+// addUsage returns the sum of two usages; either may be nil
+func addUsage(total, usage *Usage) *Usage {
+	if usage == nil {
+		return total
+	}
+	if total == nil {
+		copied := *usage
+		return &copied
+	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.InputChars += usage.InputChars
+	total.OutputChars += usage.OutputChars
+	total.Calls += usage.Calls
+	return total
+}
+
+// extractPrompt asks for req.Schema filled in from document, quoting the
+// violations of the previous reply if there are any
+func extractPrompt(document string, req Request) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, `You are a precise information extraction system.
+Fill in the JSON Schema below with information from the document.
+- Respond ONLY with one JSON object that validates against the schema.
+- Use only facts stated in the document. Omit properties the document does not state.
+- Write dates as YYYY-MM-DD. Write free text values in %s.
+`, targetLanguage(req.Language))
+	if req.Partial {
+		prompt.WriteString("- The document is one part of a longer document; required properties may be omitted if this part does not state them.\n")
+	}
+
+	fmt.Fprintf(&prompt, "\nSCHEMA:\n%s\n", req.Schema.String())
+
+	if len(req.Violations) > 0 {
+		prompt.WriteString("\nYour previous answer did not validate. Fix these problems:\n")
+		for _, violation := range first(req.Violations, maxFeedbackViolations) {
+			fmt.Fprintf(&prompt, "- %s\n", violation)
+		}
+	}
+
+	fmt.Fprintf(&prompt, "\nDOCUMENT:\n%s", document)
+	return prompt.String()
+}
+
+// jsonObject cuts the outermost JSON object out of a reply that may wrap it in prose or code fences
+func jsonObject(content string) []byte {
+	if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+		content = content[start : end+1]
+	}
+	return []byte(content)
+}
+
+// MergeExtracted combines the data extracted from several parts of one
+// document, in document order: the first value found for a property wins,
+// arrays are concatenated without duplicates and objects are merged property by property
+func MergeExtracted(schema *Schema, parts []json.RawMessage) (json.RawMessage, error) {
+	var merged interface{}
+	for _, part := range parts {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(part))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, Permanent(CodeSchemaMismatch, "invalid extracted data: %v", err)
+		}
+		merged = mergeValue(schema, merged, value)
+	}
+	return json.Marshal(merged)
+}
+
+func mergeValue(schema *Schema, current, next interface{}) interface{} {
+	if current == nil {
+		return next
+	}
+	if next == nil {
+		return current
+	}
+
+	switch cur := current.(type) {
+	case map[string]interface{}:
+		add, ok := next.(map[string]interface{})
+		if !ok {
+			return current
+		}
+		for name, value := range add {
+			var property *Schema
+			if schema != nil {
+				property = schema.Properties[name]
+			}
+			cur[name] = mergeValue(property, cur[name], value)
+		}
+		return cur
+
+	case []interface{}:
+		add, ok := next.([]interface{})
+		if !ok {
+			return current
+		}
+		seen := make(map[string]bool, len(cur))
+		for _, item := range cur {
+			key, _ := json.Marshal(item)
+			seen[string(key)] = true
+		}
+		for _, item := range add {
+			if schema != nil && schema.MaxItems != nil && len(cur) >= *schema.MaxItems {
+				break
+			}
+			key, _ := json.Marshal(item)
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				cur = append(cur, item)
+			}
+		}
+		return cur
+
+	case string:
+		if strings.TrimSpace(cur) == "" {
+			return next
+		}
+	}
+	return current
+}
+
+// fillWithoutModel fills in schema without a model, from the passages text
+// returns. It fails when the result does not validate, e.g. because a
+// required property could not be read off a passage.
+func fillWithoutModel(provider string, schema *Schema, partial bool, text func(query string) string) ([]byte, error) {
+	value, ok := fillSchema(schema, "", text)
+	if !ok {
+		value = map[string]interface{}{}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if violations := schema.Validate(data, partial); len(violations) > 0 {
+		return nil, Permanent(CodeUnsupported, "the %s provider cannot fill in this schema: %s",
+			provider, strings.Join(first(violations, maxFeedbackViolations), "; "))
+	}
+	return data, nil
+}
+
+// fillSchema builds a value for schema without a model. Only free text can be
+// taken from the document: text is asked for the passage best matching a
+// property's name and description. Enums, numbers, booleans and formatted
+// strings such as dates cannot be read off a passage, so they are left out
+// instead of guessed; ok is false when there is nothing to fill in.
+func fillSchema(schema *Schema, name string, text func(query string) string) (interface{}, bool) {
+	if schema == nil || len(schema.Enum) > 0 {
+		return nil, false
+	}
+
+	switch schema.mainType() {
+	case "object":
+		object := make(map[string]interface{}, len(schema.Properties))
+		for _, property := range sortedKeys(schema.Properties) {
+			if value, ok := fillSchema(schema.Properties[property], property, text); ok {
+				object[property] = value
+			}
+		}
+		return object, name == "" || len(object) > 0
+	case "array":
+		if schema.MaxItems != nil && *schema.MaxItems < 1 {
+			return []interface{}{}, true
+		}
+		item, ok := fillSchema(schema.Items, name, text)
+		if !ok {
+			return nil, false
+		}
+		return []interface{}{item}, true
+	case "string":
+		if schema.Format != "" {
+			return nil, false
+		}
+		value := text(strings.TrimSpace(strings.ReplaceAll(name, "_", " ") + " " + schema.Description))
+		return value, value != ""
+	}
+	return nil, false
+}
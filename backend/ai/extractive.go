@@ -0,0 +1,228 @@
+package ai
+
+import (
+	"context"
+	"pdf-summarizer-backend/extractive"
+	"strings"
+)
+
+// Sentences picked by the extractive provider
+const (
+	extractiveSummarySentences = 5
+	extractiveExecSentences    = 3
+	extractiveBullets          = 5
+	extractiveHighlights       = 3
+	extractiveAnswerSentences  = 3
+)
+
+// ExtractiveProvider - Selects the document's most central sentences with
+// LexRank instead of generating text. It runs in-process, so it is used both
+// for the extractive mode and as the fallback while a provider's circuit is open.
+type ExtractiveProvider struct{}
+
+// NewExtractiveProvider creates the extractive provider
+func NewExtractiveProvider() *ExtractiveProvider {
+	return &ExtractiveProvider{}
+}
+
+func (p *ExtractiveProvider) Name() string { return ProviderExtractive }
+
+func (p *ExtractiveProvider) Summarize(ctx context.Context, req Request) (*SummaryResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := strings.Join(extractiveSelect(doc.sentences, extractiveSummarySentences, "", req.Style), " ")
+	return validated(&SummaryResponse{Summary: summary, Provider: p.Name(), Usage: extractiveUsage(input, summary)})
+}
+
+func (p *ExtractiveProvider) SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := extractiveStructured(doc.sentences, req.Style)
+	resp.Bullets = doc.cite(resp.Bullets)
+	resp.Highlights = doc.cite(resp.Highlights)
+	resp.Provider = p.Name()
+	resp.Usage = extractiveUsage(input, resp.ExecutiveSummary)
+	return validated(resp)
+}
+
+func (p *ExtractiveProvider) SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error) {
+	if len(req.Files) == 0 {
+		return nil, Permanent(CodeFileNotFound, "no document in request")
+	}
+
+	resp := &MultiResponse{Provider: p.Name()}
+	var all []string
+	input := 0
+	for _, file := range req.Files {
+		text, err := extractText(file, req.Pages)
+		if err != nil {
+			return nil, err
+		}
+		input += len(text)
+
+		sentences := splitSentences(text)
+		all = append(all, sentences...)
+
+		item := extractiveStructured(sentences, nil)
+		resp.Items = append(resp.Items, MultiItem{
+			Filename:         file.Name,
+			ExecutiveSummary: item.ExecutiveSummary,
+			Bullets:          item.Bullets,
+			Highlights:       item.Highlights,
+		})
+	}
+
+	resp.CombinedSummary = strings.Join(extractiveSelect(all, extractiveSummarySentences, "", req.Style), " ")
+	resp.Usage = extractiveUsage(input, resp.CombinedSummary)
+	return validated(resp)
+}
+
+func (p *ExtractiveProvider) Answer(ctx context.Context, req Request) (*QAResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query-focused ranking: the passages closest to the question. A follow-up
+	// question often leans on the previous one ("and the deadline?")
+	query := req.Question
+	if n := len(req.History); n > 0 {
+		query += " " + req.History[n-1].Question
+	}
+	answer := doc.citeJoined(extractiveSelect(doc.sentences, extractiveAnswerSentences, query, req.Style))
+	return validated(&QAResponse{Answer: answer, Provider: p.Name(), Usage: extractiveUsage(input, answer)})
+}
+
+// Extract fills free text properties with the sentence ranked closest to
+// the property's name and description; it fails when the schema requires more
+func (p *ExtractiveProvider) Extract(ctx context.Context, req Request) (*ExtractResponse, error) {
+	if req.Schema == nil {
+		return nil, Permanent(CodeInvalidSchema, "extract mode needs a schema")
+	}
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fillWithoutModel(p.Name(), req.Schema, req.Partial, func(query string) string {
+		return strings.Join(extractive.Summarize(doc.sentences, 1, query), " ")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return validated(&ExtractResponse{Data: data, Provider: p.Name(), Usage: extractiveUsage(input, string(data))})
+}
+
+// Translate is not possible without a model
+func (p *ExtractiveProvider) Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error) {
+	return nil, Permanent(CodeUnsupported, "the extractive provider cannot translate")
+}
+
+// Compare quotes the changed passages, one change per diff hunk
+func (p *ExtractiveProvider) Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error) {
+	resp := diffChanges(req)
+	resp.Provider = p.Name()
+	resp.Usage = extractiveUsage(len(req.Diff.Format(maxInputChars)), resp.Summary)
+	return validated(resp)
+}
+
+func (p *ExtractiveProvider) Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error) {
+	input := 0
+	for _, text := range texts {
+		input += len(text)
+	}
+	// Partial answers keep their page citations
+	quoted := citedSentences(texts)
+
+	n := extractiveSummarySentences
+	if question != "" {
+		n = extractiveAnswerSentences
+	}
+	summary := quoted.citeJoined(extractiveSelect(quoted.sentences, n, question, style))
+	return validated(&SummaryResponse{Summary: summary, Provider: p.Name(), Usage: extractiveUsage(input, summary)})
+}
+
+func (p *ExtractiveProvider) SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error) {
+	resp, err := p.Summarize(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	streamSentences(resp.Summary, onToken)
+	return resp, nil
+}
+
+func (p *ExtractiveProvider) CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error) {
+	resp, err := p.Combine(ctx, texts, language, question, style)
+	if err != nil {
+		return nil, err
+	}
+	streamSentences(resp.Summary, onToken)
+	return resp, nil
+}
+
+// sentences extracts the sentences of the request's document, page by page
+func (p *ExtractiveProvider) sentences(req Request) (*quotedText, int, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	pages, err := extractPages(file, req.Pages)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	input := 0
+	for _, page := range pages {
+		input += len(page.Text)
+	}
+	return pageSentences(pages), input, nil
+}
+
+// streamSentences passes the selected sentences to onToken one at a time
+func streamSentences(text string, onToken TokenFunc) {
+	for i, sentence := range splitSentences(text) {
+		if i > 0 {
+			sentence = " " + sentence
+		}
+		onToken(sentence)
+	}
+}
+
+// extractiveUsage reports characters only; no tokens are spent
+func extractiveUsage(inputChars int, output string) *Usage {
+	return &Usage{
+		Model:       ProviderExtractive,
+		InputChars:  int64(inputChars),
+		OutputChars: int64(len(output)),
+		Calls:       1,
+	}
+}
+
+// extractiveStructured builds a structured summary from the ranking: the top
+// sentences in document order as the executive summary (sized by style), the
+// next ones as bullets and the top few, best first, as highlights
+func extractiveStructured(sentences []string, style *Style) *StructuredResponse {
+	exec := extractiveSelect(sentences, extractiveExecSentences, "", style)
+	ranked := extractive.TopIndices(sentences, len(exec)+extractiveBullets, "")
+
+	bullets := []string{}
+	for _, index := range ranked[min(len(exec), len(ranked)):] {
+		bullets = append(bullets, sentences[index])
+	}
+	highlights := []string{}
+	for _, index := range ranked[:min(extractiveHighlights, len(ranked))] {
+		highlights = append(highlights, sentences[index])
+	}
+
+	return &StructuredResponse{
+		ExecutiveSummary: strings.Join(exec, " "),
+		Bullets:          bullets,
+		Highlights:       highlights,
+	}
+}
@@ -0,0 +1,236 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FakeProvider - Deterministic, offline provider built from the document's own
+// sentences. The same input always yields the same output.
+type FakeProvider struct{}
+
+// NewFakeProvider creates the fake provider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (p *FakeProvider) Name() string { return ProviderFake }
+
+func (p *FakeProvider) Summarize(ctx context.Context, req Request) (*SummaryResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := strings.Join(first(doc.sentences, 3), " ")
+	return validated(&SummaryResponse{Summary: summary, Provider: p.Name(), Usage: fakeUsage(input, summary)})
+}
+
+func (p *FakeProvider) SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := fakeStructured(doc.sentences)
+	resp.Bullets = doc.cite(resp.Bullets)
+	resp.Highlights = doc.cite(resp.Highlights)
+	resp.Provider = p.Name()
+	resp.Usage = fakeUsage(input, resp.ExecutiveSummary)
+	return validated(resp)
+}
+
+func (p *FakeProvider) SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error) {
+	if len(req.Files) == 0 {
+		return nil, Permanent(CodeFileNotFound, "no document in request")
+	}
+
+	resp := &MultiResponse{Provider: p.Name()}
+	var openings []string
+	input := 0
+	for _, file := range req.Files {
+		text, err := extractText(file, req.Pages)
+		if err != nil {
+			return nil, err
+		}
+		input += len(text)
+
+		sentences := splitSentences(text)
+		openings = append(openings, first(sentences, 1)...)
+
+		item := fakeStructured(sentences)
+		resp.Items = append(resp.Items, MultiItem{
+			Filename:         file.Name,
+			ExecutiveSummary: item.ExecutiveSummary,
+			Bullets:          item.Bullets,
+			Highlights:       item.Highlights,
+		})
+	}
+
+	resp.CombinedSummary = strings.Join(openings, " ")
+	resp.Usage = fakeUsage(input, resp.CombinedSummary)
+	return validated(resp)
+}
+
+func (p *FakeProvider) Answer(ctx context.Context, req Request) (*QAResponse, error) {
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	best := doc.citeJoined([]string{bestSentence(doc.sentences, req.Question)})
+	return validated(&QAResponse{Answer: best, Provider: p.Name(), Usage: fakeUsage(input, best)})
+}
+
+func (p *FakeProvider) Extract(ctx context.Context, req Request) (*ExtractResponse, error) {
+	if req.Schema == nil {
+		return nil, Permanent(CodeInvalidSchema, "extract mode needs a schema")
+	}
+	doc, input, err := p.sentences(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fillWithoutModel(p.Name(), req.Schema, req.Partial, func(query string) string {
+		return bestSentence(doc.sentences, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return validated(&ExtractResponse{Data: data, Provider: p.Name(), Usage: fakeUsage(input, string(data))})
+}
+
+// Translate tags each text with the target language instead of translating it
+func (p *FakeProvider) Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error) {
+	resp := &TranslateResponse{Provider: p.Name()}
+	input := 0
+	for _, text := range texts {
+		resp.Translations = append(resp.Translations, fmt.Sprintf("[%s] %s", targetLanguage(language), text))
+		input += len(text)
+	}
+	resp.Usage = fakeUsage(input, strings.Join(resp.Translations, ""))
+	return translated(resp, texts)
+}
+
+// Compare reports one change per diff hunk
+func (p *FakeProvider) Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error) {
+	resp := diffChanges(req)
+	resp.Provider = p.Name()
+	resp.Usage = fakeUsage(len(req.Diff.Format(maxInputChars)), resp.Summary)
+	return validated(resp)
+}
+
+func (p *FakeProvider) Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error) {
+	var parts []string
+	input := 0
+	for _, text := range texts {
+		input += len(text)
+		quoted := citedSentences([]string{text})
+		parts = append(parts, quoted.cite(first(quoted.sentences, 1))...)
+	}
+
+	summary := strings.Join(parts, " ")
+	return validated(&SummaryResponse{Summary: summary, Provider: p.Name(), Usage: fakeUsage(input, summary)})
+}
+
+func (p *FakeProvider) SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error) {
+	resp, err := p.Summarize(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	streamWords(resp.Summary, onToken)
+	return resp, nil
+}
+
+func (p *FakeProvider) CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error) {
+	resp, err := p.Combine(ctx, texts, language, question, style)
+	if err != nil {
+		return nil, err
+	}
+	streamWords(resp.Summary, onToken)
+	return resp, nil
+}
+
+// sentences extracts the sentences of the request's document, page by page
+func (p *FakeProvider) sentences(req Request) (*quotedText, int, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	pages, err := extractPages(file, req.Pages)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	input := 0
+	for _, page := range pages {
+		input += len(page.Text)
+	}
+	return pageSentences(pages), input, nil
+}
+
+// fakeUsage counts 4 characters per token
+func fakeUsage(inputChars int, output string) *Usage {
+	return &Usage{
+		Model:            ProviderFake,
+		PromptTokens:     int64(inputChars / 4),
+		CompletionTokens: int64(len(output) / 4),
+		InputChars:       int64(inputChars),
+		OutputChars:      int64(len(output)),
+		Calls:            1,
+	}
+}
+
+// fakeStructured builds a structured summary: opening sentences, following
+// sentences as bullets and the longest sentences as highlights
+func fakeStructured(sentences []string) *StructuredResponse {
+	bullets := append([]string{}, first(sentences[min(2, len(sentences)):], 5)...)
+
+	longest := append([]string(nil), sentences...)
+	sort.SliceStable(longest, func(i, j int) bool { return len(longest[i]) > len(longest[j]) })
+	highlights := append([]string{}, first(longest, 3)...)
+
+	return &StructuredResponse{
+		ExecutiveSummary: strings.Join(first(sentences, 2), " "),
+		Bullets:          bullets,
+		Highlights:       highlights,
+	}
+}
+
+// streamWords passes text to onToken one word (with its leading space) at a time
+func streamWords(text string, onToken TokenFunc) {
+	for i, word := range strings.Fields(text) {
+		if i > 0 {
+			word = " " + word
+		}
+		onToken(word)
+	}
+}
+
+// bestSentence picks the sentence sharing the most words with query
+func bestSentence(sentences []string, query string) string {
+	words := strings.Fields(strings.ToLower(query))
+	best, bestScore := "", -1
+	for _, sentence := range sentences {
+		lower := strings.ToLower(sentence)
+		score := 0
+		for _, word := range words {
+			if len(word) > 3 && strings.Contains(lower, word) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = sentence, score
+		}
+	}
+	return best
+}
+
+func first(items []string, n int) []string {
+	if len(items) < n {
+		return items
+	}
+	return items[:n]
+}
@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxHistoryChars bounds the conversation sent with a question; the oldest
+// turns are dropped first
+const maxHistoryChars = 8000
+
+// recentTurns returns the latest turns of history that fit in maxHistoryChars, oldest first
+func recentTurns(history []Turn) []Turn {
+	chars := 0
+	start := len(history)
+	for start > 0 {
+		turn := history[start-1]
+		if chars += len(turn.Question) + len(turn.Answer); chars > maxHistoryChars {
+			break
+		}
+		start--
+	}
+	return history[start:]
+}
+
+// historySection renders the conversation so far for a QA prompt; "" without history
+func historySection(history []Turn) string {
+	turns := recentTurns(history)
+	if len(turns) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("CONVERSATION SO FAR (use it to understand follow-up questions; answer only from the document):\n")
+	for _, turn := range turns {
+		fmt.Fprintf(&sb, "Q: %s\nA: %s\n\n", turn.Question, turn.Answer)
+	}
+	return sb.String()
+}
@@ -0,0 +1,476 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// structuredAttempts is how often a malformed structured JSON reply is re-requested
+const structuredAttempts = 2
+
+// OpenAIProvider - Any OpenAI-compatible chat-completions endpoint
+// (OpenAI, llama.cpp server, Ollama, vLLM, ...). PDF text is extracted in Go.
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAIProvider creates a provider for an OpenAI-compatible server
+func NewOpenAIProvider(baseURL, apiKey, model string, timeout time.Duration) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *OpenAIProvider) Name() string { return ProviderOpenAI }
+
+func (p *OpenAIProvider) Summarize(ctx context.Context, req Request) (*SummaryResponse, error) {
+	return p.SummarizeStream(ctx, req, nil)
+}
+
+func (p *OpenAIProvider) SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, err
+	}
+	text, err := extractText(file, req.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := summarizePrompt(text, req.Language)
+	if req.Prompt != "" {
+		prompt = templatePrompt(req, "simple", &text)
+	}
+	prompt = withStyle(prompt, req.Style)
+
+	usage := p.newUsage()
+	summary, err := p.complete(ctx, usage, prompt, onToken)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SummaryResponse{Summary: summary, Provider: p.Name(), Usage: usage}
+	return validated(resp)
+}
+
+func (p *OpenAIProvider) SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, err
+	}
+	text, err := extractLabeledText(file, req.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := structuredPrompt(text, req.Language)
+	if req.Prompt != "" {
+		prompt = templatePrompt(req, "structured", &text)
+	}
+	prompt = withCitations(withStyle(prompt, req.Style))
+
+	usage := p.newUsage()
+	resp, err := p.structured(ctx, usage, prompt)
+	if err != nil {
+		return nil, err
+	}
+	resp.Provider = p.Name()
+	resp.Usage = usage
+	return resp, nil
+}
+
+func (p *OpenAIProvider) SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error) {
+	if len(req.Files) == 0 {
+		return nil, Permanent(CodeFileNotFound, "no document in request")
+	}
+
+	usage := p.newUsage()
+	resp := &MultiResponse{Provider: p.Name(), Usage: usage}
+	var texts []string
+	for _, file := range req.Files {
+		text, err := extractText(file, req.Pages)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+
+		item, err := p.structured(ctx, usage, structuredPrompt(text, req.Language))
+		if err != nil {
+			return nil, err
+		}
+		resp.Items = append(resp.Items, MultiItem{
+			Filename:         file.Name,
+			ExecutiveSummary: item.ExecutiveSummary,
+			Bullets:          item.Bullets,
+			Highlights:       item.Highlights,
+		})
+	}
+
+	combined := strings.Join(texts, "\n\n")
+	if runes := []rune(combined); len(runes) > maxInputChars {
+		combined = string(runes[:maxInputChars])
+	}
+	summary, err := p.chat(ctx, usage, false, withStyle(summarizePrompt(combined, req.Language), req.Style))
+	if err != nil {
+		return nil, err
+	}
+	resp.CombinedSummary = summary
+
+	return validated(resp)
+}
+
+func (p *OpenAIProvider) Answer(ctx context.Context, req Request) (*QAResponse, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, err
+	}
+	text, err := extractLabeledText(file, req.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := fmt.Sprintf(`You are a helpful AI assistant.
+Answer the question using ONLY the document below. If the answer is not in the document, say so.
+Answer in %s.
+
+DOCUMENT:
+%s
+
+%sQUESTION: %s`, targetLanguage(req.Language), text, historySection(req.History), req.Question)
+	if req.Prompt != "" {
+		prompt = templatePrompt(req, "qa", &text)
+	}
+	prompt = withCitations(withStyle(prompt, req.Style))
+
+	usage := p.newUsage()
+	answer, err := p.chat(ctx, usage, false, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &QAResponse{Answer: answer, Provider: p.Name(), Usage: usage}
+	return validated(resp)
+}
+
+func (p *OpenAIProvider) Extract(ctx context.Context, req Request) (*ExtractResponse, error) {
+	file, err := firstFile(req)
+	if err != nil {
+		return nil, err
+	}
+	text, err := extractText(file, req.Pages)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := p.newUsage()
+	content, err := p.chat(ctx, usage, true, extractPrompt(text, req))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ExtractResponse{Data: jsonObject(content), Provider: p.Name(), Usage: usage}
+	return validated(resp)
+}
+
+func (p *OpenAIProvider) Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error) {
+	return p.CombineStream(ctx, texts, language, question, style, nil)
+}
+
+func (p *OpenAIProvider) CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error) {
+	joined := strings.Join(texts, "\n\n---\n\n")
+
+	var prompt string
+	if question != "" {
+		prompt = fmt.Sprintf(`You are a helpful AI assistant.
+Each section below answers the question from a different part of one document.
+Merge them into one answer, dropping parts that say the information is missing. Answer in %s.
+`+combineCitationRules+`
+
+QUESTION: %s
+
+PARTIAL ANSWERS:
+%s`, targetLanguage(language), question, joined)
+	} else {
+		prompt = fmt.Sprintf(`You are a professional editor.
+Each section below summarizes a different part of one document, in order.
+Combine them into one coherent summary without repetition. Write in %s.
+
+SECTIONS:
+%s`, targetLanguage(language), joined)
+	}
+	prompt = withStyle(prompt, style)
+
+	usage := p.newUsage()
+	summary, err := p.complete(ctx, usage, prompt, onToken)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SummaryResponse{Summary: summary, Provider: p.Name(), Usage: usage}
+	return validated(resp)
+}
+
+func (p *OpenAIProvider) Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error) {
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode texts: %w", err)
+	}
+
+	prompt := fmt.Sprintf(`You are a professional translator.
+Translate every string of the JSON array below into %s. Keep the meaning, tone and formatting; do not summarize.
+Respond ONLY with valid JSON in this format, with exactly %d translations in the same order:
+{"translations": ["..."]}
+
+TEXTS:
+%s`, targetLanguage(language), len(texts), input)
+
+	usage := p.newUsage()
+	var lastErr error
+	for attempt := 0; attempt < structuredAttempts; attempt++ {
+		content, err := p.chat(ctx, usage, true, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &TranslateResponse{}
+		if lastErr = decodeInto("translate", jsonObject(content), resp); lastErr != nil {
+			continue
+		}
+		resp.Provider = p.Name()
+		resp.Usage = usage
+		if resp, lastErr = translated(resp, texts); lastErr == nil {
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+func (p *OpenAIProvider) Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error) {
+	prompt := comparePrompt(req)
+
+	usage := p.newUsage()
+	var lastErr error
+	for attempt := 0; attempt < structuredAttempts; attempt++ {
+		content, err := p.chat(ctx, usage, true, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &CompareResponse{}
+		if lastErr = decodeInto("compare", jsonObject(content), resp); lastErr == nil {
+			resp.Provider = p.Name()
+			resp.Usage = usage
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// structured asks for the structured summary JSON, re-asking once if the reply doesn't fit the schema
+func (p *OpenAIProvider) structured(ctx context.Context, usage *Usage, prompt string) (*StructuredResponse, error) {
+	var lastErr error
+	for attempt := 0; attempt < structuredAttempts; attempt++ {
+		content, err := p.chat(ctx, usage, true, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Some local servers ignore response_format and wrap the JSON in prose
+		resp := &StructuredResponse{}
+		if lastErr = decodeInto("structured", jsonObject(content), resp); lastErr == nil {
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+func structuredPrompt(text, language string) string {
+	return fmt.Sprintf(`You are a professional analyst. Summarize the document below in %s.
+%s
+
+DOCUMENT:
+%s`, targetLanguage(language), structuredFormat, text)
+}
+
+func summarizePrompt(text, language string) string {
+	return fmt.Sprintf(`You are a professional document summarizer.
+Summarize the document below in %s in 2-4 concise paragraphs covering its main points.
+
+DOCUMENT:
+%s`, targetLanguage(language), text)
+}
+
+func (p *OpenAIProvider) newUsage() *Usage {
+	return &Usage{Model: p.model}
+}
+
+// complete returns the reply to prompt, streaming it to onToken when set
+func (p *OpenAIProvider) complete(ctx context.Context, usage *Usage, prompt string, onToken TokenFunc) (string, error) {
+	if onToken == nil {
+		return p.chat(ctx, usage, false, prompt)
+	}
+	return p.chatStream(ctx, usage, prompt, onToken)
+}
+
+// chat sends one user message and returns the assistant's reply
+func (p *OpenAIProvider) chat(ctx context.Context, usage *Usage, jsonMode bool, prompt string) (string, error) {
+	payload := p.chatPayload(prompt)
+	if jsonMode {
+		payload["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	resp, err := p.post(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", transportError(err)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *completionUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return "", Transient(CodeBadResponse, "failed to parse response: %v", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", Transient(CodeBadResponse, "AI service returned no choices")
+	}
+
+	content := strings.TrimSpace(completion.Choices[0].Message.Content)
+	usage.add(prompt, content, completion.Usage)
+	return content, nil
+}
+
+// chatStream is chat with stream: true, passing each content delta to onToken
+func (p *OpenAIProvider) chatStream(ctx context.Context, usage *Usage, prompt string, onToken TokenFunc) (string, error) {
+	payload := p.chatPayload(prompt)
+	payload["stream"] = true
+	payload["stream_options"] = map[string]bool{"include_usage": true}
+
+	resp, err := p.post(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var (
+		content  strings.Builder
+		reported *completionUsage
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		data = strings.TrimSpace(data)
+		if !ok || data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *completionUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", Transient(CodeBadResponse, "failed to parse stream chunk: %v", err)
+		}
+		if chunk.Usage != nil {
+			reported = chunk.Usage
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onToken(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", transportError(err)
+	}
+
+	text := strings.TrimSpace(content.String())
+	usage.add(prompt, text, reported)
+	return text, nil
+}
+
+func (p *OpenAIProvider) chatPayload(prompt string) map[string]interface{} {
+	return map[string]interface{}{
+		"model":       p.model,
+		"messages":    []map[string]string{{"role": "user", "content": prompt}},
+		"temperature": 0.3,
+	}
+}
+
+// post sends a chat-completions request; any non-200 answer is returned as an error
+func (p *OpenAIProvider) post(ctx context.Context, payload map[string]interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, transportError(err)
+		}
+		return nil, httpError(resp, respBody)
+	}
+	return resp, nil
+}
+
+// completionUsage - Token counts reported by a chat-completions server
+type completionUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// add records one call; servers that report no usage leave only the character counts
+func (u *Usage) add(prompt, content string, reported *completionUsage) {
+	u.Calls++
+	u.InputChars += int64(len(prompt))
+	u.OutputChars += int64(len(content))
+	if reported != nil {
+		u.PromptTokens += reported.PromptTokens
+		u.CompletionTokens += reported.CompletionTokens
+	}
+}
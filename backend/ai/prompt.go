@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prompt template variables, written as {{name}}
+const (
+	VarDocument = "document" // Extracted text of the requested pages
+	VarLanguage = "language" // Target language
+	VarQuestion = "question" // QA mode only
+)
+
+// TemplateModes are the modes a prompt template can replace the built-in prompt of
+var TemplateModes = []string{"simple", "structured", "qa"}
+
+// structuredFormat is appended to structured prompts so every template yields the same JSON
+const structuredFormat = `Respond ONLY with valid JSON in this format:
+{"executive_summary": "3-5 sentences", "bullets": ["5-8 key points"], "highlights": ["3-5 important sentences quoted from the document"]}`
+
+var templateVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// ValidateTemplate checks a template's variables for mode
+func ValidateTemplate(text, mode string) error {
+	supported := false
+	for _, m := range TemplateModes {
+		supported = supported || m == mode
+	}
+	if !supported {
+		return fmt.Errorf("templates are not supported for mode %q (supported: %s)", mode, strings.Join(TemplateModes, ", "))
+	}
+
+	used := map[string]bool{}
+	for _, match := range templateVariable.FindAllStringSubmatch(text, -1) {
+		switch name := match[1]; name {
+		case VarDocument, VarLanguage:
+		case VarQuestion:
+			if mode != "qa" {
+				return fmt.Errorf("{{%s}} is only available in qa templates", name)
+			}
+		default:
+			return fmt.Errorf("unknown variable {{%s}} (available: document, language, question)", name)
+		}
+		used[match[1]] = true
+	}
+
+	if !used[VarDocument] {
+		return fmt.Errorf("template must include {{%s}}", VarDocument)
+	}
+	if mode == "qa" && !used[VarQuestion] {
+		return fmt.Errorf("qa templates must include {{%s}}", VarQuestion)
+	}
+	return nil
+}
+
+// renderTemplate fills the variables in vars; any other variable is left
+// in its canonical {{name}} form for the provider to fill
+func renderTemplate(text string, vars map[string]string) string {
+	return templateVariable.ReplaceAllStringFunc(text, func(match string) string {
+		name := templateVariable.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return "{{" + name + "}}"
+	})
+}
+
+// templatePrompt renders req.Prompt for a mode, leaving {{document}} unless document is given
+func templatePrompt(req Request, mode string, document *string) string {
+	vars := map[string]string{
+		VarLanguage: targetLanguage(req.Language),
+		VarQuestion: req.Question,
+	}
+	if document != nil {
+		vars[VarDocument] = *document
+	}
+
+	prompt := renderTemplate(req.Prompt, vars)
+	if mode == "structured" {
+		prompt += "\n\n" + structuredFormat
+	}
+	return prompt
+}
+
+// WithTemplate returns a copy of style carrying a job's prompt template into
+// the combine step, so the combined text follows it like the chunks did. The
+// sections to combine stand in for {{document}}.
+func (s *Style) WithTemplate(template, language, question string) *Style {
+	if template == "" {
+		return s
+	}
+
+	var styled Style
+	if s != nil {
+		styled = *s
+	}
+	styled.Template = renderTemplate(template, map[string]string{
+		VarDocument: "(the sections to combine)",
+		VarLanguage: targetLanguage(language),
+		VarQuestion: question,
+	})
+	return &styled
+}
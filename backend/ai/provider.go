@@ -0,0 +1,226 @@
+// Package ai abstracts the language model backends used for summarization.
+package ai
+
+import (
+	"context"
+	"log"
+	"pdf-summarizer-backend/config"
+	"sort"
+	"time"
+)
+
+// Provider names
+const (
+	ProviderPython = "python" // Python FastAPI service (Gemini)
+	ProviderOpenAI = "openai" // Any OpenAI-compatible chat-completions endpoint
+	ProviderFake   = "fake"   // Deterministic, offline; for tests and local development
+
+	// ProviderExtractive - Built-in LexRank summarizer; no model, never unavailable
+	ProviderExtractive = "extractive"
+)
+
+// File - A PDF sent to the provider, either whole or as the text of its pages
+type File struct {
+	Name  string
+	Data  []byte
+	Pages []Page // Text of the requested pages, extracted by the backend; when set, Data is not read and Request.Pages is already applied
+}
+
+// Page - The text of one page, numbered from 1
+type Page struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// Request - Input of one AI call
+type Request struct {
+	Files    []File // Multi mode may send several; other modes use the first
+	Language string // "" = detect from the document
+	Pages    string // Page range, e.g. "1-5,7"; "" = all pages
+	Question string // QA mode
+	History  []Turn // QA mode: earlier questions and answers of the conversation, oldest first
+	Prompt   string // Custom prompt template (see ValidateTemplate); "" = the provider's own prompt
+	Style    *Style // Length, audience, tone and format of the main text; nil = the provider's default
+
+	// Extract mode
+	Schema     *Schema  // JSON Schema to fill in
+	Partial    bool     // The pages are one part of the document; required properties may be missing
+	Violations []string // Problems of the previous reply, quoted back to the provider
+}
+
+// Turn - One earlier question and answer of a QA conversation
+type Turn struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// TokenFunc receives generated text as it arrives
+type TokenFunc func(delta string)
+
+// Provider - A summarization backend. Every response is validated against
+// its mode's struct before it is returned.
+type Provider interface {
+	Name() string
+	Summarize(ctx context.Context, req Request) (*SummaryResponse, error)
+	SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error)
+	SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error)
+	Answer(ctx context.Context, req Request) (*QAResponse, error)
+
+	// Extract returns req.Schema filled in from the document. The reply is
+	// only checked to be a JSON object; extract validates it against the schema.
+	Extract(ctx context.Context, req Request) (*ExtractResponse, error)
+
+	// Translate translates each text into language, keeping the order
+	Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error)
+
+	// Compare summarizes the differences between two versions of a document,
+	// as computed by package diff, into added, removed and changed obligations
+	Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error)
+
+	// Combine merges partial summaries (or partial answers when question is set),
+	// writing the result in style
+	Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error)
+
+	// SummarizeStream and CombineStream also pass the text to onToken as it is
+	// generated. The returned response holds the complete text.
+	SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error)
+	CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error)
+}
+
+var (
+	providers = map[string]Provider{}
+	breakers  = map[string]*Breaker{}
+)
+
+// Init registers the providers configured for this deployment, each behind its own circuit breaker
+func Init() {
+	timeout := time.Duration(config.AppConfig.AITimeout) * time.Second
+	cooldown := time.Duration(config.AppConfig.AIBreakerCooldown) * time.Second
+
+	backends := []Provider{
+		NewPythonProvider(config.AppConfig.AIServiceURL, timeout),
+		NewOpenAIProvider(config.AppConfig.OpenAIBaseURL, config.AppConfig.OpenAIAPIKey, config.AppConfig.OpenAIModel, timeout),
+		NewFakeProvider(),
+		NewExtractiveProvider(),
+	}
+
+	providers = make(map[string]Provider, len(backends))
+	breakers = make(map[string]*Breaker, len(backends))
+	for _, backend := range backends {
+		breaker := NewBreaker(backend.Name(), config.AppConfig.AIBreakerThreshold, cooldown)
+		breakers[backend.Name()] = breaker
+		providers[backend.Name()] = guard(backend, breaker)
+	}
+
+	if _, ok := providers[config.AppConfig.AIProvider]; !ok {
+		log.Fatalf("Unknown AI_PROVIDER %q (available: %v)", config.AppConfig.AIProvider, Names())
+	}
+	log.Printf("✅ AI provider: %s", config.AppConfig.AIProvider)
+
+	initEmbedders(config.AppConfig.OpenAIBaseURL, config.AppConfig.OpenAIAPIKey, config.AppConfig.EmbeddingModel, timeout)
+	embedder, err := DefaultEmbedder()
+	if err != nil {
+		log.Fatalf("Unknown EMBEDDING_PROVIDER %q (available: %v)", config.AppConfig.EmbeddingProvider, EmbedderNames())
+	}
+	log.Printf("✅ Embedding provider: %s (%s)", embedder.Name(), embedder.Model())
+}
+
+// Get returns the named provider, or the deployment default when name is empty
+func Get(name string) (Provider, error) {
+	if name == "" {
+		name = DefaultName()
+	}
+	provider, ok := providers[name]
+	if !ok {
+		return nil, Permanent("unknown_provider", "unknown AI provider %q", name)
+	}
+	return provider, nil
+}
+
+// DefaultName returns the deployment's default provider
+func DefaultName() string {
+	return config.AppConfig.AIProvider
+}
+
+// WaitAvailable blocks while the named provider's circuit is open
+func WaitAvailable(ctx context.Context, name string) error {
+	if name == "" {
+		name = DefaultName()
+	}
+	breaker, ok := breakers[name]
+	if !ok {
+		return nil
+	}
+	return breaker.Wait(ctx)
+}
+
+// BreakerStates reports each provider's circuit state
+func BreakerStates() map[string]string {
+	states := make(map[string]string, len(breakers))
+	for name, breaker := range breakers {
+		states[name] = breaker.State()
+	}
+	return states
+}
+
+// Names lists the registered providers
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CallStream is Call, streaming the text of the modes that produce a single
+// text (simple and extractive); other modes are not streamed
+func CallStream(ctx context.Context, provider Provider, mode string, req Request, onToken TokenFunc) (*Result, error) {
+	var (
+		resp *SummaryResponse
+		err  error
+	)
+	switch {
+	case onToken == nil:
+		return Call(ctx, provider, mode, req)
+	case mode == "simple":
+		resp, err = provider.SummarizeStream(ctx, req, onToken)
+	case mode == "extractive":
+		resp, err = providers[ProviderExtractive].SummarizeStream(ctx, req, onToken)
+	default:
+		return Call(ctx, provider, mode, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Simple: resp}, nil
+}
+
+// Call dispatches req to the provider method for mode
+func Call(ctx context.Context, provider Provider, mode string, req Request) (*Result, error) {
+	var (
+		result = &Result{}
+		err    error
+	)
+	switch mode {
+	case "simple":
+		result.Simple, err = provider.Summarize(ctx, req)
+	case "extractive":
+		// Extractive mode never needs a model, whatever provider the job names
+		result.Simple, err = providers[ProviderExtractive].Summarize(ctx, req)
+	case "structured":
+		result.Structured, err = provider.SummarizeStructured(ctx, req)
+	case "multi":
+		result.Multi, err = provider.SummarizeMulti(ctx, req)
+	case "qa":
+		result.QA, err = provider.Answer(ctx, req)
+	case "extract":
+		result.Extract, err = extract(ctx, provider, req)
+	default:
+		return nil, Permanent(CodeInvalidFile, "unsupported mode %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,345 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// maxStreamLine bounds one NDJSON line; the final line carries the whole summary
+const maxStreamLine = 4 * 1024 * 1024
+
+// PythonProvider - The FastAPI service in ai-service/, one endpoint per mode
+type PythonProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewPythonProvider creates a provider for the Python AI service
+func NewPythonProvider(baseURL string, timeout time.Duration) *PythonProvider {
+	return &PythonProvider{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *PythonProvider) Name() string { return ProviderPython }
+
+func (p *PythonProvider) Summarize(ctx context.Context, req Request) (*SummaryResponse, error) {
+	resp := &SummaryResponse{}
+	if err := p.postFiles(ctx, "/summarize", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) SummarizeStructured(ctx context.Context, req Request) (*StructuredResponse, error) {
+	resp := &StructuredResponse{}
+	if err := p.postFiles(ctx, "/summarize-structured", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) SummarizeMulti(ctx context.Context, req Request) (*MultiResponse, error) {
+	resp := &MultiResponse{}
+	if err := p.postFiles(ctx, "/summarize-multi", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) Answer(ctx context.Context, req Request) (*QAResponse, error) {
+	resp := &QAResponse{}
+	if err := p.postFiles(ctx, "/qa", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) Extract(ctx context.Context, req Request) (*ExtractResponse, error) {
+	resp := &ExtractResponse{}
+	if err := p.postFiles(ctx, "/extract", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) Combine(ctx context.Context, texts []string, language, question string, style *Style) (*SummaryResponse, error) {
+	httpReq, err := p.combineRequest(ctx, "/combine", texts, language, question, style)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SummaryResponse{}
+	if err := p.do(httpReq, "combine", resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) Translate(ctx context.Context, texts []string, language string) (*TranslateResponse, error) {
+	body, err := json.Marshal(map[string]interface{}{"texts": texts, "language": language})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode translate request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp := &TranslateResponse{}
+	if err := p.do(httpReq, "translate", resp); err != nil {
+		return nil, err
+	}
+	return translated(resp, texts)
+}
+
+func (p *PythonProvider) Compare(ctx context.Context, req CompareRequest) (*CompareResponse, error) {
+	payload := map[string]interface{}{
+		"diff":     req.Diff.Format(maxInputChars),
+		"old_name": req.OldName,
+		"new_name": req.NewName,
+	}
+	if req.Language != "" {
+		payload["language"] = req.Language
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode compare request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/compare", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp := &CompareResponse{}
+	if err := p.do(httpReq, "compare", resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) SummarizeStream(ctx context.Context, req Request, onToken TokenFunc) (*SummaryResponse, error) {
+	httpReq, err := p.filesRequest(ctx, "/summarize-stream", req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SummaryResponse{}
+	if err := p.doStream(httpReq, "summarize", onToken, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *PythonProvider) CombineStream(ctx context.Context, texts []string, language, question string, style *Style, onToken TokenFunc) (*SummaryResponse, error) {
+	httpReq, err := p.combineRequest(ctx, "/combine-stream", texts, language, question, style)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SummaryResponse{}
+	if err := p.doStream(httpReq, "combine", onToken, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// combineRequest builds the JSON request of /combine and /combine-stream
+func (p *PythonProvider) combineRequest(ctx context.Context, endpoint string, texts []string, language, question string, style *Style) (*http.Request, error) {
+	payload := map[string]interface{}{
+		"summaries": texts,
+	}
+	if language != "" {
+		payload["language"] = language
+	}
+	if question != "" {
+		payload["question"] = question
+	}
+	if instructions := style.Instructions(); instructions != "" {
+		payload["instructions"] = instructions
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode combine request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+// postFiles sends the PDFs and form fields as multipart/form-data
+func (p *PythonProvider) postFiles(ctx context.Context, endpoint string, req Request, target interface{ Validate() error }) error {
+	httpReq, err := p.filesRequest(ctx, endpoint, req)
+	if err != nil {
+		return err
+	}
+	return p.do(httpReq, endpoint, target)
+}
+
+// filesRequest builds a multipart/form-data request with the PDFs and form fields
+func (p *PythonProvider) filesRequest(ctx context.Context, endpoint string, req Request) (*http.Request, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	// Page text extracted by the backend is sent instead of the PDF
+	var documents []pythonDocument
+	for _, file := range req.Files {
+		if file.Pages != nil {
+			documents = append(documents, pythonDocument{Name: file.Name, Pages: file.Pages})
+			continue
+		}
+		part, err := writer.CreateFormFile("files", file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create form file: %w", err)
+		}
+		if _, err := part.Write(file.Data); err != nil {
+			return nil, fmt.Errorf("failed to copy file: %w", err)
+		}
+	}
+	if len(documents) > 0 {
+		data, err := json.Marshal(documents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode documents: %w", err)
+		}
+		writer.WriteField("documents", string(data))
+	}
+
+	// Add optional fields
+	if req.Language != "" {
+		writer.WriteField("language", req.Language)
+	}
+	if req.Pages != "" && len(documents) == 0 {
+		writer.WriteField("pages", req.Pages)
+	}
+	if req.Question != "" {
+		writer.WriteField("question", req.Question)
+	}
+	if turns := recentTurns(req.History); len(turns) > 0 {
+		history, err := json.Marshal(turns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode history: %w", err)
+		}
+		writer.WriteField("history", string(history))
+	}
+	if instructions := req.Style.Instructions(); instructions != "" {
+		// Appended by the service to the prompts that write the summary
+		writer.WriteField("instructions", instructions)
+	}
+	if req.Schema != nil {
+		writer.WriteField("prompt", extractPrompt("{{"+VarDocument+"}}", req))
+	} else if req.Prompt != "" {
+		// The service extracts the text and fills {{document}} itself
+		writer.WriteField("prompt", templatePrompt(req, templateMode(endpoint), nil))
+	}
+
+	writer.Close()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	return httpReq, nil
+}
+
+// pythonDocument - The extracted pages of one document, sent as the "documents" form field
+type pythonDocument struct {
+	Name  string `json:"name"`
+	Pages []Page `json:"pages"`
+}
+
+// templateMode is the mode whose prompt a multipart endpoint runs
+func templateMode(endpoint string) string {
+	switch endpoint {
+	case "/summarize-structured":
+		return "structured"
+	case "/qa":
+		return "qa"
+	}
+	return "simple"
+}
+
+// do sends the request and decodes the response into target, validating it
+func (p *PythonProvider) do(httpReq *http.Request, what string, target interface{ Validate() error }) error {
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp, respBody)
+	}
+
+	return decodeInto(what, respBody, target)
+}
+
+// doStream reads the NDJSON stream of a *-stream endpoint: {"delta"} lines go
+// to onToken, the last line is the complete response or {"error"}
+func (p *PythonProvider) doStream(httpReq *http.Request, what string, onToken TokenFunc, target interface{ Validate() error }) error {
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return transportError(err)
+		}
+		return httpError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var event struct {
+			Delta *string         `json:"delta"`
+			Error json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return Transient(CodeBadResponse, "failed to parse %s stream: %v", what, err)
+		}
+		switch {
+		case event.Delta != nil:
+			onToken(*event.Delta)
+		case event.Error != nil:
+			return streamError(line)
+		default:
+			return decodeInto(what, line, target)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return transportError(err)
+	}
+	return Transient(CodeBadResponse, "%s stream ended without a response", what)
+}
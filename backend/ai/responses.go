@@ -0,0 +1,336 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"pdf-summarizer-backend/citation"
+	"strings"
+)
+
+const (
+	// CodeSchemaMismatch - The provider answered, but not in the mode's response shape
+	CodeSchemaMismatch = "schema_mismatch"
+
+	// CodeInvalidSchema - An extract job's JSON Schema is missing or unusable
+	CodeInvalidSchema = "invalid_schema"
+)
+
+// Usage - Token usage reported with a response
+type Usage struct {
+	Model            string `json:"model"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	InputChars       int64  `json:"input_chars"`
+	OutputChars      int64  `json:"output_chars"`
+	Calls            int    `json:"calls"`
+}
+
+// SummaryResponse - simple mode and combine
+type SummaryResponse struct {
+	Summary  string `json:"summary"`
+	Provider string `json:"provider,omitempty"`
+	Usage    *Usage `json:"usage,omitempty"`
+}
+
+// StructuredResponse - structured mode
+type StructuredResponse struct {
+	ExecutiveSummary string   `json:"executive_summary"`
+	Bullets          []string `json:"bullets"`
+	Highlights       []string `json:"highlights"`
+	Provider         string   `json:"provider,omitempty"`
+	Usage            *Usage   `json:"usage,omitempty"`
+}
+
+// MultiItem - Per-document part of a multi mode response
+type MultiItem struct {
+	Filename         string   `json:"filename"`
+	ExecutiveSummary string   `json:"executive_summary"`
+	Bullets          []string `json:"bullets"`
+	Highlights       []string `json:"highlights"`
+}
+
+// MultiResponse - multi mode
+type MultiResponse struct {
+	Items           []MultiItem `json:"items"`
+	CombinedSummary string      `json:"combined_summary"`
+	Provider        string      `json:"provider,omitempty"`
+	Usage           *Usage      `json:"usage,omitempty"`
+}
+
+// QAResponse - qa mode
+type QAResponse struct {
+	Answer   string `json:"answer"`
+	Provider string `json:"provider,omitempty"`
+	Usage    *Usage `json:"usage,omitempty"`
+}
+
+// ExtractResponse - extract mode; Data is the JSON object filling the job's schema
+type ExtractResponse struct {
+	Data     json.RawMessage `json:"data"`
+	Provider string          `json:"provider,omitempty"`
+	Usage    *Usage          `json:"usage,omitempty"`
+}
+
+// TranslateResponse - Translate; one translation per input text, in order
+type TranslateResponse struct {
+	Translations []string `json:"translations"`
+	Provider     string   `json:"provider,omitempty"`
+	Usage        *Usage   `json:"usage,omitempty"`
+}
+
+func (r *SummaryResponse) Validate() error {
+	if strings.TrimSpace(r.Summary) == "" {
+		return schemaError("summary", "summary is empty")
+	}
+	return nil
+}
+
+func (r *StructuredResponse) Validate() error {
+	return validateStructured("structured", r.ExecutiveSummary, r.Bullets, r.Highlights)
+}
+
+func (r *MultiResponse) Validate() error {
+	if len(r.Items) == 0 {
+		return schemaError("multi", "items are empty")
+	}
+	for i, item := range r.Items {
+		if err := validateStructured(fmt.Sprintf("multi item %d", i+1), item.ExecutiveSummary, item.Bullets, item.Highlights); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(r.CombinedSummary) == "" {
+		return schemaError("multi", "combined_summary is empty")
+	}
+	return nil
+}
+
+func (r *QAResponse) Validate() error {
+	if strings.TrimSpace(r.Answer) == "" {
+		return schemaError("qa", "answer is empty")
+	}
+	return nil
+}
+
+// Validate only checks that Data is an object; the schema is checked by extract
+func (r *ExtractResponse) Validate() error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(r.Data, &object); err != nil || object == nil {
+		return schemaError("extract", "data is not a JSON object")
+	}
+	return nil
+}
+
+func (r *TranslateResponse) Validate() error {
+	if len(r.Translations) == 0 {
+		return schemaError("translate", "translations are empty")
+	}
+	for i, text := range r.Translations {
+		if strings.TrimSpace(text) == "" {
+			return schemaError("translate", fmt.Sprintf("translation %d is empty", i+1))
+		}
+	}
+	return nil
+}
+
+// translated checks that resp has exactly one translation per text
+func translated(resp *TranslateResponse, texts []string) (*TranslateResponse, error) {
+	if len(resp.Translations) != len(texts) {
+		return nil, schemaError("translate", fmt.Sprintf("got %d translations for %d texts", len(resp.Translations), len(texts)))
+	}
+	return validated(resp)
+}
+
+func validateStructured(what, executiveSummary string, bullets, highlights []string) error {
+	switch {
+	case strings.TrimSpace(executiveSummary) == "":
+		return schemaError(what, "executive_summary is empty")
+	case bullets == nil:
+		return schemaError(what, "bullets are missing")
+	case highlights == nil:
+		return schemaError(what, "highlights are missing")
+	}
+	return nil
+}
+
+// Result - Validated output of one mode call; exactly one field is set.
+// It marshals to the mode's own response shape, which is how chunk results are stored.
+type Result struct {
+	Simple     *SummaryResponse
+	Structured *StructuredResponse
+	Multi      *MultiResponse
+	QA         *QAResponse
+	Extract    *ExtractResponse
+}
+
+// Usage returns the token usage reported with the result
+func (r *Result) Usage() *Usage {
+	switch {
+	case r.Simple != nil:
+		return r.Simple.Usage
+	case r.Structured != nil:
+		return r.Structured.Usage
+	case r.Multi != nil:
+		return r.Multi.Usage
+	case r.QA != nil:
+		return r.QA.Usage
+	case r.Extract != nil:
+		return r.Extract.Usage
+	}
+	return nil
+}
+
+// AddUsage adds the usage of an earlier, discarded reply to the result's own
+func (r *Result) AddUsage(usage *Usage) {
+	total := addUsage(r.Usage(), usage)
+	switch {
+	case r.Simple != nil:
+		r.Simple.Usage = total
+	case r.Structured != nil:
+		r.Structured.Usage = total
+	case r.Multi != nil:
+		r.Multi.Usage = total
+	case r.QA != nil:
+		r.QA.Usage = total
+	case r.Extract != nil:
+		r.Extract.Usage = total
+	}
+}
+
+// Text returns the result's main text, the part a style's length applies to,
+// without page citations
+func (r *Result) Text() string {
+	var text string
+	switch {
+	case r.Simple != nil:
+		text = r.Simple.Summary
+	case r.Structured != nil:
+		text = r.Structured.ExecutiveSummary
+	case r.Multi != nil:
+		text = r.Multi.CombinedSummary
+	case r.QA != nil:
+		text = r.QA.Answer
+	}
+	text, _ = citation.Strip(text)
+	return text
+}
+
+// ClearUsage drops the usage once it has been accounted for
+func (r *Result) ClearUsage() {
+	switch {
+	case r.Simple != nil:
+		r.Simple.Usage = nil
+	case r.Structured != nil:
+		r.Structured.Usage = nil
+	case r.Multi != nil:
+		r.Multi.Usage = nil
+	case r.QA != nil:
+		r.QA.Usage = nil
+	case r.Extract != nil:
+		r.Extract.Usage = nil
+	}
+}
+
+// Provider returns the name of the provider that produced the result
+func (r *Result) Provider() string {
+	switch {
+	case r.Simple != nil:
+		return r.Simple.Provider
+	case r.Structured != nil:
+		return r.Structured.Provider
+	case r.Multi != nil:
+		return r.Multi.Provider
+	case r.QA != nil:
+		return r.QA.Provider
+	case r.Extract != nil:
+		return r.Extract.Provider
+	}
+	return ""
+}
+
+// SetProvider records which provider produced the result
+func (r *Result) SetProvider(name string) {
+	switch {
+	case r.Simple != nil:
+		r.Simple.Provider = name
+	case r.Structured != nil:
+		r.Structured.Provider = name
+	case r.Multi != nil:
+		r.Multi.Provider = name
+	case r.QA != nil:
+		r.QA.Provider = name
+	case r.Extract != nil:
+		r.Extract.Provider = name
+	}
+}
+
+func (r *Result) MarshalJSON() ([]byte, error) {
+	switch {
+	case r.Simple != nil:
+		return json.Marshal(r.Simple)
+	case r.Structured != nil:
+		return json.Marshal(r.Structured)
+	case r.Multi != nil:
+		return json.Marshal(r.Multi)
+	case r.QA != nil:
+		return json.Marshal(r.QA)
+	case r.Extract != nil:
+		return json.Marshal(r.Extract)
+	}
+	return []byte("null"), nil
+}
+
+// DecodeResult parses and validates a mode's JSON response
+func DecodeResult(mode string, data []byte) (*Result, error) {
+	result := &Result{}
+	var target interface{ Validate() error }
+
+	switch mode {
+	case "simple", "extractive":
+		result.Simple = &SummaryResponse{}
+		target = result.Simple
+	case "structured":
+		result.Structured = &StructuredResponse{}
+		target = result.Structured
+	case "multi":
+		result.Multi = &MultiResponse{}
+		target = result.Multi
+	case "qa":
+		result.QA = &QAResponse{}
+		target = result.QA
+	case "extract":
+		result.Extract = &ExtractResponse{}
+		target = result.Extract
+	default:
+		return nil, Permanent(CodeInvalidFile, "unsupported mode %q", mode)
+	}
+
+	if err := decodeInto(mode, data, target); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeInto unmarshals data into target and validates it
+func decodeInto(what string, data []byte, target interface{ Validate() error }) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(target); err != nil {
+		return schemaError(what, err.Error())
+	}
+	return target.Validate()
+}
+
+// schemaError reports a reply that does not decode or validate. It is
+// retryable: the next reply of the model may well be fine.
+func schemaError(what, problem string) *Error {
+	return Transient(CodeSchemaMismatch, "invalid %s response: %s", what, problem)
+}
+
+// validated returns resp, or the zero value and its schema error
+func validated[T interface{ Validate() error }](resp T) (T, error) {
+	if err := resp.Validate(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return resp, nil
+}
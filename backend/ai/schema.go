@@ -0,0 +1,331 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema - The subset of JSON Schema used by extract mode: type, properties,
+// required, additionalProperties, items, minItems/maxItems, enum, pattern,
+// minimum/maximum and the date / date-time formats. Annotations (title,
+// description, examples, ...) are accepted; composition keywords ($ref,
+// oneOf, ...) are rejected when the schema is parsed.
+type Schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+	source  string // Compact JSON of a top-level schema, as given
+}
+
+// maxSchemaBytes bounds the schema a job may carry; it is sent with every call
+const maxSchemaBytes = 16 * 1024
+
+var schemaKeywords = map[string]bool{
+	"type": true, "description": true, "properties": true, "required": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"enum": true, "pattern": true, "minimum": true, "maximum": true, "format": true,
+
+	// Annotations: accepted and ignored
+	"$schema": true, "$id": true, "$comment": true, "title": true, "examples": true, "default": true,
+}
+
+var schemaTypeNames = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// schemaTypes - "type" as a single name or a list of names
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("schema must be a JSON object")
+	}
+	for key := range keys {
+		if !schemaKeywords[key] {
+			return fmt.Errorf("unsupported schema keyword %q", key)
+		}
+	}
+
+	type plain Schema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// ParseSchema parses and checks an extract-mode schema. The top level must be an object.
+func ParseSchema(data []byte) (*Schema, error) {
+	if len(data) > maxSchemaBytes {
+		return nil, fmt.Errorf("schema is larger than %d KB", maxSchemaBytes/1024)
+	}
+
+	schema := &Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	if !schema.allows("object") || len(schema.Type) != 1 {
+		return nil, fmt.Errorf(`top-level schema must have "type": "object"`)
+	}
+	if len(schema.Properties) == 0 {
+		return nil, fmt.Errorf("top-level schema must define properties")
+	}
+	if err := schema.check("$"); err != nil {
+		return nil, err
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	schema.source = compact.String()
+	return schema, nil
+}
+
+// check verifies the keywords of s and its subschemas, compiling patterns
+func (s *Schema) check(path string) error {
+	if len(s.Type) == 0 {
+		return fmt.Errorf("%s: type is required", path)
+	}
+	for _, name := range s.Type {
+		if !schemaTypeNames[name] {
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+
+	for _, name := range s.Required {
+		if s.Properties[name] == nil {
+			return fmt.Errorf("%s: required property %q is not defined", path, name)
+		}
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: schema is empty", path, name)
+		}
+		if err := property.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+
+	if s.allows("array") {
+		if s.Items == nil {
+			return fmt.Errorf("%s: arrays must define items", path)
+		}
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", path, err)
+		}
+		s.pattern = pattern
+	}
+	return nil
+}
+
+// String returns the schema as it was given, for prompts
+func (s *Schema) String() string {
+	if s.source != "" {
+		return s.source
+	}
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Validate checks a JSON document against the schema and lists every
+// violation as "<path>: <problem>". With partial set, missing required
+// properties are allowed; they may be found in another part of the document.
+func (s *Schema) Validate(data []byte, partial bool) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("$: not valid JSON: %v", err)}
+	}
+
+	var violations []string
+	s.validate("$", value, partial, &violations)
+	return violations
+}
+
+func (s *Schema) validate(path string, value interface{}, partial bool, violations *[]string) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	kind := jsonKind(value)
+	if !s.allows(kind) && !(kind == "integer" && s.allows("number")) {
+		add("expected %s, got %s", strings.Join(s.Type, " or "), kind)
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		add("must be one of %s", enumList(s.Enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if !partial {
+			for _, name := range s.Required {
+				if _, ok := v[name]; !ok {
+					add("missing required property %q", name)
+				}
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			property, ok := s.Properties[name]
+			switch {
+			case ok:
+				property.validate(path+"."+name, v[name], partial, violations)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				add("property %q is not allowed", name)
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems && !partial {
+			add("needs at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("allows at most %d items", *s.MaxItems)
+		}
+		for i, item := range v {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, partial, violations)
+		}
+
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("does not match pattern %s", s.Pattern)
+		}
+		switch s.Format {
+		case "date":
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				add("must be a date (YYYY-MM-DD)")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				add("must be an RFC 3339 date-time")
+			}
+		}
+
+	case json.Number:
+		number, _ := v.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			add("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			add("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+// allows reports whether the schema accepts the named type
+func (s *Schema) allows(name string) bool {
+	for _, t := range s.Type {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mainType is the first non-null type of s
+func (s *Schema) mainType() string {
+	for _, t := range s.Type {
+		if t != "null" {
+			return t
+		}
+	}
+	return "null"
+}
+
+// jsonKind names the JSON Schema type of a value decoded with UseNumber
+func jsonKind(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if number, err := v.Float64(); err == nil && number == math.Trunc(number) && !strings.ContainsAny(v.String(), ".eE") {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	encoded, _ := json.Marshal(value)
+	for _, option := range enum {
+		candidate, _ := json.Marshal(option)
+		if bytes.Equal(candidate, encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	options := make([]string, len(enum))
+	for i, option := range enum {
+		encoded, _ := json.Marshal(option)
+		options[i] = string(encoded)
+	}
+	return strings.Join(options, ", ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
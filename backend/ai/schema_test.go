@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string // substring of the error, "" = valid
+	}{
+		{"object", `{"type": "object", "properties": {"name": {"type": "string"}}}`, ""},
+		{"annotations accepted", `{"$schema": "x", "title": "T", "type": "object", "properties": {"n": {"type": "integer", "examples": [1]}}}`, ""},
+		{"nullable property", `{"type": "object", "properties": {"n": {"type": ["string", "null"]}}}`, ""},
+		{"not JSON", `{"type": `, "unexpected end"},
+		{"not an object", `[]`, "schema must be a JSON object"},
+		{"top level not object", `{"type": "array", "items": {"type": "string"}}`, `"type": "object"`},
+		{"top level type list", `{"type": ["object", "null"], "properties": {"n": {"type": "string"}}}`, `"type": "object"`},
+		{"no properties", `{"type": "object"}`, "must define properties"},
+		{"unsupported keyword", `{"type": "object", "properties": {"n": {"$ref": "#/x"}}}`, `unsupported schema keyword "$ref"`},
+		{"unknown type", `{"type": "object", "properties": {"n": {"type": "text"}}}`, `$.n: unknown type "text"`},
+		{"missing type", `{"type": "object", "properties": {"n": {}}}`, "$.n: type is required"},
+		{"undefined required", `{"type": "object", "properties": {"n": {"type": "string"}}, "required": ["m"]}`, `required property "m" is not defined`},
+		{"array without items", `{"type": "object", "properties": {"n": {"type": "array"}}}`, "$.n: arrays must define items"},
+		{"bad pattern", `{"type": "object", "properties": {"n": {"type": "string", "pattern": "("}}}`, "$.n: invalid pattern"},
+		{"too large", `{"type": "object", "properties": {"n": {"type": "string", "description": "` + strings.Repeat("x", maxSchemaBytes) + `"}}}`, "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := ParseSchema([]byte(tt.schema))
+			if tt.wantErr == "" {
+				if err != nil || schema == nil {
+					t.Fatalf("ParseSchema: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSchema error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaString(t *testing.T) {
+	schema, err := ParseSchema([]byte("{\n  \"type\": \"object\",\n  \"properties\": {\"n\": {\"type\": \"string\"}}\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schema.String(), `{"type":"object","properties":{"n":{"type":"string"}}}`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["party", "amount"],
+		"properties": {
+			"party":   {"type": "string", "pattern": "^[A-Z]"},
+			"amount":  {"type": "number", "minimum": 0, "maximum": 1000},
+			"count":   {"type": "integer"},
+			"kind":    {"type": "string", "enum": ["lease", "sale"]},
+			"signed":  {"type": "string", "format": "date"},
+			"at":      {"type": "string", "format": "date-time"},
+			"note":    {"type": ["string", "null"]},
+			"renewal": {"type": "boolean"},
+			"terms":   {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		partial  bool
+		want     []string
+	}{
+		{"valid", `{"party": "Acme", "amount": 12.5, "count": 3, "kind": "lease", "signed": "2024-01-31",
+			"at": "2024-01-31T10:00:00Z", "note": null, "renewal": true, "terms": ["a", "b"]}`, false, nil},
+		{"integer is a number", `{"party": "Acme", "amount": 12}`, false, nil},
+		{"not JSON", `{"party": `, false, []string{"$: not valid JSON: unexpected EOF"}},
+		{"not an object", `[1]`, false, []string{"$: expected object, got array"}},
+		{"missing required", `{"party": "Acme"}`, false, []string{`$: missing required property "amount"`}},
+		{"missing required when partial", `{"party": "Acme"}`, true, nil},
+		{"additional property", `{"party": "Acme", "amount": 1, "extra": 1}`, false, []string{`$: property "extra" is not allowed`}},
+		{"wrong type", `{"party": 5, "amount": "ten"}`, false, []string{"$.amount: expected number, got string", "$.party: expected string, got integer"}},
+		{"not an integer", `{"party": "Acme", "amount": 1, "count": 1.5}`, false, []string{"$.count: expected integer, got number"}},
+		{"out of range", `{"party": "Acme", "amount": -1}`, false, []string{"$.amount: must be at least 0"}},
+		{"above maximum", `{"party": "Acme", "amount": 1001}`, false, []string{"$.amount: must be at most 1000"}},
+		{"pattern", `{"party": "acme", "amount": 1}`, false, []string{"$.party: does not match pattern ^[A-Z]"}},
+		{"enum", `{"party": "Acme", "amount": 1, "kind": "gift"}`, false, []string{`$.kind: must be one of "lease", "sale"`}},
+		{"date", `{"party": "Acme", "amount": 1, "signed": "31/01/2024"}`, false, []string{"$.signed: must be a date (YYYY-MM-DD)"}},
+		{"date-time", `{"party": "Acme", "amount": 1, "at": "2024-01-31"}`, false, []string{"$.at: must be an RFC 3339 date-time"}},
+		{"too few items", `{"party": "Acme", "amount": 1, "terms": []}`, false, []string{"$.terms: needs at least 1 items"}},
+		{"too few items when partial", `{"party": "Acme", "amount": 1, "terms": []}`, true, nil},
+		{"too many items", `{"party": "Acme", "amount": 1, "terms": ["a", "b", "c"]}`, false, []string{"$.terms: allows at most 2 items"}},
+		{"bad item", `{"party": "Acme", "amount": 1, "terms": ["a", 2]}`, false, []string{"$.terms[1]: expected string, got integer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.Validate([]byte(tt.document), tt.partial); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package ai
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/extractive"
+	"strings"
+)
+
+// Length units
+const (
+	UnitWords     = "words"
+	UnitSentences = "sentences"
+)
+
+// Output formats
+const (
+	FormatProse    = "prose"
+	FormatBullets  = "bullets"
+	FormatMarkdown = "markdown"
+)
+
+// Bounds of a requested length, and how far off it a reply may be before it is re-requested
+const (
+	maxLengthWords     = 3000
+	maxLengthSentences = 150
+	maxStyleText       = 100
+	lengthTolerance    = 0.5 // ±50% of the target
+)
+
+// Style - How a summary should be written. Zero fields leave the provider's default.
+type Style struct {
+	Length     int    `json:"length,omitempty"`      // Target length of the main text
+	LengthUnit string `json:"length_unit,omitempty"` // words (default) or sentences
+	Audience   string `json:"audience,omitempty"`    // e.g. "executives", "new hires"
+	Tone       string `json:"tone,omitempty"`        // e.g. "formal", "technical", "friendly"
+	Format     string `json:"format,omitempty"`      // prose, bullets or markdown
+
+	// Feedback on the previous reply, set when it is re-requested
+	Feedback string `json:"-"`
+
+	// The job's prompt template, rendered for the combine step (see WithTemplate)
+	Template string `json:"-"`
+}
+
+// Normalize fills defaults and checks the style for mode
+func (s *Style) Normalize(mode string) error {
+	s.LengthUnit = strings.ToLower(strings.TrimSpace(s.LengthUnit))
+	s.Audience = strings.TrimSpace(s.Audience)
+	s.Tone = strings.TrimSpace(s.Tone)
+	s.Format = strings.ToLower(strings.TrimSpace(s.Format))
+
+	if s.LengthUnit == "" {
+		s.LengthUnit = UnitWords
+	}
+	switch {
+	case s.LengthUnit != UnitWords && s.LengthUnit != UnitSentences:
+		return fmt.Errorf("length_unit must be %s or %s", UnitWords, UnitSentences)
+	case s.Length < 0:
+		return fmt.Errorf("length must be positive")
+	case s.LengthUnit == UnitWords && s.Length > maxLengthWords:
+		return fmt.Errorf("length can be at most %d words", maxLengthWords)
+	case s.LengthUnit == UnitSentences && s.Length > maxLengthSentences:
+		return fmt.Errorf("length can be at most %d sentences", maxLengthSentences)
+	case len(s.Audience) > maxStyleText || len(s.Tone) > maxStyleText:
+		return fmt.Errorf("audience and tone can be at most %d characters", maxStyleText)
+	}
+
+	switch s.Format {
+	case "", FormatProse, FormatBullets, FormatMarkdown:
+	default:
+		return fmt.Errorf("format must be %s, %s or %s", FormatProse, FormatBullets, FormatMarkdown)
+	}
+
+	switch mode {
+	case "simple", "qa":
+	case "structured", "multi":
+		if s.Format != "" {
+			return fmt.Errorf("format is not available in %s mode, which returns JSON", mode)
+		}
+	case "extractive":
+		// Sentences are selected, not written
+		if s.Audience != "" || s.Tone != "" || s.Format != "" {
+			return fmt.Errorf("extractive mode only supports length")
+		}
+	default:
+		return fmt.Errorf("style is not available in %s mode", mode)
+	}
+	return nil
+}
+
+// IsZero reports whether the style asks for nothing
+func (s *Style) IsZero() bool {
+	return s == nil || (s.Length == 0 && s.Audience == "" && s.Tone == "" && s.Format == "" && s.Template == "")
+}
+
+// Instructions renders the style as prompt lines; "" when there is nothing to ask
+func (s *Style) Instructions() string {
+	if s.IsZero() {
+		return ""
+	}
+
+	var lines []string
+	if s.Length > 0 {
+		lines = append(lines, fmt.Sprintf("- Length: about %d %s.", s.Length, s.LengthUnit))
+	}
+	if s.Audience != "" {
+		lines = append(lines, fmt.Sprintf("- Audience: %s. Choose vocabulary and detail for them.", s.Audience))
+	}
+	if s.Tone != "" {
+		lines = append(lines, fmt.Sprintf("- Tone: %s.", s.Tone))
+	}
+	switch s.Format {
+	case FormatProse:
+		lines = append(lines, "- Format: plain prose paragraphs, no lists or headings.")
+	case FormatBullets:
+		lines = append(lines, "- Format: a bulleted list, one point per line starting with \"- \".")
+	case FormatMarkdown:
+		lines = append(lines, "- Format: Markdown with short headings and lists where useful.")
+	}
+	if s.Feedback != "" {
+		lines = append(lines, "- "+s.Feedback)
+	}
+	if s.Template != "" {
+		lines = append(lines, "- Follow the instructions the parts were written with, applied to the whole document:\n"+s.Template)
+	}
+	return "OUTPUT REQUIREMENTS (apply to the summary or answer text):\n" + strings.Join(lines, "\n")
+}
+
+// withStyle appends the style's instructions to prompt
+func withStyle(prompt string, style *Style) string {
+	if instructions := style.Instructions(); instructions != "" {
+		return prompt + "\n\n" + instructions
+	}
+	return prompt
+}
+
+// MeasureLength counts text in the style's length unit
+func (s *Style) MeasureLength(text string) int {
+	if s.LengthUnit == UnitSentences {
+		return len(extractive.Sentences(text))
+	}
+	return len(strings.Fields(text))
+}
+
+// CheckLength returns feedback for re-requesting text when its length is far
+// off the target, "" when it is close enough or no length was asked for
+func (s *Style) CheckLength(text string) string {
+	if s == nil || s.Length == 0 {
+		return ""
+	}
+	actual := s.MeasureLength(text)
+	low := float64(s.Length) * (1 - lengthTolerance)
+	high := float64(s.Length) * (1 + lengthTolerance)
+	if float64(actual) >= low && float64(actual) <= high {
+		return ""
+	}
+	return fmt.Sprintf("Your previous reply was %d %s long, but the target is about %d %s. Rewrite it to that length.",
+		actual, s.LengthUnit, s.Length, s.LengthUnit)
+}
+
+// WithFeedback returns a copy of the style carrying feedback on the previous reply
+func (s *Style) WithFeedback(feedback string) *Style {
+	copied := *s
+	copied.Feedback = feedback
+	return &copied
+}
+
+// extractiveSelect picks the best sentences to fit the style's length
+// (n sentences by default), returned in document order
+func extractiveSelect(sentences []string, n int, query string, style *Style) []string {
+	if style == nil || style.Length == 0 {
+		return extractive.Summarize(sentences, n, query)
+	}
+	if style.LengthUnit == UnitSentences {
+		return extractive.Summarize(sentences, style.Length, query)
+	}
+
+	// Take sentences best-first until the word budget is reached
+	ranked := extractive.TopIndices(sentences, len(sentences), query)
+	words, count := 0, 0
+	for _, index := range ranked {
+		if words >= style.Length {
+			break
+		}
+		words += len(strings.Fields(sentences[index]))
+		count++
+	}
+	return extractive.Summarize(sentences, max(count, 1), query)
+}
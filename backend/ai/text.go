@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/extractive"
+	"pdf-summarizer-backend/utils"
+	"strings"
+)
+
+// maxInputChars bounds the document text sent in one prompt; jobs are already
+// split into page-range chunks, so this only trims unusually dense pages
+const maxInputChars = 60000
+
+// extractText returns the text of the requested pages of file
+func extractText(file File, pages string) (string, error) {
+	extracted, err := extractPages(file, pages)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, len(extracted))
+	for i, page := range extracted {
+		texts[i] = page.Text
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// filePages returns the requested pages of file: the text the backend sent,
+// or else the pages read from the PDF itself
+func filePages(file File, pages string) ([]Page, error) {
+	if file.Pages != nil {
+		return file.Pages, nil
+	}
+
+	all, err := utils.ExtractPDFPages(file.Data)
+	if err != nil {
+		return nil, Permanent(CodeInvalidPDF, "%v", err)
+	}
+	var result []Page
+	for _, number := range utils.ParsePageRange(pages, len(all)) {
+		if number >= 1 && number <= len(all) {
+			result = append(result, Page{Number: number, Text: all[number-1]})
+		}
+	}
+	return result, nil
+}
+
+// extractPages returns the requested pages of file that have text, in
+// order, cut off once they reach maxInputChars
+func extractPages(file File, pages string) ([]Page, error) {
+	requested, err := filePages(file, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Page
+	chars := 0
+	for _, page := range requested {
+		text := strings.TrimSpace(page.Text)
+		if runes := []rune(text); chars+len(runes) > maxInputChars {
+			text = string(runes[:max(0, maxInputChars-chars)])
+		}
+		if text != "" {
+			result = append(result, Page{Number: page.Number, Text: text})
+			chars += len([]rune(text))
+		}
+		if chars >= maxInputChars {
+			break
+		}
+	}
+	if len(result) == 0 {
+		return nil, Permanent(CodeNoText, "could not extract text from %s", file.Name)
+	}
+	return result, nil
+}
+
+// extractLabeledText returns the requested pages of file, each under a
+// "[Page N]" line, for prompts that ask for page citations
+func extractLabeledText(file File, pages string) (string, error) {
+	extracted, err := extractPages(file, pages)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, page := range extracted {
+		fmt.Fprintf(&sb, "[Page %d]\n%s\n\n", page.Number, page.Text)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// firstFile returns the single document of a non-multi request
+func firstFile(req Request) (File, error) {
+	if len(req.Files) == 0 {
+		return File{}, Permanent(CodeFileNotFound, "no document in request")
+	}
+	return req.Files[0], nil
+}
+
+// targetLanguage is the language instruction used in prompts
+func targetLanguage(language string) string {
+	if strings.TrimSpace(language) == "" {
+		return "the same language as the document"
+	}
+	return strings.ToUpper(language[:1]) + strings.ToLower(language[1:])
+}
+
+// splitSentences breaks text into trimmed sentences on ., ! and ?
+func splitSentences(text string) []string {
+	return extractive.Sentences(text)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/queue"
+	"pdf-summarizer-backend/storage"
+)
+
+// Options - Which shared dependencies a binary needs
+type Options struct {
+	Migrate bool // Run database migrations on startup
+	Storage bool // Initialize MinIO
+	Queue   bool // Connect to RabbitMQ
+}
+
+// Bootstrap loads configuration and connects the shared dependencies.
+// Every binary (api, worker, audit-worker, all-in-one) starts here.
+func Bootstrap(opts Options) {
+	// Load configuration
+	config.LoadConfig()
+
+	// Register AI providers
+	ai.Init()
+
+	// Connect to database
+	database.Connect()
+
+	// Run migrations
+	if opts.Migrate {
+		database.Migrate()
+	}
+
+	// Initialize MinIO
+	if opts.Storage {
+		if err := storage.InitMinio(); err != nil {
+			log.Fatal("Failed to initialize MinIO:", err)
+		}
+	}
+
+	// Connect to RabbitMQ
+	if opts.Queue {
+		if err := queue.Connect(); err != nil {
+			log.Fatal("Failed to connect to RabbitMQ:", err)
+		}
+	}
+}
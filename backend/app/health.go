@@ -0,0 +1,69 @@
+package app
+
+import (
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/queue"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HealthHandler reports process role and dependency status
+func HealthHandler(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		checks := fiber.Map{}
+		healthy := true
+
+		// Database
+		if sqlDB, err := database.DB.DB(); err != nil || sqlDB.Ping() != nil {
+			checks["database"] = "down"
+			healthy = false
+		} else {
+			checks["database"] = "ok"
+		}
+
+		// RabbitMQ (only when this process uses it)
+		if queue.Connection != nil {
+			if queue.Connection.IsClosed() {
+				checks["rabbitmq"] = "down"
+				healthy = false
+			} else {
+				checks["rabbitmq"] = "ok"
+			}
+		}
+
+		// AI circuit breakers (informational: an open circuit pauses jobs, it doesn't make this process unhealthy)
+		checks["ai_circuits"] = ai.BreakerStates()
+
+		status := "ok"
+		code := fiber.StatusOK
+		if !healthy {
+			status = "degraded"
+			code = fiber.StatusServiceUnavailable
+		}
+
+		return c.Status(code).JSON(fiber.Map{
+			"status":  status,
+			"role":    role,
+			"checks":  checks,
+			"message": "PDF Summarizer " + role + " is running",
+		})
+	}
+}
+
+// ServeHealth exposes GET /health on addr for processes without an API
+func ServeHealth(addr, role string) {
+	server := fiber.New(fiber.Config{
+		AppName:               "PDF Summarizer " + role,
+		DisableStartupMessage: true,
+	})
+	server.Get("/health", HealthHandler(role))
+
+	go func() {
+		log.Printf("🩺 Health endpoint for %s on %s/health", role, addr)
+		if err := server.Listen(addr); err != nil {
+			log.Printf("Health endpoint stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/handlers"
+	"pdf-summarizer-backend/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// NewServer builds the HTTP API with all middleware and routes
+func NewServer() *fiber.App {
+	// Setup Fiber app
+	app := fiber.New(fiber.Config{
+		AppName:   "PDF Summarizer API",
+		BodyLimit: int(config.AppConfig.MaxFileSize) + 1024*1024, // Max file size + 1MB buffer
+
+		// c.IP() is the client's address as set by nginx, not the proxy's,
+		// so anonymous clients get rate limits of their own
+		ProxyHeader:             config.AppConfig.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          config.AppConfig.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+
+	// Middleware
+	app.Use(recover.New())
+	app.Use(logger.New())
+	app.Use(middleware.AuditMiddleware()) // Audit logging
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,Idempotency-Key,X-API-Key",
+		ExposeHeaders: "Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,Idempotent-Replayed",
+	}))
+
+	// Health check
+	app.Get("/health", HealthHandler("API"))
+
+	// API routes
+	api := app.Group("/api", middleware.RateLimitMiddleware(config.AppConfig.RateLimitDefault))
+
+	// PDF management routes
+	pdfs := api.Group("/pdfs")
+	pdfs.Post("/upload", middleware.RateLimitMiddleware(config.AppConfig.RateLimitUpload), middleware.IdempotencyMiddleware(), handlers.UploadPDF)
+	pdfs.Get("/", handlers.ListPDFs)
+	pdfs.Get("/:id", handlers.GetPDF)
+	pdfs.Delete("/:id", handlers.DeletePDF)
+	pdfs.Get("/stats/count", handlers.GetPDFStats)
+	pdfs.Get("/:id/pages", handlers.ListPDFPages) // Extracted text with char and word counts
+	pdfs.Post("/:id/embed", handlers.EmbedPDF)    // Re-embed passages for corpus questions
+
+	// PDF Summarization routes (Async with RabbitMQ Queue)
+	pdfs.Post("/:id/summarize", middleware.RateLimitMiddleware(config.AppConfig.RateLimitSummarize), middleware.IdempotencyMiddleware(), handlers.CreateSummarizationJob) // Async (default)
+	pdfs.Get("/:id/summaries", handlers.ListSummaries)
+
+	// Multi-turn QA threads (answered synchronously)
+	pdfs.Post("/:id/threads", handlers.CreateThread)
+	pdfs.Get("/:id/threads", handlers.ListThreads)
+	threads := api.Group("/threads")
+	threads.Get("/:threadId", handlers.GetThread) // Thread with all messages
+	threads.Delete("/:threadId", handlers.DeleteThread)
+	threads.Post("/:threadId/messages", middleware.RateLimitMiddleware(config.AppConfig.RateLimitSummarize), handlers.CreateThreadMessage) // Ask a follow-up question
+	threads.Get("/:threadId/messages", handlers.ListThreadMessages)
+
+	// Full-text search over page text, summaries and thread answers
+	api.Get("/search", handlers.Search) // ?q=&type=&mode=&language=&pdf_id=&from=&to=
+
+	// Document tags: people, organizations, dates, topics and keywords
+	pdfs.Get("/:id/tags", handlers.ListPDFTags) // ?kind=
+	pdfs.Post("/:id/tags", handlers.CreatePDFTag)
+	pdfs.Post("/:id/tags/extract", handlers.ExtractPDFTags) // Replace the extracted tags now
+	pdfs.Put("/:id/tags/:tagId", handlers.UpdatePDFTag)
+	pdfs.Delete("/:id/tags/:tagId", handlers.DeletePDFTag) // Not extracted again
+	api.Get("/tags", handlers.ListTags)                    // Tags in use with document counts
+
+	// Collections of documents, summarized across their members
+	pdfs.Get("/:id/collections", handlers.ListPDFCollections)
+	collections := api.Group("/collections")
+	collections.Post("/", handlers.CreateCollection)
+	collections.Get("/", handlers.ListCollections) // ?q=&pdf_id=
+	collections.Get("/:collectionId", handlers.GetCollection)
+	collections.Put("/:collectionId", handlers.UpdateCollection)
+	collections.Delete("/:collectionId", handlers.DeleteCollection) // Documents are kept
+	collections.Post("/:collectionId/members", handlers.AddCollectionMembers)
+	collections.Delete("/:collectionId/members/:pdfId", handlers.RemoveCollectionMember)
+	collections.Post("/:collectionId/summarize", middleware.RateLimitMiddleware(config.AppConfig.RateLimitSummarize), handlers.SummarizeCollection)
+	collections.Get("/:collectionId/summaries", handlers.ListCollectionSummaries)
+	collections.Get("/:collectionId/summaries/:summaryId", handlers.GetCollectionSummary)
+
+	// Questions across all documents, answered from the most similar passages
+	ask := api.Group("/ask")
+	ask.Post("/", middleware.RateLimitMiddleware(config.AppConfig.RateLimitSummarize), handlers.AskCorpus)
+	ask.Get("/", handlers.ListCorpusQuestions)
+	ask.Get("/:questionId", handlers.GetCorpusQuestion) // Answer with its retrieval set
+
+	// Summary routes
+	summaries := api.Group("/summaries")
+	summaries.Get("/", handlers.GetAllSummaries)
+	summaries.Get("/:summaryId", handlers.GetSummary)
+	summaries.Delete("/:summaryId", handlers.DeleteSummary)
+	summaries.Post("/:summaryId/translate", handlers.TranslateSummary)   // Translation job, no PDF re-read
+	summaries.Get("/:summaryId/translations", handlers.ListTranslations) // Translations of this summary
+
+	// Job Queue routes
+	jobs := api.Group("/jobs")
+	jobs.Get("/", handlers.ListJobs)                   // List all jobs with filters
+	jobs.Get("/:jobId", handlers.GetJob)               // Get job status
+	jobs.Get("/:jobId/chunks", handlers.ListJobChunks) // Per-chunk progress and cost
+	jobs.Get("/:jobId/stream", handlers.StreamJob)     // Generated text as Server-Sent Events
+	jobs.Post("/:jobId/retry", handlers.RetryJob)      // Retry failed job
+	jobs.Delete("/:jobId", handlers.DeleteJob)         // Delete job
+
+	// Prompt template routes
+	templates := api.Group("/templates")
+	templates.Post("/", handlers.CreatePromptTemplate)
+	templates.Get("/", handlers.ListPromptTemplates)
+	templates.Get("/:templateId", handlers.GetPromptTemplate)
+	templates.Get("/:templateId/versions", handlers.ListPromptTemplateVersions) // Every version, newest first
+	templates.Put("/:templateId", handlers.UpdatePromptTemplate)                // New version if the text changes
+	templates.Delete("/:templateId", handlers.DeletePromptTemplate)
+
+	// AI cost routes (?from=YYYY-MM-DD&to=YYYY-MM-DD)
+	costs := api.Group("/costs")
+	costs.Get("/daily", handlers.GetCostsByDay)
+	costs.Get("/modes", handlers.GetCostsByMode)
+	costs.Get("/documents", handlers.GetCostsByDocument)
+
+	// Audit Log routes
+	audit := api.Group("/audit")
+	audit.Get("/logs", handlers.ListAuditLogs)                 // List audit logs
+	audit.Get("/stats", handlers.GetAuditStats)                // Get statistics
+	audit.Delete("/logs/cleanup", handlers.DeleteOldAuditLogs) // Cleanup old logs
+
+	// Test routes removed - not needed for production
+
+	return app
+}
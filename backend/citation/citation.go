@@ -0,0 +1,277 @@
+// Package citation parses the page markers AI providers put after summary
+// statements, e.g. "Payment is due within 30 days. [p. 4]", and checks each
+// statement against the text of the pages it cites.
+package citation
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minSupport is the share of a statement's words that must appear on its cited pages
+	minSupport = 0.5
+
+	// maxRangePages bounds a cited page range such as "[pp. 3-7]"
+	maxRangePages = 20
+)
+
+// Citation - One statement and the pages it cites
+type Citation struct {
+	Text      string  `json:"text"`
+	Pages     []int   `json:"pages"`
+	Supported bool    `json:"supported"`
+	Score     float64 `json:"score"`               // Share of the statement's words found on the cited pages
+	BestPage  int     `json:"best_page,omitempty"` // Uncited page that supports an unsupported statement
+	Reason    string  `json:"reason,omitempty"`    // Why the statement is unsupported
+}
+
+// Report - The citations of one summary, by field
+type Report struct {
+	Bullets     []Citation `json:"bullets,omitempty"`
+	Highlights  []Citation `json:"highlights,omitempty"`
+	Answer      []Citation `json:"answer,omitempty"` // One per sentence
+	Verified    bool       `json:"verified"`         // Checked against the page text
+	Unsupported int        `json:"unsupported"`      // Statements flagged by Verify
+}
+
+// markerPattern matches "[p. 4]", "[pp. 3-5, 7]", "[page 2]" or "[pages 2 and 3]"
+var markerPattern = regexp.MustCompile(`(?i)\[\s*(?:pp?\.?|pages?)\s*(\d+(?:\s*(?:[-–,]|and)\s*\d+)*)\s*\]`)
+
+// spaceBeforePunct matches the gap a removed marker leaves before punctuation
+var spaceBeforePunct = regexp.MustCompile(`[ \t]+([.,;:!?])`)
+
+// Marker renders the marker citing pages, e.g. "[p. 4]" or "[pp. 3, 5]"
+func Marker(pages ...int) string {
+	pages = unique(append([]int(nil), pages...))
+	if len(pages) == 1 {
+		return fmt.Sprintf("[p. %d]", pages[0])
+	}
+	numbers := make([]string, len(pages))
+	for i, page := range pages {
+		numbers[i] = strconv.Itoa(page)
+	}
+	return fmt.Sprintf("[pp. %s]", strings.Join(numbers, ", "))
+}
+
+// Strip removes the markers from text, keeping its line breaks, and returns
+// the pages they cite
+func Strip(text string) (string, []int) {
+	var pages []int
+	for _, match := range markerPattern.FindAllStringSubmatch(text, -1) {
+		pages = append(pages, parsePages(match[1])...)
+	}
+	text = markerPattern.ReplaceAllString(text, "")
+	text = spaceBeforePunct.ReplaceAllString(text, "$1")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), unique(pages)
+}
+
+// Statement parses one bullet or highlight
+func Statement(text string) Citation {
+	clean, pages := Strip(text)
+	return Citation{Text: clean, Pages: pages}
+}
+
+// Sentences splits text into sentences, each with the pages cited in it or
+// right after it. A marker following the full stop ("... days. [p. 4]")
+// belongs to the sentence before it.
+func Sentences(text string) []Citation {
+	var (
+		result  []Citation
+		current strings.Builder
+		pages   []int
+	)
+	flush := func() {
+		sentence, _ := Strip(current.String())
+		sentence = strings.Join(strings.Fields(sentence), " ")
+		switch {
+		case sentence != "":
+			result = append(result, Citation{Text: sentence, Pages: unique(pages)})
+		case len(pages) > 0 && len(result) > 0:
+			last := &result[len(result)-1]
+			last.Pages = unique(append(last.Pages, pages...))
+		}
+		current.Reset()
+		pages = nil
+	}
+
+	pos := 0
+	for _, match := range append(markerPattern.FindAllStringSubmatchIndex(text, -1), []int{len(text), len(text)}) {
+		runes := []rune(text[pos:match[0]])
+		for i, r := range runes {
+			current.WriteRune(r)
+			switch {
+			case r == '\n':
+				flush()
+			case strings.ContainsRune(".!?", r) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])):
+				flush()
+			}
+		}
+		if match[0] == len(text) {
+			break
+		}
+
+		// A marker right after a flushed sentence end attaches to that sentence
+		pages = append(pages, parsePages(text[match[2]:match[3]])...)
+		if strings.TrimSpace(current.String()) == "" {
+			flush()
+		}
+		pos = match[1]
+	}
+	flush()
+	return result
+}
+
+// Verify checks every citation against pages, the text of each page of the
+// document in order, and counts the unsupported ones
+func (r *Report) Verify(pages []string) {
+	pageTerms := make([]map[string]bool, len(pages))
+	for i, page := range pages {
+		pageTerms[i] = make(map[string]bool)
+		for _, term := range terms(page) {
+			pageTerms[i][term] = true
+		}
+	}
+
+	r.Unsupported = 0
+	for _, list := range [][]Citation{r.Bullets, r.Highlights, r.Answer} {
+		for i := range list {
+			list[i].verify(pageTerms)
+			if !list[i].Supported {
+				r.Unsupported++
+			}
+		}
+	}
+	r.Verified = true
+}
+
+func (c *Citation) verify(pageTerms []map[string]bool) {
+	c.Supported, c.Score, c.BestPage, c.Reason = false, 0, 0, ""
+	words := terms(c.Text)
+
+	cited := make(map[string]bool)
+	var missing []string
+	for _, page := range c.Pages {
+		if page < 1 || page > len(pageTerms) {
+			missing = append(missing, strconv.Itoa(page))
+			continue
+		}
+		for term := range pageTerms[page-1] {
+			cited[term] = true
+		}
+	}
+	c.Score = coverage(words, cited)
+
+	switch {
+	case len(c.Pages) == 0:
+		c.Reason = "no page cited"
+	case len(missing) > 0:
+		c.Reason = fmt.Sprintf("page %s not in the document", strings.Join(missing, ", "))
+	case c.Score < minSupport:
+		c.Reason = "not found on the cited pages"
+	default:
+		c.Supported = true
+		return
+	}
+
+	// Point reviewers at the page that does support it, if any
+	best := 0.0
+	for i, page := range pageTerms {
+		if score := coverage(words, page); score >= minSupport && score > best && !containsPage(c.Pages, i+1) {
+			best, c.BestPage = score, i+1
+		}
+	}
+}
+
+// coverage is the share of words found in terms, rounded to two decimals;
+// a statement with no checkable words is fully covered
+func coverage(words []string, terms map[string]bool) float64 {
+	if len(words) == 0 {
+		return 1
+	}
+	found := 0
+	for _, word := range words {
+		if terms[word] {
+			found++
+		}
+	}
+	return math.Round(float64(found)/float64(len(words))*100) / 100
+}
+
+// stopwords are left out of the comparison; they appear on every page
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "were": true, "with": true,
+	"that": true, "this": true, "these": true, "those": true, "from": true, "has": true, "have": true,
+	"had": true, "not": true, "but": true, "its": true, "their": true, "they": true, "which": true,
+	"will": true, "shall": true, "been": true, "also": true, "than": true, "into": true, "all": true,
+	"any": true, "can": true, "may": true, "must": true, "such": true, "other": true, "document": true,
+}
+
+// terms lowercases text and returns its words of three or more letters and
+// its numbers, without stopwords
+func terms(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		hasDigit := strings.IndexFunc(word, unicode.IsDigit) >= 0
+		if (len([]rune(word)) >= 3 || hasDigit) && !stopwords[word] {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// parsePages expands the numbers of a marker, e.g. "3-5, 7"
+func parsePages(spec string) []int {
+	var pages []int
+	spec = strings.NewReplacer("–", "-", "and", ",").Replace(strings.ToLower(spec))
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || end < start {
+				end = start
+			}
+		}
+		for page := start; page <= min(end, start+maxRangePages-1); page++ {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// unique sorts pages and drops duplicates; never nil, so JSON shows []
+func unique(pages []int) []int {
+	sort.Ints(pages)
+	result := []int{}
+	for i, page := range pages {
+		if i == 0 || page != pages[i-1] {
+			result = append(result, page)
+		}
+	}
+	return result
+}
+
+func containsPage(pages []int, page int) bool {
+	for _, p := range pages {
+		if p == page {
+			return true
+		}
+	}
+	return false
+}
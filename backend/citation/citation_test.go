@@ -0,0 +1,127 @@
+package citation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarker(t *testing.T) {
+	tests := []struct {
+		pages []int
+		want  string
+	}{
+		{[]int{4}, "[p. 4]"},
+		{[]int{5, 3}, "[pp. 3, 5]"},
+		{[]int{2, 2}, "[p. 2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := Marker(tt.pages...); got != tt.want {
+				t.Errorf("Marker(%v) = %q, want %q", tt.pages, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantText  string
+		wantPages []int
+	}{
+		{"no marker", "Rent is due monthly.", "Rent is due monthly.", []int{}},
+		{"after full stop", "Rent is due monthly. [p. 4]", "Rent is due monthly.", []int{4}},
+		{"before full stop", "Rent is due monthly [p. 4].", "Rent is due monthly.", []int{4}},
+		{"range and list", "Rent is due [pp. 3-5, 7].", "Rent is due.", []int{3, 4, 5, 7}},
+		{"spelled out", "Rent is due [pages 2 and 3]; notice too [Page 2].", "Rent is due; notice too.", []int{2, 3}},
+		{"en dash", "Rent is due [pp. 3–4].", "Rent is due.", []int{3, 4}},
+		{"range capped", "Rent is due [pp. 1-100].", "Rent is due.", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{"reversed range", "Rent is due [pp. 5-3].", "Rent is due.", []int{5}},
+		{"line breaks kept", "- Rent is due [p. 1]\n- Notice is 3 months [p. 2]", "- Rent is due\n- Notice is 3 months", []int{1, 2}},
+		{"not a marker", "See [1] and [note].", "See [1] and [note].", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, pages := Strip(tt.text)
+			if text != tt.wantText || !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("Strip(%q) = %q, %v, want %q, %v", tt.text, text, pages, tt.wantText, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Citation
+	}{
+		{"empty", "", nil},
+		{"marker after full stop", "Payment is due within 30 days. [p. 4] Rent is 100 euros [pp. 2-3].", []Citation{
+			{Text: "Payment is due within 30 days.", Pages: []int{4}},
+			{Text: "Rent is 100 euros.", Pages: []int{2, 3}},
+		}},
+		{"uncited sentence", "Rent is due. Notice is 3 months [p. 2].", []Citation{
+			{Text: "Rent is due.", Pages: []int{}},
+			{Text: "Notice is 3 months.", Pages: []int{2}},
+		}},
+		{"line breaks", "Rent is due [p. 1]\nNotice is 3 months", []Citation{
+			{Text: "Rent is due", Pages: []int{1}},
+			{Text: "Notice is 3 months", Pages: []int{}},
+		}},
+		{"decimal kept", "The rate is 4.5 percent. [p. 1]", []Citation{
+			{Text: "The rate is 4.5 percent.", Pages: []int{1}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sentences(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	pages := []string{
+		"The tenant pays a monthly rent of 100 euros to the landlord.",
+		"Either party may terminate the lease with three months notice.",
+	}
+
+	tests := []struct {
+		name      string
+		statement string
+		want      Citation
+	}{
+		{"supported", "Monthly rent is 100 euros [p. 1].",
+			Citation{Text: "Monthly rent is 100 euros.", Pages: []int{1}, Supported: true, Score: 1}},
+		{"wrong page", "Monthly rent is 100 euros [p. 2].",
+			Citation{Text: "Monthly rent is 100 euros.", Pages: []int{2}, Score: 0, BestPage: 1, Reason: "not found on the cited pages"}},
+		{"page outside document", "Notice is three months [p. 9].",
+			Citation{Text: "Notice is three months.", Pages: []int{9}, Score: 0, BestPage: 2, Reason: "page 9 not in the document"}},
+		{"no page", "Notice is three months.",
+			Citation{Text: "Notice is three months.", Pages: []int{}, Score: 0, BestPage: 2, Reason: "no page cited"}},
+		{"found nowhere", "The flat has a balcony [p. 1].",
+			Citation{Text: "The flat has a balcony.", Pages: []int{1}, Score: 0, Reason: "not found on the cited pages"}},
+		{"partly found", "Monthly rent includes heating [p. 1].",
+			Citation{Text: "Monthly rent includes heating.", Pages: []int{1}, Score: 0.5, Supported: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &Report{Bullets: []Citation{Statement(tt.statement)}}
+			report.Verify(pages)
+
+			if got := report.Bullets[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify(%q) = %+v, want %+v", tt.statement, got, tt.want)
+			}
+			wantUnsupported := 0
+			if !tt.want.Supported {
+				wantUnsupported = 1
+			}
+			if !report.Verified || report.Unsupported != wantUnsupported {
+				t.Errorf("report verified %v with %d unsupported, want true with %d", report.Verified, report.Unsupported, wantUnsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"pdf-summarizer-backend/app"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/queue"
+)
+
+// API server only: accepts uploads and publishes jobs, does not consume them
+func main() {
+	port := flag.String("port", "", "HTTP port (overrides PORT)")
+	migrate := flag.Bool("migrate", true, "Run database migrations on startup")
+	flag.Parse()
+
+	app.Bootstrap(app.Options{Migrate: *migrate, Storage: true, Queue: true})
+	defer queue.Close()
+
+	if *port != "" {
+		config.AppConfig.Port = *port
+	}
+
+	server := app.NewServer()
+
+	log.Printf("🚀 API server starting on port %s", config.AppConfig.Port)
+	if err := server.Listen(":" + config.AppConfig.Port); err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+}
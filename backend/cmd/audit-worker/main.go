@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"pdf-summarizer-backend/app"
+	"pdf-summarizer-backend/queue"
+	"pdf-summarizer-backend/worker"
+	"syscall"
+)
+
+// Audit worker only: persists audit logs published by the API
+func main() {
+	healthAddr := flag.String("health-addr", ":8082", "Address for the /health endpoint")
+	migrate := flag.Bool("migrate", false, "Run database migrations on startup")
+	flag.Parse()
+
+	app.Bootstrap(app.Options{Migrate: *migrate, Queue: true})
+	defer queue.Close()
+
+	app.ServeHealth(*healthAddr, "audit-worker")
+	worker.StartAuditWorker()
+
+	log.Printf("📝 Worker: Audit log processor running")
+	waitForShutdown()
+}
+
+func waitForShutdown() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutting down audit worker...")
+}
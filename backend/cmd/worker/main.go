@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"pdf-summarizer-backend/app"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/queue"
+	"pdf-summarizer-backend/worker"
+	"syscall"
+)
+
+// Job worker only: consumes summarization jobs, serves no API
+func main() {
+	concurrency := flag.Int("concurrency", 0, "Jobs processed in parallel (overrides WORKER_CONCURRENCY)")
+	healthAddr := flag.String("health-addr", ":8081", "Address for the /health endpoint")
+	migrate := flag.Bool("migrate", false, "Run database migrations on startup")
+	flag.Parse()
+
+	app.Bootstrap(app.Options{Migrate: *migrate, Storage: true, Queue: true})
+	defer queue.Close()
+
+	if *concurrency > 0 {
+		config.AppConfig.WorkerConcurrency = *concurrency
+	}
+
+	app.ServeHealth(*healthAddr, "worker")
+	go worker.StartWorker()
+
+	log.Printf("🔄 Worker: Job processor running (%d concurrent, fair-share per submitter)", config.AppConfig.WorkerConcurrency)
+	waitForShutdown()
+}
+
+func waitForShutdown() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutting down worker...")
+}
@@ -36,12 +36,28 @@ func Connect() {
 func Migrate() {
 	log.Println("Running database migrations...")
 
-	// Auto-migrate 4 tables: pdf_files, summary_logs, summarization_jobs, audit_logs
+	// Auto-migrate tables: pdf_files, summary_logs, summarization_jobs, job_chunks, job_stream_chunks, prompt_templates, prompt_template_versions, audit_logs, idempotency_keys, qa_threads, qa_messages, pdf_pages, chunk_embeddings, pdf_embeddings, corpus_questions, document_tags, tagging_runs, collections, collection_members, collection_summaries
 	err := DB.AutoMigrate(
 		&models.PDFFile{},
 		&models.SummaryLog{},
 		&models.SummarizationJob{},
+		&models.JobChunk{},
+		&models.JobStreamChunk{},
+		&models.PromptTemplate{},
+		&models.PromptTemplateVersion{},
 		&models.AuditLog{},
+		&models.IdempotencyKey{},
+		&models.QAThread{},
+		&models.QAMessage{},
+		&models.PDFPage{},
+		&models.ChunkEmbedding{},
+		&models.PDFEmbedding{},
+		&models.CorpusQuestion{},
+		&models.DocumentTag{},
+		&models.TaggingRun{},
+		&models.Collection{},
+		&models.CollectionMember{},
+		&models.CollectionSummary{},
 	)
 
 	if err != nil {
@@ -53,6 +69,14 @@ func Migrate() {
 		log.Fatal("Failed to create trigger:", err)
 	}
 
+	// Generated tsvector columns for GET /api/search
+	if err := createSearchIndexes(); err != nil {
+		log.Fatal("Failed to create search indexes:", err)
+	}
+
+	// Optional: rank embeddings with pgvector instead of in Go
+	createVectorColumn()
+
 	log.Println("Database migration completed")
 }
 
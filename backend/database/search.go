@@ -0,0 +1,65 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SearchLanguages - Document languages with their own Postgres text search
+// configuration (stemming and stopwords); any other language is indexed with
+// the "simple" configuration
+var SearchLanguages = []string{
+	"english", "indonesian", "spanish", "french", "german",
+	"portuguese", "italian", "dutch", "russian", "turkish",
+}
+
+// createSearchIndexes adds a generated tsvector column with a GIN index to
+// every searchable table. Each row is indexed with the configuration of its
+// own language, via search_config().
+func createSearchIndexes() error {
+	cases := make([]string, len(SearchLanguages))
+	for i, language := range SearchLanguages {
+		cases[i] = fmt.Sprintf("WHEN '%s' THEN '%s'::regconfig", language, language)
+	}
+
+	configFunction := fmt.Sprintf(`
+	CREATE OR REPLACE FUNCTION search_config(lang TEXT)
+	RETURNS regconfig AS $$
+		SELECT CASE LOWER(COALESCE(lang, ''))
+			%s
+			ELSE 'simple'::regconfig
+		END;
+	$$ LANGUAGE sql IMMUTABLE;
+	`, strings.Join(cases, "\n\t\t\t"))
+
+	if err := DB.Exec(configFunction).Error; err != nil {
+		return err
+	}
+
+	// Summaries weigh their overview above the lists and the question and answer
+	columns := map[string]string{
+		"pdf_pages": `to_tsvector(search_config(language), text)`,
+		"summary_logs": `
+			setweight(to_tsvector(search_config(language), COALESCE(executive_summary, '') || ' ' || COALESCE(summary_text, '')), 'A') ||
+			setweight(to_tsvector(search_config(language), COALESCE(bullets, '') || ' ' || COALESCE(highlights, '')), 'B') ||
+			setweight(to_tsvector(search_config(language), COALESCE(qa_question, '') || ' ' || COALESCE(qa_answer, '')), 'B')`,
+		"qa_messages": `
+			setweight(to_tsvector(search_config(language), question), 'B') ||
+			setweight(to_tsvector(search_config(language), answer), 'A')`,
+	}
+
+	for table, vector := range columns {
+		column := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (%s) STORED`, table, vector)
+		if err := DB.Exec(column).Error; err != nil {
+			return fmt.Errorf("search column on %s: %w", table, err)
+		}
+		index := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_search ON %s USING GIN (search_vector)`, table, table)
+		if err := DB.Exec(index).Error; err != nil {
+			return fmt.Errorf("search index on %s: %w", table, err)
+		}
+	}
+
+	log.Println("Full-text search indexes ready: pdf_pages, summary_logs, qa_messages")
+	return nil
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"log"
+)
+
+// VectorSearch is true when the pgvector extension is available; chunk
+// embeddings are then ranked in Postgres, otherwise by cosine similarity in Go
+var VectorSearch bool
+
+// createVectorColumn adds a pgvector copy of chunk_embeddings.embedding when
+// the extension is installed. Embedding models differ in dimensions, so the
+// column has none and is scanned exactly, without an approximate index.
+func createVectorColumn() {
+	if err := DB.Exec(`CREATE EXTENSION IF NOT EXISTS vector`).Error; err != nil {
+		log.Printf("pgvector not available, ranking chunk embeddings in Go: %v", err)
+		return
+	}
+
+	column := `ALTER TABLE chunk_embeddings ADD COLUMN IF NOT EXISTS embedding_vector vector GENERATED ALWAYS AS (embedding::vector) STORED`
+	if err := DB.Exec(column).Error; err != nil {
+		log.Printf("pgvector column not created, ranking chunk embeddings in Go: %v", err)
+		return
+	}
+
+	VectorSearch = true
+	log.Println("pgvector enabled: chunk_embeddings.embedding_vector")
+}
@@ -0,0 +1,430 @@
+// Package diff compares the page texts of two versions of a document.
+// Pages are aligned first, so an inserted page does not shift every later
+// change, then the lines of each aligned page pair are diffed. Extracted page
+// text often has few line breaks, so a line here is a sentence or heading of
+// a text line, not the whole text line.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Hunk kinds
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+const (
+	// minPageSimilarity is the share of common words two pages need to be aligned
+	minPageSimilarity = 0.3
+
+	// maxLineCells bounds the line LCS table of one page pair; denser pages are
+	// compared as a whole
+	maxLineCells = 4_000_000
+)
+
+// Hunk - A run of consecutive removed and/or added lines
+type Hunk struct {
+	Kind    string   `json:"kind"`
+	OldPage int      `json:"old_page,omitempty"` // 1-based, 0 = not in the old version
+	NewPage int      `json:"new_page,omitempty"` // 1-based, 0 = not in the new version
+	Section string   `json:"section,omitempty"`  // Nearest heading above the hunk
+	Old     []string `json:"old,omitempty"`
+	New     []string `json:"new,omitempty"`
+}
+
+// Result - The differences between two documents, in document order
+type Result struct {
+	OldPages     int    `json:"old_pages"`
+	NewPages     int    `json:"new_pages"`
+	Hunks        []Hunk `json:"hunks"`
+	AddedLines   int    `json:"added_lines"`
+	RemovedLines int    `json:"removed_lines"`
+}
+
+// Empty reports whether the documents have the same text
+func (r *Result) Empty() bool {
+	return len(r.Hunks) == 0
+}
+
+// Pages diffs two documents given as the text of each page
+func Pages(oldPages, newPages []string) *Result {
+	oldLines := make([][]string, len(oldPages))
+	for i, page := range oldPages {
+		oldLines[i] = lines(page)
+	}
+	newLines := make([][]string, len(newPages))
+	for i, page := range newPages {
+		newLines[i] = lines(page)
+	}
+
+	result := &Result{OldPages: len(oldPages), NewPages: len(newPages), Hunks: []Hunk{}}
+	oldSections := newSectionTracker(oldLines)
+	newSections := newSectionTracker(newLines)
+
+	for _, pair := range alignPages(oldLines, newLines) {
+		var hunks []lineHunk
+		switch {
+		case pair.old < 0:
+			hunks = []lineHunk{{Hunk: Hunk{Kind: Added, New: newLines[pair.new]}}}
+		case pair.new < 0:
+			hunks = []lineHunk{{Hunk: Hunk{Kind: Removed, Old: oldLines[pair.old]}}}
+		default:
+			hunks = diffLines(oldLines[pair.old], newLines[pair.new])
+		}
+
+		for _, hunk := range hunks {
+			if len(hunk.Old) == 0 && len(hunk.New) == 0 {
+				continue
+			}
+			if pair.old >= 0 {
+				hunk.OldPage = pair.old + 1
+			}
+			if pair.new >= 0 {
+				hunk.NewPage = pair.new + 1
+			}
+
+			// Prefer the heading of the new version; removed text only has the old one
+			if pair.new >= 0 {
+				hunk.Section = newSections.at(pair.new, hunk.newLine)
+			}
+			if hunk.Section == "" && pair.old >= 0 {
+				hunk.Section = oldSections.at(pair.old, hunk.oldLine)
+			}
+
+			result.AddedLines += len(hunk.New)
+			result.RemovedLines += len(hunk.Old)
+			result.Hunks = append(result.Hunks, hunk.Hunk)
+		}
+	}
+	return result
+}
+
+// Format renders the differences as text for a prompt, at most maxChars long
+func (r *Result) Format(maxChars int) string {
+	var sb strings.Builder
+	for i, hunk := range r.Hunks {
+		var block strings.Builder
+		fmt.Fprintf(&block, "[%s] %s\n", strings.ToUpper(hunk.Kind), hunk.Location())
+		for _, line := range hunk.Old {
+			fmt.Fprintf(&block, "- %s\n", line)
+		}
+		for _, line := range hunk.New {
+			fmt.Fprintf(&block, "+ %s\n", line)
+		}
+		block.WriteString("\n")
+
+		if sb.Len()+block.Len() > maxChars {
+			fmt.Fprintf(&sb, "[%d more changes not shown]\n", len(r.Hunks)-i)
+			break
+		}
+		sb.WriteString(block.String())
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Location describes where the hunk is, e.g. `section "4.2 Termination", old page 3, new page 4`
+func (h Hunk) Location() string {
+	var parts []string
+	if h.Section != "" {
+		parts = append(parts, fmt.Sprintf("section %q", h.Section))
+	}
+	if h.OldPage > 0 {
+		parts = append(parts, fmt.Sprintf("old page %d", h.OldPage))
+	}
+	if h.NewPage > 0 {
+		parts = append(parts, fmt.Sprintf("new page %d", h.NewPage))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// numberedHeading finds a dotted section number such as "4.2" starting a
+// heading inside a text line, e.g. "1. Definitions 1.1 Lease means"
+var numberedHeading = regexp.MustCompile(`\s\d+(?:\.\d+)+\.?\s+\p{Lu}`)
+
+// numberingOnly matches a sentence that is nothing but the number of the
+// heading after it, e.g. "1." of "1. Definitions"
+var numberingOnly = regexp.MustCompile(`^(?:\d+(?:\.\d+)*|(?i:section|article|clause|chapter|part|schedule|annex|appendix)\s+[\dIVXLC]+|§\s*\d+)\.$`)
+
+// lines splits page text into the lines to diff: every text line with
+// collapsed whitespace, cut into sentences and before headings run into it
+func lines(text string) []string {
+	var result []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		for _, sentence := range sentences(line) {
+			start := 0
+			for _, at := range numberedHeading.FindAllStringIndex(sentence, -1) {
+				result = append(result, sentence[start:at[0]])
+				start = at[0] + 1
+			}
+			result = append(result, sentence[start:])
+		}
+	}
+	return result
+}
+
+// sentences splits a line after ., ! and ? followed by a space, keeping a
+// heading number with the title after it
+func sentences(line string) []string {
+	var result []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '.', '!', '?':
+			if i+1 < len(line) && line[i+1] == ' ' && !numberingOnly.MatchString(line[start:i+1]) {
+				result = append(result, line[start:i+1])
+				start = i + 2
+			}
+		}
+	}
+	if start < len(line) {
+		result = append(result, line[start:])
+	}
+	return result
+}
+
+// pagePair - Aligned page indexes; -1 when the page exists in one version only
+type pagePair struct {
+	old, new int
+}
+
+// alignPages matches similar pages in order (LCS over pages, weighted by
+// similarity); unmatched pages are reported as added or removed
+func alignPages(oldLines, newLines [][]string) []pagePair {
+	n, m := len(oldLines), len(newLines)
+	oldWords := make([]map[string]bool, n)
+	for i := range oldLines {
+		oldWords[i] = wordSet(oldLines[i])
+	}
+	newWords := make([]map[string]bool, m)
+	for j := range newLines {
+		newWords[j] = wordSet(newLines[j])
+	}
+
+	similarity := make([][]float64, n)
+	for i := range similarity {
+		similarity[i] = make([]float64, m)
+		for j := range similarity[i] {
+			similarity[i][j] = jaccard(oldWords[i], newWords[j])
+		}
+	}
+
+	// score[i][j] - best total similarity aligning oldLines[i:] with newLines[j:]
+	score := make([][]float64, n+1)
+	for i := range score {
+		score[i] = make([]float64, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			best := max(score[i+1][j], score[i][j+1])
+			if similarity[i][j] >= minPageSimilarity {
+				best = max(best, score[i+1][j+1]+similarity[i][j])
+			}
+			score[i][j] = best
+		}
+	}
+
+	var pairs []pagePair
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case similarity[i][j] >= minPageSimilarity && score[i][j] == score[i+1][j+1]+similarity[i][j]:
+			pairs = append(pairs, pagePair{i, j})
+			i++
+			j++
+		case score[i+1][j] >= score[i][j+1]:
+			pairs = append(pairs, pagePair{i, -1})
+			i++
+		default:
+			pairs = append(pairs, pagePair{-1, j})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		pairs = append(pairs, pagePair{i, -1})
+	}
+	for ; j < m; j++ {
+		pairs = append(pairs, pagePair{-1, j})
+	}
+	return pairs
+}
+
+// lineHunk - A hunk with the line indexes it starts at, for section lookup
+type lineHunk struct {
+	Hunk
+	oldLine, newLine int
+}
+
+// diffLines diffs the lines of two aligned pages with a longest common subsequence
+func diffLines(old, new []string) []lineHunk {
+	n, m := len(old), len(new)
+	if n*m > maxLineCells {
+		return []lineHunk{{Hunk: Hunk{Kind: kindOf(old, new), Old: old, New: new}}}
+	}
+
+	// common[i][j] - LCS length of old[i:] and new[j:]
+	common := make([][]int, n+1)
+	for i := range common {
+		common[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var (
+		hunks   []lineHunk
+		current *lineHunk
+	)
+	flush := func() {
+		if current != nil {
+			current.Kind = kindOf(current.Old, current.New)
+			hunks = append(hunks, *current)
+			current = nil
+		}
+	}
+	open := func(i, j int) {
+		if current == nil {
+			current = &lineHunk{oldLine: i, newLine: j}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && old[i] == new[j]:
+			flush()
+			i++
+			j++
+		case j < m && (i == n || common[i][j+1] >= common[i+1][j]):
+			open(i, j)
+			current.New = append(current.New, new[j])
+			j++
+		default:
+			open(i, j)
+			current.Old = append(current.Old, old[i])
+			i++
+		}
+	}
+	flush()
+	return hunks
+}
+
+func kindOf(old, new []string) string {
+	switch {
+	case len(old) == 0:
+		return Added
+	case len(new) == 0:
+		return Removed
+	}
+	return Changed
+}
+
+func wordSet(lines []string) map[string]bool {
+	words := make(map[string]bool)
+	for _, line := range lines {
+		for _, word := range strings.Fields(strings.ToLower(line)) {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// headingPattern matches section headings such as "4.2 Termination",
+// "Section 5", "ARTICLE IV - Payment" or "§ 3 Scope"
+var headingPattern = regexp.MustCompile(`^(?:(?i:section|article|clause|chapter|part|schedule|annex|appendix)\s+[\dIVXLC]+[\w.]*|§\s*\d+[\w.]*|\d+(?:\.\d+)*\.?\s+\p{Lu})`)
+
+// maxHeadingChars - Longer lines are body text even if they start like a heading
+const maxHeadingChars = 100
+
+// maxTitleWords - Words of a heading's title taken from a line it was run into
+const maxTitleWords = 8
+
+// headingOf returns the heading a line starts with, "" when it starts with
+// none. A short line without a full stop is a heading line; a heading run
+// into a sentence keeps its number and the capitalized words of its title.
+func headingOf(line string) string {
+	match := headingPattern.FindStringIndex(line)
+	if match == nil {
+		return ""
+	}
+	if len(line) <= maxHeadingChars && !strings.HasSuffix(line, ".") {
+		return line
+	}
+
+	// The pattern ends on the first letter of the title for numbered headings
+	number := line[:match[1]]
+	if n := len(number); n >= 2 && number[n-2] == ' ' {
+		number = number[:n-1]
+	}
+	words := strings.Fields(line)
+	end := len(strings.Fields(number))
+	for title := 0; end < len(words) && title < maxTitleWords; title++ {
+		first := []rune(words[end])[0]
+		if unicode.IsLetter(first) && !unicode.IsUpper(first) {
+			break
+		}
+		end++
+	}
+	return strings.TrimRight(strings.Join(words[:end], " "), " .,;:-–&")
+}
+
+// sectionTracker - The nearest heading above every line of a document
+type sectionTracker struct {
+	sections [][]string // [page][line]
+}
+
+func newSectionTracker(pages [][]string) *sectionTracker {
+	tracker := &sectionTracker{sections: make([][]string, len(pages))}
+	current := ""
+	for p, lines := range pages {
+		tracker.sections[p] = make([]string, len(lines))
+		for l, line := range lines {
+			if heading := headingOf(line); heading != "" {
+				current = heading
+			}
+			tracker.sections[p][l] = current
+		}
+	}
+	return tracker
+}
+
+// at returns the heading in effect at line of page; a hunk past the last line
+// of the page takes the heading of its last line
+func (t *sectionTracker) at(page, line int) string {
+	sections := t.sections[page]
+	if len(sections) == 0 {
+		// Empty page: the last heading before it
+		for p := page - 1; p >= 0; p-- {
+			if n := len(t.sections[p]); n > 0 {
+				return t.sections[p][n-1]
+			}
+		}
+		return ""
+	}
+	return sections[min(line, len(sections)-1)]
+}
@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"whitespace collapsed", "  Rent   is due\tmonthly  ", []string{"Rent is due monthly"}},
+		{"text lines", "First line\n\nSecond line", []string{"First line", "Second line"}},
+		{"sentences", "Rent is due. Pay now! Is it late? Yes", []string{"Rent is due.", "Pay now!", "Is it late?", "Yes"}},
+		{"decimal kept", "The rate is 4.5 percent.", []string{"The rate is 4.5 percent."}},
+		{"heading number kept with title", "1. Definitions", []string{"1. Definitions"}},
+		{"named heading kept with title", "Section 5. Rent is due.", []string{"Section 5. Rent is due."}},
+		{"run-in headings", "1. Definitions 1.1 Lease means the agreement. 1.2 Tenant means you.",
+			[]string{"1. Definitions", "1.1 Lease means the agreement.", "1.2 Tenant means you."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lines(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadingOf(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"The rent is due monthly.", ""},
+		{"2024 was a good year.", ""},
+		{"1. Definitions", "1. Definitions"},
+		{"4.2 Termination", "4.2 Termination"},
+		{"Section 5", "Section 5"},
+		{"§ 3 Scope", "§ 3 Scope"},
+		{"1.1 Lease means the agreement.", "1.1 Lease"},
+		{"ARTICLE IV - Payment Terms rent is due monthly.", "ARTICLE IV - Payment Terms"},
+		{"4.2 Termination: either party may end it.", "4.2 Termination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := headingOf(tt.line); got != tt.want {
+				t.Errorf("headingOf(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPages(t *testing.T) {
+	lease := "1. Definitions 1.1 Lease means the agreement. 1.2 Tenant means the person renting the flat."
+	rent := "2. Rent The rent is 100 euros per month. It is paid on the first day of the month."
+	notice := "3. Notice Either party may end the lease with three months notice in writing."
+
+	tests := []struct {
+		name     string
+		old, new []string
+		want     []Hunk
+	}{
+		{"same", []string{lease, rent}, []string{lease, rent}, []Hunk{}},
+		{"changed sentence", []string{lease, rent}, []string{lease, "2. Rent The rent is 120 euros per month. It is paid on the first day of the month."},
+			[]Hunk{{Kind: Changed, OldPage: 2, NewPage: 2, Section: "2. Rent The",
+				Old: []string{"2. Rent The rent is 100 euros per month."}, New: []string{"2. Rent The rent is 120 euros per month."}}}},
+		{"added sentence", []string{lease}, []string{lease + " 1.3 Flat means the rented rooms."},
+			[]Hunk{{Kind: Added, OldPage: 1, NewPage: 1, Section: "1.3 Flat", New: []string{"1.3 Flat means the rented rooms."}}}},
+		{"removed sentence", []string{rent}, []string{"2. Rent The rent is 100 euros per month."},
+			[]Hunk{{Kind: Removed, OldPage: 1, NewPage: 1, Section: "2. Rent The", Old: []string{"It is paid on the first day of the month."}}}},
+		{"inserted page", []string{lease, rent}, []string{lease, notice, rent},
+			[]Hunk{{Kind: Added, NewPage: 2, Section: "3. Notice Either",
+				New: []string{"3. Notice Either party may end the lease with three months notice in writing."}}}},
+		{"removed page", []string{lease, notice, rent}, []string{lease, rent},
+			[]Hunk{{Kind: Removed, OldPage: 2, Section: "3. Notice Either",
+				Old: []string{"3. Notice Either party may end the lease with three months notice in writing."}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Pages(tt.old, tt.new)
+			if !reflect.DeepEqual(result.Hunks, tt.want) {
+				t.Errorf("Pages() hunks = %+v, want %+v", result.Hunks, tt.want)
+			}
+			if result.OldPages != len(tt.old) || result.NewPages != len(tt.new) {
+				t.Errorf("Pages() pages = %d/%d, want %d/%d", result.OldPages, result.NewPages, len(tt.old), len(tt.new))
+			}
+			if result.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v with %d hunks", result.Empty(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	result := &Result{Hunks: []Hunk{
+		{Kind: Changed, OldPage: 2, NewPage: 2, Section: "2. Rent", Old: []string{"Rent is 100."}, New: []string{"Rent is 120."}},
+		{Kind: Added, NewPage: 3, New: []string{"A new clause."}},
+	}}
+
+	tests := []struct {
+		name     string
+		maxChars int
+		want     string
+	}{
+		{"all", 1000, "[CHANGED] section \"2. Rent\", old page 2, new page 2\n- Rent is 100.\n+ Rent is 120.\n\n[ADDED] new page 3\n+ A new clause."},
+		{"truncated", 100, "[CHANGED] section \"2. Rent\", old page 2, new page 2\n- Rent is 100.\n+ Rent is 120.\n\n[1 more changes not shown]"},
+		{"nothing fits", 10, "[2 more changes not shown]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result.Format(tt.maxChars); got != tt.want {
+				t.Errorf("Format(%d) = %q, want %q", tt.maxChars, got, tt.want)
+			}
+		})
+	}
+}
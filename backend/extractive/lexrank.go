@@ -0,0 +1,219 @@
+// Package extractive ranks sentences by centrality (LexRank) to build
+// summaries without a language model.
+package extractive
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	damping       = 0.85
+	maxIterations = 100
+	tolerance     = 1e-6
+
+	// minSentenceWords drops fragments (headers, page numbers) from ranking
+	minSentenceWords = 4
+
+	// queryWeight is the share of the score given to similarity with the query
+	queryWeight = 0.7
+)
+
+// Sentences splits text into trimmed sentences on ., ! and ?
+func Sentences(text string) []string {
+	var sentences []string
+	var current strings.Builder
+
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	for i, r := range runes {
+		current.WriteRune(r)
+		if (r == '.' || r == '!' || r == '?') && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+			if sentence := strings.TrimSpace(current.String()); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			current.Reset()
+		}
+	}
+	if sentence := strings.TrimSpace(current.String()); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// Rank scores each sentence with continuous LexRank: PageRank over a graph
+// weighted by TF-IDF cosine similarity. A non-empty query biases the random
+// jumps toward sentences similar to it (query-focused LexRank).
+func Rank(sentences []string, query string) []float64 {
+	n := len(sentences)
+	scores := make([]float64, n)
+	if n == 0 {
+		return scores
+	}
+
+	vectors, idf := tfidf(sentences)
+
+	// Row-normalized similarity matrix
+	sim := make([][]float64, n)
+	for i := range sim {
+		sim[i] = make([]float64, n)
+		var rowSum float64
+		for j := range sim[i] {
+			if i != j {
+				sim[i][j] = cosine(vectors[i], vectors[j])
+				rowSum += sim[i][j]
+			}
+		}
+		for j := range sim[i] {
+			if rowSum > 0 {
+				sim[i][j] /= rowSum
+			} else if i != j {
+				sim[i][j] = 1 / float64(n-1)
+			}
+		}
+	}
+
+	// Jump distribution: uniform, or toward sentences matching the query,
+	// which then outweighs centrality (query-focused LexRank)
+	jump := make([]float64, n)
+	for i := range jump {
+		jump[i] = 1 / float64(n)
+	}
+	jumpWeight := 1 - damping
+	if strings.TrimSpace(query) != "" {
+		queryVec := weigh(termCounts(query), idf)
+		var total float64
+		relevance := make([]float64, n)
+		for i := range relevance {
+			relevance[i] = cosine(queryVec, vectors[i])
+			total += relevance[i]
+		}
+		if total > 0 {
+			for i := range jump {
+				jump[i] = relevance[i] / total
+			}
+			jumpWeight = queryWeight
+		}
+	}
+
+	// Power iteration
+	for i := range scores {
+		scores[i] = 1 / float64(n)
+	}
+	for iter := 0; iter < maxIterations; iter++ {
+		next := make([]float64, n)
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				next[j] += scores[i] * sim[i][j]
+			}
+			next[j] = jumpWeight*jump[j] + (1-jumpWeight)*next[j]
+		}
+
+		var delta float64
+		for i := range next {
+			delta += math.Abs(next[i] - scores[i])
+		}
+		scores = next
+		if delta < tolerance {
+			break
+		}
+	}
+
+	// Fragments never win
+	for i, sentence := range sentences {
+		if len(strings.Fields(sentence)) < minSentenceWords {
+			scores[i] = 0
+		}
+	}
+	return scores
+}
+
+// TopIndices returns the indices of the n best sentences, best first
+func TopIndices(sentences []string, n int, query string) []int {
+	scores := Rank(sentences, query)
+
+	indices := make([]int, len(sentences))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(a, b int) bool { return scores[indices[a]] > scores[indices[b]] })
+
+	if n < len(indices) {
+		indices = indices[:n]
+	}
+	return indices
+}
+
+// Summarize returns the n most central sentences in document order
+func Summarize(sentences []string, n int, query string) []string {
+	indices := TopIndices(sentences, n, query)
+	sort.Ints(indices)
+
+	summary := make([]string, len(indices))
+	for i, index := range indices {
+		summary[i] = sentences[index]
+	}
+	return summary
+}
+
+// tfidf builds a weighted term vector per sentence and returns the idf table
+func tfidf(sentences []string) ([]map[string]float64, map[string]float64) {
+	counts := make([]map[string]float64, len(sentences))
+	documentFrequency := make(map[string]float64)
+	for i, sentence := range sentences {
+		counts[i] = termCounts(sentence)
+		for term := range counts[i] {
+			documentFrequency[term]++
+		}
+	}
+
+	idf := make(map[string]float64, len(documentFrequency))
+	for term, df := range documentFrequency {
+		idf[term] = math.Log(float64(len(sentences))/df) + 1
+	}
+
+	vectors := make([]map[string]float64, len(sentences))
+	for i := range counts {
+		vectors[i] = weigh(counts[i], idf)
+	}
+	return vectors, idf
+}
+
+// weigh multiplies term counts by idf; unknown terms are ignored
+func weigh(counts map[string]float64, idf map[string]float64) map[string]float64 {
+	vector := make(map[string]float64, len(counts))
+	for term, count := range counts {
+		if weight, ok := idf[term]; ok {
+			vector[term] = count * weight
+		}
+	}
+	return vector
+}
+
+func termCounts(text string) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 2 && !stopwords[word] {
+			counts[word]++
+		}
+	}
+	return counts
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, weight := range a {
+		dot += weight * b[term]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,119 @@
+package extractive
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"one without a full stop", "Rent is due monthly", []string{"Rent is due monthly"}},
+		{"split on . ! ?", "Rent is due. Pay now! Is it late?", []string{"Rent is due.", "Pay now!", "Is it late?"}},
+		{"whitespace collapsed", "  Rent   is\n due.\tPay  now. ", []string{"Rent is due.", "Pay now."}},
+		{"numbers kept whole", "The rate is 4.5 percent. Done.", []string{"The rate is 4.5 percent.", "Done."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	lease := []string{
+		"The tenant pays the monthly rent to the landlord.",
+		"The landlord maintains the building and the roof.",
+		"The tenant pays the rent before the fifth day of each month.",
+		"Page 3",
+	}
+
+	tests := []struct {
+		name      string
+		sentences []string
+		query     string
+		best      int // index with the highest score, -1 = only check the length
+	}{
+		{"empty", nil, "", -1},
+		{"central sentence wins", lease, "", 0},
+		{"query moves the best sentence", lease, "building roof maintenance", 1},
+		{"query without known terms is ignored", lease, "zebra", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := Rank(tt.sentences, tt.query)
+			if len(scores) != len(tt.sentences) {
+				t.Fatalf("got %d scores for %d sentences", len(scores), len(tt.sentences))
+			}
+			if tt.best < 0 {
+				return
+			}
+			for i, score := range scores {
+				if math.IsNaN(score) {
+					t.Fatalf("score %d is NaN", i)
+				}
+				if i != tt.best && score >= scores[tt.best] {
+					t.Errorf("sentence %d scored %f, not below the best %d (%f)", i, score, tt.best, scores[tt.best])
+				}
+			}
+			if scores[3] != 0 {
+				t.Errorf("fragment scored %f, want 0", scores[3])
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	sentences := []string{
+		"The tenant pays the monthly rent to the landlord.",
+		"The landlord maintains the building and the roof.",
+		"The tenant pays the rent before the fifth day of each month.",
+		"Late rent costs the tenant a fee of five percent.",
+	}
+
+	tests := []struct {
+		name  string
+		n     int
+		query string
+		want  int
+	}{
+		{"fewer than available", 2, "", 2},
+		{"more than available", 10, "", 4},
+		{"none", 0, "", 0},
+		{"with query", 1, "roof", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := Summarize(sentences, tt.n, tt.query)
+			if len(summary) != tt.want {
+				t.Fatalf("got %d sentences, want %d", len(summary), tt.want)
+			}
+
+			// Document order is kept
+			last := -1
+			for _, sentence := range summary {
+				index := -1
+				for i, s := range sentences {
+					if s == sentence {
+						index = i
+					}
+				}
+				if index <= last {
+					t.Errorf("summary %q is not in document order", summary)
+				}
+				last = index
+			}
+		})
+	}
+
+	if got := Summarize(sentences, 1, "roof"); got[0] != sentences[1] {
+		t.Errorf("Summarize with query roof = %q, want %q", got, sentences[1])
+	}
+}
@@ -0,0 +1,29 @@
+package extractive
+
+// stopwords - Common English and Indonesian function words (3+ letters)
+var stopwords = toSet(
+	// English
+	"the", "and", "for", "are", "but", "not", "you", "all", "any", "can", "had", "her", "was",
+	"one", "our", "out", "has", "his", "how", "its", "who", "did", "yes", "she", "him", "they",
+	"this", "that", "with", "have", "from", "were", "been", "will", "would", "there", "their",
+	"what", "when", "which", "while", "where", "these", "those", "then", "than", "them", "also",
+	"into", "more", "most", "such", "only", "other", "some", "each", "about", "over", "after",
+	"before", "because", "should", "could", "being", "does", "very", "just", "your", "may",
+	// Indonesian
+	"yang", "dan", "di", "ke", "dari", "untuk", "dengan", "ini", "itu", "pada", "adalah", "akan",
+	"dalam", "tidak", "juga", "atau", "oleh", "sebagai", "karena", "telah", "sudah", "bahwa",
+	"dapat", "ada", "lebih", "para", "saat", "serta", "secara", "tersebut", "mereka", "kami",
+)
+
+// IsStopword reports whether a lowercase word is a common function word
+func IsStopword(word string) bool {
+	return stopwords[word]
+}
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
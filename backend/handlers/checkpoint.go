@@ -4,140 +4,216 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"pdf-summarizer-backend/ai"
 	"pdf-summarizer-backend/database"
 	"pdf-summarizer-backend/models"
-	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// CheckpointData stores partial processing results
-type CheckpointData struct {
-	ProcessedPages  []int                  `json:"processed_pages"`
-	PartialResults  map[string]interface{} `json:"partial_results"`
-	LastPage        int                    `json:"last_page"`
-	ProcessedChunks int                    `json:"processed_chunks"` // Number of chunks processed
-	TotalChunks     int                    `json:"total_chunks"`     // Total chunks in document
-	LastChunk       int                    `json:"last_chunk"`       // Last chunk processed
+// ChunkProgress - Aggregate state of a job's chunks
+type ChunkProgress struct {
+	Total     int
+	Completed int // completed or skipped
+	Failed    int
+	LastPage  int // last page of the finished prefix of chunks
 }
 
-// SaveCheckpoint saves job progress to database
-func SaveCheckpoint(job *models.SummarizationJob, lastPage int, partialResult map[string]interface{}) error {
-	// Load existing checkpoint
-	var checkpoint CheckpointData
-	if job.PartialResult != nil && *job.PartialResult != "" {
-		if err := json.Unmarshal([]byte(*job.PartialResult), &checkpoint); err != nil {
-			log.Printf("⚠️  Failed to parse existing checkpoint: %v", err)
-			checkpoint = CheckpointData{
-				ProcessedPages: []int{},
-				PartialResults: make(map[string]interface{}),
-			}
-		}
-	} else {
-		checkpoint = CheckpointData{
-			ProcessedPages: []int{},
-			PartialResults: make(map[string]interface{}),
-		}
+// PrepareCheckpoint creates the job's chunk rows for the plan and returns them by index.
+// Rows from a previous attempt are kept; if the plan changed they are replaced.
+func PrepareCheckpoint(job *models.SummarizationJob, chunks []pageChunk) (map[int]*models.JobChunk, error) {
+	existing, err := LoadCheckpoint(job.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update checkpoint
-	checkpoint.LastPage = lastPage
-	checkpoint.ProcessedPages = append(checkpoint.ProcessedPages, lastPage)
-	
-	// Update chunk tracking if provided
-	if chunkInfo, ok := partialResult["_chunk_info"].(map[string]interface{}); ok {
-		if processedChunks, ok := chunkInfo["processed_chunks"].(int); ok {
-			checkpoint.ProcessedChunks = processedChunks
-		}
-		if totalChunks, ok := chunkInfo["total_chunks"].(int); ok {
-			checkpoint.TotalChunks = totalChunks
+	// Different chunking than last attempt (e.g. CHUNK_PAGES changed): start over
+	if len(existing) > 0 && !samePlan(existing, chunks) {
+		log.Printf("Job %d: chunk plan changed, discarding %d saved chunks", job.ID, len(existing))
+		if err := database.DB.Where("job_id = ?", job.ID).Delete(&models.JobChunk{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to reset chunks: %v", err)
 		}
-		if lastChunk, ok := chunkInfo["last_chunk"].(int); ok {
-			checkpoint.LastChunk = lastChunk
+		existing = map[int]*models.JobChunk{}
+	}
+
+	var rows []models.JobChunk
+	for _, chunk := range chunks {
+		if _, ok := existing[chunk.Index]; ok {
+			continue
 		}
-		// Remove chunk info from partial results (internal use only)
-		delete(partialResult, "_chunk_info")
+		rows = append(rows, models.JobChunk{
+			JobID:      job.ID,
+			ChunkIndex: chunk.Index,
+			Pages:      chunk.Spec(),
+			PageStart:  chunk.FirstPage(),
+			PageEnd:    chunk.LastPage(),
+			Status:     models.ChunkStatusPending,
+		})
 	}
-	
-	// Merge partial results
-	for key, value := range partialResult {
-		if existing, ok := checkpoint.PartialResults[key]; ok {
-			// Append to existing result
-			switch v := existing.(type) {
-			case string:
-				checkpoint.PartialResults[key] = v + "\n\n" + fmt.Sprintf("%v", value)
-			case []interface{}:
-				if newList, ok := value.([]interface{}); ok {
-					checkpoint.PartialResults[key] = append(v, newList...)
-				}
-			default:
-				checkpoint.PartialResults[key] = value
-			}
-		} else {
-			checkpoint.PartialResults[key] = value
+
+	if len(rows) > 0 {
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to create chunks: %v", err)
 		}
 	}
 
-	// Save to database
-	checkpointJSON, err := json.Marshal(checkpoint)
+	return LoadCheckpoint(job.ID)
+}
+
+// LoadCheckpoint loads the job's chunk rows keyed by chunk index
+func LoadCheckpoint(jobID uint) (map[int]*models.JobChunk, error) {
+	var rows []models.JobChunk
+	if err := database.DB.Where("job_id = ?", jobID).Order("chunk_index").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %v", err)
+	}
+
+	chunks := make(map[int]*models.JobChunk, len(rows))
+	for i := range rows {
+		chunks[rows[i].ChunkIndex] = &rows[i]
+	}
+	return chunks, nil
+}
+
+// StartChunk marks a chunk as processing and counts the attempt
+func StartChunk(chunk *models.JobChunk) error {
+	now := time.Now()
+	chunk.Status = models.ChunkStatusProcessing
+	chunk.AttemptCount++
+	chunk.StartedAt = &now
+	chunk.ErrorMsg = nil
+
+	return database.DB.Model(chunk).Updates(map[string]interface{}{
+		"status":        chunk.Status,
+		"attempt_count": gorm.Expr("attempt_count + 1"),
+		"started_at":    now,
+		"error_msg":     nil,
+	}).Error
+}
+
+// SaveCheckpoint stores a finished chunk's result on its own row
+func SaveCheckpoint(chunk *models.JobChunk, result *ai.Result, latency time.Duration, usage aiUsage) error {
+	resultJSON, err := json.Marshal(result)
 	if err != nil {
-		return fmt.Errorf("failed to marshal checkpoint: %v", err)
+		return fmt.Errorf("failed to marshal chunk result: %v", err)
 	}
 
-	checkpointStr := string(checkpointJSON)
-	job.PartialResult = &checkpointStr
-	job.LastProcessedPage = &lastPage
+	now := time.Now()
+	resultStr := string(resultJSON)
+	chunk.Status = models.ChunkStatusCompleted
+	chunk.Result = &resultStr
+	chunk.AILatencyMs = latency.Milliseconds()
+	chunk.CompletedAt = &now
+	chunk.PromptTokens = usage.PromptTokens
+	chunk.CompletionTokens = usage.CompletionTokens
+	chunk.Cost = usage.Cost()
+	if usage.Model != "" {
+		chunk.AIModel = &usage.Model
+	}
 
-	if err := database.DB.Save(job).Error; err != nil {
+	if err := database.DB.Model(chunk).Updates(map[string]interface{}{
+		"status":            chunk.Status,
+		"result":            resultStr,
+		"ai_latency_ms":     chunk.AILatencyMs,
+		"prompt_tokens":     chunk.PromptTokens,
+		"completion_tokens": chunk.CompletionTokens,
+		"cost":              chunk.Cost,
+		"ai_model":          chunk.AIModel,
+		"completed_at":      now,
+	}).Error; err != nil {
 		return fmt.Errorf("failed to save checkpoint: %v", err)
 	}
 
-	if checkpoint.TotalChunks > 0 {
-		log.Printf("💾 Checkpoint saved: Job %d, Page %d, Chunk %d/%d", 
-			job.ID, lastPage, checkpoint.ProcessedChunks, checkpoint.TotalChunks)
-	} else {
-		log.Printf("💾 Checkpoint saved: Job %d, Page %d", job.ID, lastPage)
-	}
+	log.Printf("💾 Checkpoint saved: Job %d, chunk %d (pages %s)",
+		chunk.JobID, chunk.ChunkIndex+1, describePages(chunk.Pages))
 	return nil
 }
 
-// LoadCheckpoint loads existing checkpoint from database
-func LoadCheckpoint(job *models.SummarizationJob) (*CheckpointData, error) {
-	if job.PartialResult == nil || *job.PartialResult == "" {
-		return &CheckpointData{
-			ProcessedPages:  []int{},
-			PartialResults:  make(map[string]interface{}),
-			LastPage:        0,
-			ProcessedChunks: 0,
-			TotalChunks:     0,
-			LastChunk:       0,
-		}, nil
-	}
+// SkipChunk records a chunk with no extractable text
+func SkipChunk(chunk *models.JobChunk, reason string) error {
+	now := time.Now()
+	chunk.Status = models.ChunkStatusSkipped
+	chunk.ErrorMsg = &reason
+	chunk.CompletedAt = &now
 
-	var checkpoint CheckpointData
-	if err := json.Unmarshal([]byte(*job.PartialResult), &checkpoint); err != nil {
-		return nil, fmt.Errorf("failed to parse checkpoint: %v", err)
-	}
+	return database.DB.Model(chunk).Updates(map[string]interface{}{
+		"status":       chunk.Status,
+		"error_msg":    reason,
+		"completed_at": now,
+	}).Error
+}
 
-	if checkpoint.TotalChunks > 0 {
-		log.Printf("Checkpoint loaded: Job %d, Last page %d, Chunk %d/%d", 
-			job.ID, checkpoint.LastPage, checkpoint.ProcessedChunks, checkpoint.TotalChunks)
-	} else {
-		log.Printf("Checkpoint loaded: Job %d, Last page %d", job.ID, checkpoint.LastPage)
+// FailChunk records a chunk error; the chunk is retried on the job's next attempt
+func FailChunk(chunk *models.JobChunk, chunkErr error, latency time.Duration) error {
+	errMsg := chunkErr.Error()
+	chunk.Status = models.ChunkStatusFailed
+	chunk.ErrorMsg = &errMsg
+	chunk.AILatencyMs = latency.Milliseconds()
+
+	return database.DB.Model(chunk).Updates(map[string]interface{}{
+		"status":        chunk.Status,
+		"error_msg":     errMsg,
+		"ai_latency_ms": chunk.AILatencyMs,
+	}).Error
+}
+
+// chunkResult decodes a finished chunk's stored result; skipped chunks yield nil.
+// A result that no longer matches the mode's schema is re-run.
+func chunkResult(chunk *models.JobChunk, mode models.SummaryMode) (*ai.Result, bool) {
+	switch chunk.Status {
+	case models.ChunkStatusSkipped:
+		return nil, true
+	case models.ChunkStatusCompleted:
+		if chunk.Result == nil {
+			return nil, false
+		}
+		result, err := ai.DecodeResult(string(mode), []byte(*chunk.Result))
+		if err != nil {
+			log.Printf("⚠️  Discarding result of job %d chunk %d: %v", chunk.JobID, chunk.ChunkIndex, err)
+			return nil, false
+		}
+		return result, true
 	}
-	return &checkpoint, nil
+	return nil, false
 }
 
-// ClearCheckpoint clears checkpoint data (after successful completion)
-func ClearCheckpoint(job *models.SummarizationJob) error {
-	job.PartialResult = nil
-	job.LastProcessedPage = nil
-	
-	if err := database.DB.Save(job).Error; err != nil {
-		return fmt.Errorf("failed to clear checkpoint: %v", err)
+// GetChunkProgress aggregates the job's chunk rows
+func GetChunkProgress(jobID uint) ChunkProgress {
+	var rows []models.JobChunk
+	database.DB.Select("chunk_index", "status", "page_end").
+		Where("job_id = ?", jobID).Order("chunk_index").Find(&rows)
+
+	progress := ChunkProgress{Total: len(rows)}
+	prefix := true
+	for _, row := range rows {
+		switch row.Status {
+		case models.ChunkStatusCompleted, models.ChunkStatusSkipped:
+			progress.Completed++
+			if prefix {
+				progress.LastPage = row.PageEnd
+			}
+			continue
+		case models.ChunkStatusFailed:
+			progress.Failed++
+		}
+		prefix = false
 	}
+	return progress
+}
 
-	log.Printf("Checkpoint cleared: Job %d", job.ID)
-	return nil
+// samePlan reports whether saved chunk rows match the current chunk plan
+func samePlan(existing map[int]*models.JobChunk, chunks []pageChunk) bool {
+	if len(existing) != len(chunks) {
+		return false
+	}
+	for _, chunk := range chunks {
+		row, ok := existing[chunk.Index]
+		if !ok || describePages(row.Pages) != describePages(chunk.Spec()) {
+			return false
+		}
+	}
+	return true
 }
 
 // ProcessJobWithCheckpoint processes job with checkpoint/resume capability
@@ -147,26 +223,16 @@ func ProcessJobWithCheckpoint(jobID uint) error {
 		return err
 	}
 
-	// Load checkpoint
-	checkpoint, err := LoadCheckpoint(&job)
-	if err != nil {
-		log.Printf("Failed to load checkpoint: %v, starting fresh", err)
-		checkpoint = &CheckpointData{
-			ProcessedPages: []int{},
-			PartialResults: make(map[string]interface{}),
-			LastPage:       0,
-		}
+	// Redelivered after the job already finished (e.g. requeued once retries ran out)
+	if job.Status == models.JobStatusCompleted || job.Status == models.JobStatusFailed {
+		log.Printf("Job %d already %s, skipping", job.ID, job.Status)
+		return nil
 	}
 
 	// Check if resuming
-	isResume := checkpoint.LastPage > 0
-	if isResume {
-		if checkpoint.TotalChunks > 0 {
-			log.Printf("Resuming job %d from page %d, chunk %d/%d", 
-				job.ID, checkpoint.LastPage, checkpoint.ProcessedChunks, checkpoint.TotalChunks)
-		} else {
-			log.Printf("Resuming job %d from page %d", job.ID, checkpoint.LastPage)
-		}
+	if progress := GetChunkProgress(job.ID); progress.Completed > 0 {
+		log.Printf("Resuming job %d from page %d, chunk %d/%d",
+			job.ID, progress.LastPage, progress.Completed, progress.Total)
 	}
 
 	// Update status to processing
@@ -175,86 +241,54 @@ func ProcessJobWithCheckpoint(jobID uint) error {
 	job.StartedAt = &now
 	database.DB.Save(&job)
 
-	// For simple implementation, we process the whole PDF
-	// In production, you might want to split by page ranges
-	startTime := time.Now()
-	
-	result, err := callAIService(
-		job.PDFFile.FilePath,
-		string(job.Mode),
-		&job.Language,
-		job.Pages,
-		job.Question,
-	)
+	// Translations work from the stored summary, not the PDF
+	if job.Mode == models.ModeTranslate {
+		return processTranslation(&job)
+	}
 
-	if err != nil {
-		// Save checkpoint before failing
-		if checkpoint.LastPage > 0 {
-			// We have partial progress, save it
-			SaveCheckpoint(&job, checkpoint.LastPage, checkpoint.PartialResults)
-		}
+	// Comparisons diff the page texts of two PDFs instead of chunking one
+	if job.Mode == models.ModeCompare {
+		return processComparison(&job)
+	}
 
-		// Check if error is permanent (no point retrying)
-		isPermanentError := false
-		errMsg := err.Error()
-		
-		// Permanent errors that should not be retried
-		permanentErrors := []string{
-			"specified key does not exist",  // MinIO file not found
-			"file not found",
-			"invalid file format",
-			"file too large",
-			"could not extract text",        // PDF extraction error
-			"corrupted",
-			"encrypted",
-		}
-		
-		for _, permErr := range permanentErrors {
-			if strings.Contains(strings.ToLower(errMsg), permErr) {
-				isPermanentError = true
-				log.Printf("Permanent error detected for job %d: %s", job.ID, permErr)
-				break
-			}
-		}
+	// Split the requested pages into chunks; each finished chunk is checkpointed
+	// so a retry only re-runs the chunks that failed
+	chunks := planChunks(&job)
+	selectedPages := 0
+	for _, chunk := range chunks {
+		selectedPages += len(chunk.Pages)
+	}
+	if selectedPages > 0 {
+		job.TotalPages = &selectedPages
+	}
 
-		// Increment retry count
-		job.RetryCount++
-		job.ErrorMsg = &errMsg
+	startTime := time.Now()
 
-		// Mark as failed if:
-		// 1. Permanent error (no retry)
-		// 2. Max retries reached
-		if isPermanentError || job.RetryCount >= job.MaxRetries {
-			job.Status = models.JobStatusFailed
-			completedAt := time.Now()
-			job.CompletedAt = &completedAt
-			
-			if isPermanentError {
-				log.Printf("Job %d failed permanently: %s", job.ID, errMsg)
-			} else {
-				log.Printf("Job %d failed after %d retries. Checkpoint saved at page %d", 
-					job.ID, job.MaxRetries, checkpoint.LastPage)
-			}
-		} else {
-			// Reset to pending for retry
-			job.Status = models.JobStatusPending
-			job.StartedAt = nil
-			log.Printf("Job %d will retry (attempt %d/%d). Will resume from page %d", 
-				job.ID, job.RetryCount+1, job.MaxRetries, checkpoint.LastPage)
-		}
+	// The exact template version recorded on the job
+	prompt, err := jobPrompt(&job)
+	if err != nil {
+		return failJob(&job, err)
+	}
 
-		database.DB.Save(&job)
-		return err
+	// Generated text is relayed to GET /api/jobs/:jobId/stream as it arrives
+	stream := newJobStream(&job)
+
+	// Map: summarize chunks in parallel
+	checkpoint, err := PrepareCheckpoint(&job, chunks)
+	if err != nil {
+		return failJob(&job, err)
+	}
+	results, err := mapChunks(&job, chunks, checkpoint, prompt, stream)
+	if err != nil {
+		stream.Close()
+		return failJob(&job, err)
 	}
 
-	// Merge with checkpoint results if resuming
-	if isResume && len(checkpoint.PartialResults) > 0 {
-		log.Printf("Merging checkpoint results with new results")
-		for key, value := range checkpoint.PartialResults {
-			if _, exists := result[key]; !exists {
-				result[key] = value
-			}
-		}
+	// Reduce: combine chunk results
+	result, err := combineChunkResults(&job, results, stream)
+	stream.Close()
+	if err != nil {
+		return failJob(&job, err)
 	}
 
 	// Save summary to database
@@ -266,53 +300,120 @@ func ProcessJobWithCheckpoint(jobID uint) error {
 		Language:       job.Language,
 		PagesProcessed: job.Pages,
 		ProcessingTime: processingTime,
-	}
+		Provider:       job.Provider,
 
-	// Map result based on mode
-	switch string(job.Mode) {
-	case "simple":
-		if summaryText, ok := result["summary"].(string); ok {
-			summaryLog.SummaryText = &summaryText
-		}
-	case "structured":
-		if execSummary, ok := result["executive_summary"].(string); ok {
-			summaryLog.ExecutiveSummary = &execSummary
-		}
-		if bullets, ok := result["bullets"].([]interface{}); ok {
-			bulletsJSON, _ := json.Marshal(bullets)
-			bulletsStr := string(bulletsJSON)
-			summaryLog.Bullets = &bulletsStr
-		}
-		if highlights, ok := result["highlights"].([]interface{}); ok {
-			highlightsJSON, _ := json.Marshal(highlights)
-			highlightsStr := string(highlightsJSON)
-			summaryLog.Highlights = &highlightsStr
-		}
-	case "qa":
-		if answer, ok := result["answer"].(string); ok {
-			summaryLog.QAAnswer = &answer
-		}
-		summaryLog.QAQuestion = job.Question
+		// Usage of every AI call for this job, including earlier attempts
+		AIModel:          job.AIModel,
+		PromptTokens:     job.PromptTokens,
+		CompletionTokens: job.CompletionTokens,
+		Cost:             job.Cost,
+		TokensEstimated:  job.TokensEstimated,
+
+		TemplateID:      job.TemplateID,
+		TemplateVersion: job.TemplateVersion,
+		ExtractSchema:   job.ExtractSchema,
+		Style:           job.Style,
+	}
+	if err := applyResult(&summaryLog, result, job.Question); err != nil {
+		return failJob(&job, err)
 	}
+	summaryLog.Citations = verifyCitations(summaryLog.Citations, &job.PDFFile)
 
+	return completeJob(&job, &summaryLog)
+}
+
+// completeJob saves the job's summary and marks the job completed
+func completeJob(job *models.SummarizationJob, summaryLog *models.SummaryLog) error {
 	// Save summary
-	if err := database.DB.Create(&summaryLog).Error; err != nil {
+	if err := database.DB.Create(summaryLog).Error; err != nil {
 		errMsg := fmt.Sprintf("Failed to save summary: %s", err.Error())
 		job.ErrorMsg = &errMsg
 		job.Status = models.JobStatusFailed
-		database.DB.Save(&job)
+		database.DB.Save(job)
 		return err
 	}
 
-	// Clear checkpoint and mark as completed
-	ClearCheckpoint(&job)
-	
+	// Mark as completed (chunk rows are kept for debugging)
 	completedAt := time.Now()
 	job.Status = models.JobStatusCompleted
 	job.CompletedAt = &completedAt
 	job.SummaryLogID = &summaryLog.ID
-	database.DB.Save(&job)
+	database.DB.Save(job)
+	clearJobStream(job.ID)
 
 	log.Printf("Job %d completed successfully", job.ID)
+	tagAfterSummary(job, summaryLog)
 	return nil
 }
+
+// chunkPages returns the page range to request for a chunk
+func chunkPages(job *models.SummarizationJob, chunk pageChunk) *string {
+	if spec := chunk.Spec(); spec != nil {
+		return spec
+	}
+	// Unplanned chunk: fall back to the job's own range
+	return job.Pages
+}
+
+// describePages formats an optional page range for logging
+func describePages(pages *string) string {
+	if pages == nil {
+		return "all"
+	}
+	return *pages
+}
+
+// failJob records a processing error, keeping finished chunks for the next attempt
+func failJob(job *models.SummarizationJob, err error) error {
+	errMsg := err.Error()
+	job.ErrorMsg = &errMsg
+
+	progress := GetChunkProgress(job.ID)
+
+	// The AI provider is down, not the job: wait for the circuit without using up a retry
+	if ai.HasCode(err, ai.CodeCircuitOpen) {
+		job.Status = models.JobStatusPending
+		job.StartedAt = nil
+		log.Printf("Job %d paused, AI circuit open. %d/%d chunks saved", job.ID, progress.Completed, progress.Total)
+		database.DB.Save(job)
+		return err
+	}
+
+	// Permanent errors (bad input, budget reached) are not retried
+	isPermanentError := ai.IsPermanent(err)
+
+	// Increment retry count
+	job.RetryCount++
+
+	// Mark as failed if:
+	// 1. Permanent error (no retry)
+	// 2. Max retries reached
+	if isPermanentError || job.RetryCount >= job.MaxRetries {
+		job.Status = models.JobStatusFailed
+		completedAt := time.Now()
+		job.CompletedAt = &completedAt
+
+		clearJobStream(job.ID)
+
+		if isPermanentError {
+			log.Printf("Job %d failed permanently: %s", job.ID, errMsg)
+		} else {
+			log.Printf("Job %d failed after %d retries. %d/%d chunks saved (through page %d)",
+				job.ID, job.MaxRetries, progress.Completed, progress.Total, progress.LastPage)
+		}
+	} else {
+		// Reset to pending for retry, after the delay a rate-limited provider asked for
+		job.Status = models.JobStatusPending
+		job.StartedAt = nil
+		job.RetryAt = nil
+		if aiErr, ok := ai.AsError(err); ok && aiErr.RetryAfter > 0 {
+			retryAt := time.Now().Add(aiErr.RetryAfter)
+			job.RetryAt = &retryAt
+		}
+		log.Printf("Job %d will retry (attempt %d/%d). %d/%d chunks saved (through page %d), only unfinished chunks will run",
+			job.ID, job.RetryCount+1, job.MaxRetries, progress.Completed, progress.Total, progress.LastPage)
+	}
+
+	database.DB.Save(job)
+	return err
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMergedItems caps bullets/highlights kept when merging chunk results
+	maxMergedItems = 15
+
+	// reduceFanIn is how many texts one combine call merges; more are reduced in rounds
+	reduceFanIn = 8
+
+	// lengthAttempts is how often a reply far off the style's target length is requested in total
+	lengthAttempts = 2
+)
+
+// pageChunk - A contiguous group of the job's pages sent to the AI in one call
+type pageChunk struct {
+	Index int
+	Pages []int
+}
+
+// Spec returns the chunk's page range in the AI service format, e.g. "21-40"
+func (c pageChunk) Spec() *string {
+	if len(c.Pages) == 0 {
+		return nil
+	}
+	spec := utils.FormatPageRange(c.Pages)
+	return &spec
+}
+
+// FirstPage returns the lowest page number in the chunk
+func (c pageChunk) FirstPage() int {
+	if len(c.Pages) == 0 {
+		return 0
+	}
+	return c.Pages[0]
+}
+
+// LastPage returns the highest page number in the chunk
+func (c pageChunk) LastPage() int {
+	if len(c.Pages) == 0 {
+		return 0
+	}
+	return c.Pages[len(c.Pages)-1]
+}
+
+// planChunks splits the job's selected pages into chunks of config.ChunkPages pages.
+// The plan is deterministic, so a retry maps checkpointed results to the same chunks.
+func planChunks(job *models.SummarizationJob) []pageChunk {
+	// Multi mode already returns per-document results in a single call
+	if job.Mode == models.ModeMulti {
+		return []pageChunk{{Index: 0}}
+	}
+
+	totalPages, err := ensureTotalPages(&job.PDFFile)
+	if err != nil || totalPages == 0 {
+		log.Printf("Page count unavailable for job %d (%v), processing in one call", job.ID, err)
+		return []pageChunk{{Index: 0, Pages: nil}}
+	}
+
+	pageRange := ""
+	if job.Pages != nil {
+		pageRange = *job.Pages
+	}
+	pages := utils.ParsePageRange(pageRange, totalPages)
+
+	// Pages without text (scans) are left out up front rather than sent to the AI
+	if withText, ok := pagesWithText(&job.PDFFile); ok {
+		var kept, skipped []int
+		for _, page := range pages {
+			if withText[page] {
+				kept = append(kept, page)
+			} else {
+				skipped = append(skipped, page)
+			}
+		}
+		if len(kept) > 0 && len(skipped) > 0 {
+			log.Printf("Job %d: skipping pages %s, they have no text", job.ID, utils.FormatPageRange(skipped))
+			pages = kept
+		}
+	}
+
+	size := config.AppConfig.ChunkPages
+	var chunks []pageChunk
+	for start := 0; start < len(pages); start += size {
+		end := start + size
+		if end > len(pages) {
+			end = len(pages)
+		}
+		chunks = append(chunks, pageChunk{Index: len(chunks), Pages: pages[start:end]})
+	}
+
+	if len(chunks) == 0 {
+		return []pageChunk{{Index: 0, Pages: nil}}
+	}
+	return chunks
+}
+
+// ensureTotalPages returns the PDF's page count, extracting its pages if they are not stored yet
+func ensureTotalPages(pdf *models.PDFFile) (int, error) {
+	if pdf.TotalPages != nil {
+		return *pdf.TotalPages, nil
+	}
+	if err := ensurePDFPages(pdf); err != nil {
+		return 0, err
+	}
+	return *pdf.TotalPages, nil
+}
+
+// mapChunks summarizes every unfinished chunk, running up to CHUNK_CONCURRENCY
+// chunks of this job at once (and AI_MAX_CONCURRENCY calls per process).
+// Each chunk writes its own job_chunks row, so successful chunks are kept even
+// when others fail and concurrent chunks never overwrite each other.
+// A single-chunk job streams its text; with several chunks only the final combine is streamed.
+func mapChunks(job *models.SummarizationJob, chunks []pageChunk, checkpoint map[int]*models.JobChunk, prompt string, stream *jobStream) ([]*ai.Result, error) {
+	results := make([]*ai.Result, len(chunks))
+
+	// Reuse results saved by a previous attempt
+	var pending []pageChunk
+	for _, chunk := range chunks {
+		if result, ok := chunkResult(checkpoint[chunk.Index], job.Mode); ok {
+			results[chunk.Index] = result
+		} else {
+			pending = append(pending, chunk)
+		}
+	}
+	if restored := len(chunks) - len(pending); restored > 0 {
+		log.Printf("Job %d: %d/%d chunks restored from checkpoint", job.ID, restored, len(chunks))
+	}
+
+	var chunkStream *jobStream
+	if len(chunks) == 1 {
+		chunkStream = stream
+	}
+
+	var (
+		mu       sync.Mutex // guards results, failures and reserved
+		wg       sync.WaitGroup
+		failures []error
+		stopErr  error
+		reserved float64 // Estimated cost of the running chunks
+		slots    = make(chan struct{}, config.AppConfig.ChunkConcurrency)
+	)
+
+	for _, chunk := range pending {
+		slots <- struct{}{}
+
+		// A chunk starts only when its estimated cost fits the budget next to
+		// the running chunks; otherwise they finish first and their actual
+		// spend decides. At most one chunk runs past the cap.
+		estimate := 0.0
+		if job.BudgetCap != nil {
+			estimate = chunkCostEstimate(job, chunk, prompt)
+			mu.Lock()
+			fits := job.Cost+reserved+estimate <= *job.BudgetCap
+			mu.Unlock()
+			if !fits {
+				wg.Wait()
+			}
+		}
+
+		// Stop launching chunks once the job is over budget; finished chunks stay checkpointed
+		mu.Lock()
+		overBudget := budgetExceeded(job)
+		if !overBudget {
+			reserved += estimate
+		}
+		mu.Unlock()
+		if overBudget {
+			<-slots
+			stopErr = errBudgetExceeded(job)
+			break
+		}
+
+		wg.Add(1)
+
+		go func(chunk pageChunk, row *models.JobChunk, estimate float64) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			log.Printf("Job %d: processing chunk %d/%d (pages %s)",
+				job.ID, chunk.Index+1, len(chunks), describePages(chunk.Spec()))
+
+			if err := StartChunk(row); err != nil {
+				log.Printf("⚠️  Failed to mark chunk %d of job %d as processing: %v", chunk.Index+1, job.ID, err)
+			}
+
+			acquireAISlot()
+			startTime := time.Now()
+			call := jobCall(job, prompt, chunkPages(job, chunk))
+			call.Stream = chunkStream
+			call.Partial = len(chunks) > 1
+			result, err := callAIService(call)
+			latency := time.Since(startTime)
+			releaseAISlot()
+
+			var usage aiUsage
+			if err == nil {
+				usage = usageOf(result.Usage(), result)
+				result.ClearUsage()
+			}
+
+			if err != nil && len(chunks) > 1 && ai.HasCode(err, ai.CodeNoText) {
+				// Image-only pages: keep going with the rest of the document
+				log.Printf("Job %d: chunk %d has no extractable text, skipping", job.ID, chunk.Index+1)
+				SkipChunk(row, err.Error())
+				result, err = nil, nil
+			} else if err != nil {
+				log.Printf("Job %d: chunk %d failed: %v", job.ID, chunk.Index+1, err)
+				FailChunk(row, err, latency)
+			} else if saveErr := SaveCheckpoint(row, result, latency, usage); saveErr != nil {
+				log.Printf("⚠️  %v", saveErr)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			reserved -= estimate
+
+			if err != nil {
+				failures = append(failures, fmt.Errorf("chunk %d (pages %s): %w", chunk.Index+1, describePages(chunk.Spec()), err))
+				return
+			}
+			recordJobUsage(job, usage)
+			results[chunk.Index] = result
+		}(chunk, checkpoint[chunk.Index], estimate)
+	}
+	wg.Wait()
+
+	// Track the finished prefix on the job row (single column, no full-row rewrite)
+	if progress := GetChunkProgress(job.ID); progress.LastPage > 0 {
+		job.LastProcessedPage = &progress.LastPage
+		database.DB.Model(job).UpdateColumn("last_processed_page", progress.LastPage)
+	}
+
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	if len(failures) > 0 {
+		// Report the first failure; the retry re-runs only the failed chunks
+		return nil, failures[0]
+	}
+	return results, nil
+}
+
+// chunkCostEstimate prices a chunk's prompt, its page text and the prompt
+// template at charsPerToken, for the job's model
+func chunkCostEstimate(job *models.SummarizationJob, chunk pageChunk, prompt string) float64 {
+	var chars int64
+	query := database.DB.Model(&models.PDFPage{}).Where("pdf_file_id = ?", job.PDFFileID)
+	if len(chunk.Pages) > 0 {
+		query = query.Where("page_number IN ?", chunk.Pages)
+	}
+	query.Select("COALESCE(SUM(char_count), 0)").Scan(&chars)
+
+	usage := aiUsage{PromptTokens: (chars + int64(len(prompt))) / charsPerToken}
+	if job.AIModel != nil {
+		usage.Model = *job.AIModel
+	}
+	return usage.Cost()
+}
+
+// combineChunkResults reduces per-chunk AI results into one result for the job's mode.
+// Skipped chunks (no extractable text) are nil. The result is marked extractive
+// when any chunk or combine step fell back to the extractive summarizer.
+// The final combine of a simple summary is streamed.
+func combineChunkResults(job *models.SummarizationJob, results []*ai.Result, stream *jobStream) (*ai.Result, error) {
+	var usable []*ai.Result
+	extractive := false
+	for _, result := range results {
+		if result != nil {
+			usable = append(usable, result)
+			extractive = extractive || result.Provider() == ai.ProviderExtractive
+		}
+	}
+	if len(usable) == 0 {
+		return nil, ai.Permanent(ai.CodeNoText, "could not extract text from any page")
+	}
+	results = usable
+
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	var combined *ai.Result
+	switch job.Mode {
+	case models.ModeSimple, models.ModeExtractive:
+		summary, reducedExtractively, err := reduceJobTexts(job, collectTexts(results, func(r *ai.Result) string { return r.Simple.Summary }), nil, stream)
+		if err != nil {
+			return nil, err
+		}
+		extractive = extractive || reducedExtractively
+		combined = &ai.Result{Simple: &ai.SummaryResponse{Summary: summary}}
+
+	case models.ModeStructured:
+		execSummary, reducedExtractively, err := reduceJobTexts(job, collectTexts(results, func(r *ai.Result) string { return r.Structured.ExecutiveSummary }), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		extractive = extractive || reducedExtractively
+		var bullets, highlights [][]string
+		for _, result := range results {
+			bullets = append(bullets, result.Structured.Bullets)
+			highlights = append(highlights, result.Structured.Highlights)
+		}
+		combined = &ai.Result{Structured: &ai.StructuredResponse{
+			ExecutiveSummary: execSummary,
+			Bullets:          mergeLists(bullets),
+			Highlights:       mergeLists(highlights),
+		}}
+
+	case models.ModeQA:
+		answer, reducedExtractively, err := reduceJobTexts(job, collectTexts(results, func(r *ai.Result) string { return r.QA.Answer }), job.Question, nil)
+		if err != nil {
+			return nil, err
+		}
+		extractive = extractive || reducedExtractively
+		combined = &ai.Result{QA: &ai.QAResponse{Answer: answer}}
+
+	case models.ModeExtract:
+		data, err := mergeExtracted(job, results)
+		if err != nil {
+			return nil, err
+		}
+		combined = &ai.Result{Extract: &ai.ExtractResponse{Data: data}}
+
+	default:
+		return results[0], nil
+	}
+
+	if extractive {
+		combined.SetProvider(ai.ProviderExtractive)
+	}
+	return combined, nil
+}
+
+// mergeExtracted merges the data extracted from each chunk and checks the
+// merged object against the job's schema, required properties included
+func mergeExtracted(job *models.SummarizationJob, results []*ai.Result) (json.RawMessage, error) {
+	if job.ExtractSchema == nil {
+		return nil, ai.Permanent(ai.CodeInvalidSchema, "extract job %d has no schema", job.ID)
+	}
+	schema, err := ai.ParseSchema([]byte(*job.ExtractSchema))
+	if err != nil {
+		return nil, ai.Permanent(ai.CodeInvalidSchema, "invalid extract schema: %v", err)
+	}
+
+	var parts []json.RawMessage
+	for _, result := range results {
+		parts = append(parts, result.Extract.Data)
+	}
+	data, err := ai.MergeExtracted(schema, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	if violations := schema.Validate(data, false); len(violations) > 0 {
+		return nil, ai.Permanent(ai.CodeSchemaMismatch, "extracted data does not match the schema: %s", strings.Join(violations, "; "))
+	}
+	return data, nil
+}
+
+// reduceJobTexts reduces texts for job in its style and prompt template and adds the
+// combine calls to its usage. It also reports whether any combine call was extractive.
+func reduceJobTexts(job *models.SummarizationJob, texts []string, question *string, stream *jobStream) (string, bool, error) {
+	if budgetExceeded(job) {
+		return "", false, errBudgetExceeded(job)
+	}
+
+	prompt, err := jobPrompt(job)
+	if err != nil {
+		return "", false, err
+	}
+	style := parseStyle(job.Style).WithTemplate(prompt, job.Language, optionalString(question))
+
+	text, usage, err := reduceTexts(job.Provider, texts, &job.Language, question, style, stream)
+	recordJobUsage(job, usage)
+	return text, usage.Extractive, err
+}
+
+// reduceTexts combines texts with the provider like combine_summaries does,
+// merging groups of reduceFanIn in parallel rounds until one text remains.
+// Only the last round is written in style (with its prompt template) and streamed.
+func reduceTexts(provider string, texts []string, language, question *string, style *ai.Style, stream *jobStream) (string, aiUsage, error) {
+	var total aiUsage
+	if len(texts) == 0 {
+		return "", total, ai.Permanent(ai.CodeNoText, "could not extract text from any page")
+	}
+
+	for len(texts) > reduceFanIn {
+		groups := (len(texts) + reduceFanIn - 1) / reduceFanIn
+		next := make([]string, groups)
+		usages := make([]aiUsage, groups)
+		errs := make([]error, groups)
+
+		var wg sync.WaitGroup
+		for g := 0; g < groups; g++ {
+			end := (g + 1) * reduceFanIn
+			if end > len(texts) {
+				end = len(texts)
+			}
+
+			wg.Add(1)
+			go func(g int, group []string) {
+				defer wg.Done()
+				acquireAISlot()
+				defer releaseAISlot()
+				next[g], usages[g], errs[g] = callAICombine(provider, group, language, question, nil, nil)
+			}(g, texts[g*reduceFanIn:end])
+		}
+		wg.Wait()
+
+		for _, usage := range usages {
+			total.Add(usage)
+		}
+		for _, err := range errs {
+			if err != nil {
+				return "", total, err
+			}
+		}
+		texts = next
+	}
+
+	if len(texts) == 1 && question == nil && style.IsZero() {
+		if onToken := stream.onToken(); onToken != nil {
+			onToken(texts[0])
+		}
+		return texts[0], total, nil
+	}
+
+	acquireAISlot()
+	defer releaseAISlot()
+	text, usage, err := callAICombine(provider, texts, language, question, style, stream)
+	total.Add(usage)
+	return text, total, err
+}
+
+// collectTexts gathers one text from every chunk result
+func collectTexts(results []*ai.Result, text func(*ai.Result) string) []string {
+	var values []string
+	for _, result := range results {
+		if value := text(result); strings.TrimSpace(value) != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// mergeLists interleaves per-chunk lists, dropping duplicates,
+// so every part of the document is represented when the list is capped
+func mergeLists(lists [][]string) []string {
+	longest := 0
+	for _, items := range lists {
+		if len(items) > longest {
+			longest = len(items)
+		}
+	}
+
+	seen := make(map[string]bool)
+	merged := []string{}
+	for pos := 0; pos < longest; pos++ {
+		for _, items := range lists {
+			if pos >= len(items) {
+				continue
+			}
+			text := strings.ToLower(strings.TrimSpace(items[pos]))
+			if text == "" || seen[text] {
+				continue
+			}
+			seen[text] = true
+			merged = append(merged, items[pos])
+			if len(merged) >= maxMergedItems {
+				return merged
+			}
+		}
+	}
+	return merged
+}
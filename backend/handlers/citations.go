@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"pdf-summarizer-backend/citation"
+	"pdf-summarizer-backend/models"
+)
+
+// citedItems parses the page markers of each bullet or highlight
+func citedItems(items []string) []citation.Citation {
+	citations := []citation.Citation{}
+	for _, item := range items {
+		citations = append(citations, citation.Statement(item))
+	}
+	return citations
+}
+
+// citationTexts returns the statements without their markers
+func citationTexts(citations []citation.Citation) []string {
+	texts := make([]string, len(citations))
+	for i, c := range citations {
+		texts[i] = c.Text
+	}
+	return texts
+}
+
+// jsonReport encodes a citation report for the citations column
+func jsonReport(report *citation.Report) *string {
+	data, _ := json.Marshal(report)
+	value := string(data)
+	return &value
+}
+
+// citedAnswer moves the page markers of an answer into a citation report,
+// one citation per sentence
+func citedAnswer(answer string) (string, *string) {
+	clean, _ := citation.Strip(answer)
+	return clean, jsonReport(&citation.Report{Answer: citation.Sentences(answer)})
+}
+
+// verifyCitations checks a citations column against the text of pdf's pages
+// and returns it with the unsupported statements flagged. When the pages
+// cannot be read the citations are returned unverified; the answer itself is
+// still good.
+func verifyCitations(citations *string, pdf *models.PDFFile) *string {
+	if citations == nil {
+		return nil
+	}
+	var report citation.Report
+	if err := json.Unmarshal([]byte(*citations), &report); err != nil {
+		return citations
+	}
+
+	pages, err := pdfPages(pdf)
+	if err != nil {
+		log.Printf("⚠️  Citations of PDF %d not verified: %v", pdf.ID, err)
+		return citations
+	}
+	report.Verify(pages)
+	if report.Unsupported > 0 {
+		log.Printf("⚠️  %d statements about PDF %d are not supported by the pages they cite", report.Unsupported, pdf.ID)
+	}
+	return jsonReport(&report)
+}
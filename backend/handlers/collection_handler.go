@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateCollection creates a collection, optionally with its first members
+func CreateCollection(c *fiber.Ctx) error {
+	type CollectionRequest struct {
+		Name        string  `json:"name"`
+		Description *string `json:"description"` // optional
+		PDFIDs      []uint  `json:"pdf_ids"`     // optional
+	}
+
+	var req CollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	name, err := collectionName(req.Name)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	if err := checkPDFsExist(req.PDFIDs); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	}
+
+	collection := models.Collection{Name: name, Description: trimmedOrNil(req.Description)}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&collection).Error; err != nil {
+			return err
+		}
+		_, err := addMembers(tx, collection.ID, req.PDFIDs)
+		return err
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create collection")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Collection created successfully", newCollectionResponse(&collection, true))
+}
+
+// ListCollections lists collections by name with their member counts and
+// latest summaries (?q= matches part of the name, ?pdf_id= keeps the
+// collections of one PDF)
+func ListCollections(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := database.DB.Order("name ASC, id ASC")
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("name ILIKE ?", "%"+q+"%")
+	}
+	if pdfID := c.Query("pdf_id"); pdfID != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM collection_members m WHERE m.collection_id = collections.id AND m.pdf_file_id = ?)", pdfID)
+	}
+
+	var collections []models.Collection
+	if err := query.Limit(limit).Offset((page - 1) * limit).Find(&collections).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch collections")
+	}
+
+	responses := []models.CollectionResponse{}
+	for i := range collections {
+		responses = append(responses, newCollectionResponse(&collections[i], false))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collections fetched successfully", responses)
+}
+
+// GetCollection returns a collection with its members and latest summary
+func GetCollection(c *fiber.Ctx) error {
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collection fetched successfully", newCollectionResponse(collection, true))
+}
+
+// UpdateCollection renames a collection or changes its description
+func UpdateCollection(c *fiber.Ctx) error {
+	type UpdateRequest struct {
+		Name        *string `json:"name"`        // optional
+		Description *string `json:"description"` // optional, "" clears it
+	}
+
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	var req UpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name != nil {
+		if collection.Name, err = collectionName(*req.Name); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+	}
+	if req.Description != nil {
+		collection.Description = trimmedOrNil(req.Description)
+	}
+
+	if err := database.DB.Save(collection).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to update collection")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collection updated successfully", newCollectionResponse(collection, true))
+}
+
+// DeleteCollection deletes a collection; its PDFs are not deleted
+func DeleteCollection(c *fiber.Ctx) error {
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete collection")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collection deleted successfully", nil)
+}
+
+// AddCollectionMembers adds PDFs to a collection. A collection summarized
+// before gets a new summary that only summarizes the added documents.
+func AddCollectionMembers(c *fiber.Ctx) error {
+	type MembersRequest struct {
+		PDFIDs []uint `json:"pdf_ids"`
+	}
+
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	var req MembersRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.PDFIDs) == 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "pdf_ids is required")
+	}
+	if err := checkPDFsExist(req.PDFIDs); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	}
+
+	added, err := addMembers(database.DB, collection.ID, req.PDFIDs)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to add documents")
+	}
+	if added > 0 {
+		rerunCollectionSummary(collection.ID, utils.ClientID(c))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, fmt.Sprintf("%d documents added", added), newCollectionResponse(collection, true))
+}
+
+// RemoveCollectionMember removes a PDF from a collection. A collection
+// summarized before gets a new summary from the remaining digests.
+func RemoveCollectionMember(c *fiber.Ctx) error {
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	result := database.DB.Where("collection_id = ? AND pdf_file_id = ?", collection.ID, c.Params("pdfId")).
+		Delete(&models.CollectionMember{})
+	if result.Error != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to remove document")
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF is not in this collection")
+	}
+	rerunCollectionSummary(collection.ID, utils.ClientID(c))
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Document removed", newCollectionResponse(collection, true))
+}
+
+// ListPDFCollections lists the collections a PDF belongs to
+func ListPDFCollections(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	collections := []models.Collection{}
+	if err := database.DB.
+		Joins("JOIN collection_members m ON m.collection_id = collections.id").
+		Where("m.pdf_file_id = ?", pdf.ID).
+		Order("collections.name ASC").
+		Find(&collections).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch collections")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collections fetched successfully", collections)
+}
+
+// SummarizeCollection queues a summary across all documents of a collection.
+// Digests of unchanged documents and, when no document changed, the previous
+// synthesis are reused unless "force" is set.
+func SummarizeCollection(c *fiber.Ctx) error {
+	type SummarizeRequest struct {
+		Language *string `json:"language"` // optional, default english
+		Provider string  `json:"provider"` // optional, defaults to AI_PROVIDER
+		Force    bool    `json:"force"`    // optional, summarize every document again
+	}
+
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	var req SummarizeRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	provider, err := ai.Get(req.Provider)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+	}
+	language := "english"
+	if req.Language != nil && *req.Language != "" {
+		language = *req.Language
+	}
+
+	members, err := collectionMembers(collection.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch documents")
+	}
+	if len(members) == 0 {
+		return utils.ErrorResponse(c, fiber.StatusUnprocessableEntity, "Collection has no documents")
+	}
+
+	// A pending run reads the members when it starts, so it covers this request too
+	if !req.Force {
+		var pending models.CollectionSummary
+		if err := database.DB.
+			Where("collection_id = ? AND status = ? AND language = ? AND provider = ?", collection.ID, models.JobStatusPending, language, provider.Name()).
+			First(&pending).Error; err == nil {
+			return utils.SuccessResponse(c, fiber.StatusOK, "Identical collection summary already queued.", newCollectionSummaryResponse(&pending))
+		}
+	}
+
+	run := models.CollectionSummary{
+		CollectionID: collection.ID,
+		Language:     language,
+		Provider:     provider.Name(),
+		Force:        req.Force,
+		Trigger:      models.CollectionTriggerAPI,
+		SubmitterID:  utils.ClientID(c),
+	}
+	if err := queueCollectionSummary(&run); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create collection summary")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Collection summary queued. Processing will start shortly.", newCollectionSummaryResponse(&run))
+}
+
+// ListCollectionSummaries lists the summaries of a collection, newest first
+func ListCollectionSummaries(c *fiber.Ctx) error {
+	collection, err := findCollection(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection not found")
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var runs []models.CollectionSummary
+	if err := database.DB.Where("collection_id = ?", collection.ID).
+		Order("created_at DESC").
+		Limit(limit).Offset((page - 1) * limit).
+		Find(&runs).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch collection summaries")
+	}
+
+	responses := []models.CollectionSummaryResponse{}
+	for i := range runs {
+		responses = append(responses, newCollectionSummaryResponse(&runs[i]))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collection summaries fetched successfully", responses)
+}
+
+// GetCollectionSummary returns one summary of a collection with the documents it covers
+func GetCollectionSummary(c *fiber.Ctx) error {
+	var run models.CollectionSummary
+	if err := database.DB.Where("collection_id = ?", c.Params("collectionId")).First(&run, c.Params("summaryId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Collection summary not found")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Collection summary fetched successfully", newCollectionSummaryResponse(&run))
+}
+
+// collectionName trims and checks the name of a collection
+func collectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("Name is required")
+	case len(name) > 255:
+		return "", fmt.Errorf("Name is too long (max 255 characters)")
+	}
+	return name, nil
+}
+
+// checkPDFsExist reports the first of ids that is not an existing PDF
+func checkPDFsExist(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []uint
+	database.DB.Model(&models.PDFFile{}).Where("id IN ?", ids).Pluck("id", &found)
+	exists := make(map[uint]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+	for _, id := range ids {
+		if !exists[id] {
+			return fmt.Errorf("PDF %d not found", id)
+		}
+	}
+	return nil
+}
+
+// addMembers adds PDFs to a collection, skipping those already in it, and
+// returns how many were added
+func addMembers(tx *gorm.DB, collectionID uint, pdfIDs []uint) (int64, error) {
+	if len(pdfIDs) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	rows := make([]models.CollectionMember, 0, len(pdfIDs))
+	seen := make(map[uint]bool, len(pdfIDs))
+	for _, id := range pdfIDs {
+		if !seen[id] {
+			seen[id] = true
+			rows = append(rows, models.CollectionMember{CollectionID: collectionID, PDFFileID: id, AddedAt: now})
+		}
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+	return result.RowsAffected, result.Error
+}
+
+func findCollection(c *fiber.Ctx) (*models.Collection, error) {
+	var collection models.Collection
+	if err := database.DB.First(&collection, c.Params("collectionId")).Error; err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// newCollectionResponse builds the API representation of a collection, with
+// its members when withMembers is set
+func newCollectionResponse(collection *models.Collection, withMembers bool) models.CollectionResponse {
+	response := models.CollectionResponse{
+		ID:          collection.ID,
+		Name:        collection.Name,
+		Description: collection.Description,
+		CreatedAt:   collection.CreatedAt,
+		UpdatedAt:   collection.UpdatedAt,
+	}
+
+	if !withMembers {
+		database.DB.Model(&models.CollectionMember{}).
+			Joins("JOIN pdf_files ON pdf_files.id = collection_members.pdf_file_id AND pdf_files.deleted_at IS NULL").
+			Where("collection_members.collection_id = ?", collection.ID).
+			Count(&response.MemberCount)
+	} else {
+		members, _ := collectionMembers(collection.ID)
+		response.MemberCount = int64(len(members))
+		response.Members = []models.CollectionMemberResponse{}
+		for _, member := range members {
+			response.Members = append(response.Members, models.CollectionMemberResponse{
+				PDFFileID:        member.PDFFileID,
+				OriginalFilename: member.PDF.OriginalFilename,
+				TotalPages:       member.PDF.TotalPages,
+				AddedAt:          member.AddedAt,
+				Digested:         member.Digest != nil,
+				DigestLanguage:   member.DigestLanguage,
+				DigestSummaryID:  member.DigestSummaryID,
+				DigestedAt:       member.DigestedAt,
+			})
+		}
+	}
+
+	var latest models.CollectionSummary
+	if err := database.DB.Where("collection_id = ?", collection.ID).Order("created_at DESC").First(&latest).Error; err == nil {
+		summary := newCollectionSummaryResponse(&latest)
+		response.LatestSummary = &summary
+	}
+	return response
+}
+
+func newCollectionSummaryResponse(run *models.CollectionSummary) models.CollectionSummaryResponse {
+	return models.CollectionSummaryResponse{
+		ID:               run.ID,
+		CollectionID:     run.CollectionID,
+		Status:           run.Status,
+		Language:         run.Language,
+		Provider:         run.Provider,
+		Force:            run.Force,
+		Trigger:          run.Trigger,
+		RetryCount:       run.RetryCount,
+		ErrorMsg:         run.ErrorMsg,
+		Summary:          run.Summary,
+		Members:          rawJSON(run.Members),
+		Summarized:       run.Summarized,
+		Reused:           run.Reused,
+		CacheHit:         run.CacheHit,
+		Extractive:       run.Extractive,
+		AIModel:          run.AIModel,
+		PromptTokens:     run.PromptTokens,
+		CompletionTokens: run.CompletionTokens,
+		Cost:             run.Cost,
+		TokensEstimated:  run.TokensEstimated,
+		ProcessingTime:   run.ProcessingTime,
+		StartedAt:        run.StartedAt,
+		CompletedAt:      run.CompletedAt,
+		CreatedAt:        run.CreatedAt,
+	}
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/queue"
+	"pdf-summarizer-backend/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// digestModes - Summaries of a whole document that can stand in for its digest
+var digestModes = []models.SummaryMode{models.ModeSimple, models.ModeStructured, models.ModeExtractive}
+
+// collectionMember - A member of a collection with its PDF
+type collectionMember struct {
+	models.CollectionMember
+	PDF models.PDFFile
+}
+
+// ProcessCollectionSummary runs a collection summary. Map: every member gets
+// a digest, taken from its latest whole-document summary in the run's
+// language or summarized for the collection, and kept on the membership so
+// later runs only redo members that changed. Reduce: the digests are combined
+// like chunk results into one synthesis, unless an earlier run already
+// combined the same digests.
+func ProcessCollectionSummary(summaryID uint) error {
+	var run models.CollectionSummary
+	if err := database.DB.First(&run, summaryID).Error; err != nil {
+		return err
+	}
+
+	// Redelivered after the run already finished
+	if run.Status == models.JobStatusCompleted || run.Status == models.JobStatusFailed {
+		log.Printf("Collection summary %d already %s, skipping", run.ID, run.Status)
+		return nil
+	}
+
+	now := time.Now()
+	run.Status = models.JobStatusProcessing
+	run.StartedAt = &now
+	database.DB.Save(&run)
+	startTime := time.Now()
+
+	var collection models.Collection
+	if err := database.DB.First(&collection, run.CollectionID).Error; err != nil {
+		return failCollectionSummary(&run, ai.Permanent(ai.CodeFileNotFound, "collection %d not found", run.CollectionID))
+	}
+	members, err := collectionMembers(collection.ID)
+	if err != nil {
+		return failCollectionSummary(&run, err)
+	}
+	if len(members) == 0 {
+		return failCollectionSummary(&run, ai.Permanent(ai.CodeNoText, "collection %d has no documents", collection.ID))
+	}
+
+	// Map: members are digested in parallel; each digest is saved as soon as
+	// it is ready, so a retry only redoes the members that failed
+	var (
+		mu       sync.Mutex // guards usage and failures
+		wg       sync.WaitGroup
+		usage    aiUsage
+		failures []error
+		entries  = make([]models.CollectionSummaryMember, len(members))
+		slots    = make(chan struct{}, config.AppConfig.ChunkConcurrency)
+	)
+	for i := range members {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			entry, digestUsage, err := digestMember(&run, &members[i])
+
+			mu.Lock()
+			defer mu.Unlock()
+			usage.Add(digestUsage)
+			if err != nil {
+				failures = append(failures, fmt.Errorf("%s: %w", members[i].PDF.OriginalFilename, err))
+				return
+			}
+			entries[i] = entry
+		}(i)
+	}
+	wg.Wait()
+	recordCollectionUsage(&run, usage)
+	if len(failures) > 0 {
+		return failCollectionSummary(&run, failures[0])
+	}
+
+	for _, entry := range entries {
+		if entry.Reused {
+			run.Reused++
+		} else if entry.SummaryID == nil {
+			run.Summarized++
+		}
+	}
+	fingerprint := digestFingerprint(run.Language, members)
+	run.Fingerprint = &fingerprint
+	run.Members = jsonValue(entries)
+
+	// Reduce, or reuse the synthesis of identical digests
+	var previous models.CollectionSummary
+	err = database.DB.
+		Where("collection_id = ? AND status = ? AND fingerprint = ? AND id <> ?", run.CollectionID, models.JobStatusCompleted, fingerprint, run.ID).
+		Order("completed_at DESC").
+		First(&previous).Error
+	if err == nil && !run.Force {
+		run.Summary = previous.Summary
+		run.Extractive = previous.Extractive
+		run.CacheHit = true
+		log.Printf("Collection summary %d: digests unchanged since summary %d, reusing it", run.ID, previous.ID)
+	} else {
+		summary, reduceUsage, err := reduceDigests(&run, members)
+		recordCollectionUsage(&run, reduceUsage)
+		if err != nil {
+			return failCollectionSummary(&run, err)
+		}
+		run.Summary = &summary
+		run.Extractive = usage.Extractive || reduceUsage.Extractive
+	}
+
+	completedAt := time.Now()
+	run.Status = models.JobStatusCompleted
+	run.CompletedAt = &completedAt
+	run.ProcessingTime = time.Since(startTime).Seconds()
+	run.ErrorMsg = nil
+	database.DB.Save(&run)
+
+	log.Printf("Collection summary %d completed: %d documents, %d summarized, %d reused",
+		run.ID, len(members), run.Summarized, run.Reused)
+	return nil
+}
+
+// collectionMembers returns the members of a collection whose PDF still
+// exists, in the order they were added
+func collectionMembers(collectionID uint) ([]collectionMember, error) {
+	var rows []models.CollectionMember
+	if err := database.DB.
+		Joins("JOIN pdf_files ON pdf_files.id = collection_members.pdf_file_id AND pdf_files.deleted_at IS NULL").
+		Where("collection_members.collection_id = ?", collectionID).
+		Order("collection_members.added_at ASC, collection_members.pdf_file_id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load members of collection %d: %w", collectionID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.PDFFileID
+	}
+	var pdfs []models.PDFFile
+	if err := database.DB.Where("id IN ?", ids).Find(&pdfs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load members of collection %d: %w", collectionID, err)
+	}
+	byID := make(map[uint]models.PDFFile, len(pdfs))
+	for _, pdf := range pdfs {
+		byID[pdf.ID] = pdf
+	}
+
+	members := make([]collectionMember, 0, len(rows))
+	for _, row := range rows {
+		if pdf, ok := byID[row.PDFFileID]; ok {
+			members = append(members, collectionMember{CollectionMember: row, PDF: pdf})
+		}
+	}
+	return members, nil
+}
+
+// digestMember makes sure member has a current digest in the run's language.
+// The digest is reused when it was taken from the document's latest summary,
+// or summarized for the collection and the document has no summary since.
+func digestMember(run *models.CollectionSummary, member *collectionMember) (models.CollectionSummaryMember, aiUsage, error) {
+	entry := models.CollectionSummaryMember{PDFFileID: member.PDFFileID, Filename: member.PDF.OriginalFilename}
+
+	var latest *models.SummaryLog
+	if !run.Force {
+		latest = latestDocumentSummary(member.PDFFileID, run.Language)
+	}
+	var latestID *uint
+	if latest != nil {
+		latestID = &latest.ID
+	}
+
+	if !run.Force && member.Digest != nil &&
+		optionalString(member.DigestLanguage) == run.Language && sameID(member.DigestSummaryID, latestID) {
+		entry.SummaryID = member.DigestSummaryID
+		entry.Reused = true
+		return entry, aiUsage{}, nil
+	}
+
+	var (
+		digest string
+		usage  aiUsage
+		err    error
+	)
+	if latest != nil {
+		digest = strings.Join(translationFields(latest).texts, "\n")
+	} else if digest, usage, err = summarizeMember(run, &member.PDF); err != nil {
+		return entry, usage, err
+	}
+
+	digestedAt := time.Now()
+	member.Digest = &digest
+	member.DigestLanguage = &run.Language
+	member.DigestSummaryID = latestID
+	member.DigestedAt = &digestedAt
+	database.DB.Model(&models.CollectionMember{}).
+		Where("collection_id = ? AND pdf_file_id = ?", member.CollectionID, member.PDFFileID).
+		Updates(map[string]interface{}{
+			"digest":            digest,
+			"digest_language":   run.Language,
+			"digest_summary_id": latestID,
+			"digested_at":       digestedAt,
+		})
+
+	entry.SummaryID = latestID
+	return entry, usage, nil
+}
+
+// latestDocumentSummary returns the latest summary of the whole PDF in
+// language, or nil when there is none
+func latestDocumentSummary(pdfID uint, language string) *models.SummaryLog {
+	var summary models.SummaryLog
+	if err := database.DB.
+		Where("pdf_file_id = ? AND language = ? AND mode IN ? AND pages_processed IS NULL", pdfID, language, digestModes).
+		Order("created_at DESC").
+		First(&summary).Error; err != nil {
+		return nil
+	}
+	return &summary
+}
+
+// summarizeMember summarizes a PDF for a collection: its pages with text in
+// chunks of CHUNK_PAGES, combined into one text
+func summarizeMember(run *models.CollectionSummary, pdf *models.PDFFile) (string, aiUsage, error) {
+	var total aiUsage
+
+	pages, err := pageTexts(pdf, "")
+	if err != nil {
+		return "", total, err
+	}
+	var numbers []int
+	for _, page := range pages {
+		if strings.TrimSpace(page.Text) != "" {
+			numbers = append(numbers, page.Number)
+		}
+	}
+	if len(numbers) == 0 {
+		return "", total, ai.Permanent(ai.CodeNoText, "could not extract text from %s", pdf.OriginalFilename)
+	}
+
+	size := config.AppConfig.ChunkPages
+	var texts []string
+	for start := 0; start < len(numbers); start += size {
+		spec := utils.FormatPageRange(numbers[start:min(start+size, len(numbers))])
+
+		acquireAISlot()
+		result, err := callAIService(aiCall{
+			Provider: run.Provider,
+			PDF:      pdf,
+			Mode:     string(models.ModeSimple),
+			Language: &run.Language,
+			Pages:    &spec,
+			Partial:  len(numbers) > size,
+		})
+		releaseAISlot()
+		if err != nil {
+			return "", total, err
+		}
+
+		total.Add(usageOf(result.Usage(), result))
+		texts = append(texts, result.Simple.Summary)
+	}
+
+	summary, usage, err := reduceTexts(run.Provider, texts, &run.Language, nil, nil, nil)
+	total.Add(usage)
+	return summary, total, err
+}
+
+// reduceDigests combines the member digests into the collection summary.
+// Each digest is headed by its document's name so the synthesis can tell
+// them apart.
+func reduceDigests(run *models.CollectionSummary, members []collectionMember) (string, aiUsage, error) {
+	if len(members) == 1 {
+		return *members[0].Digest, aiUsage{}, nil
+	}
+
+	texts := make([]string, len(members))
+	for i, member := range members {
+		texts[i] = fmt.Sprintf("%s:\n%s", member.PDF.OriginalFilename, *member.Digest)
+	}
+	return reduceTexts(run.Provider, texts, &run.Language, nil, nil, nil)
+}
+
+// digestFingerprint identifies the input of the reduce step: the language and
+// the digest of every member
+func digestFingerprint(language string, members []collectionMember) string {
+	sorted := append([]collectionMember(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PDFFileID < sorted[j].PDFFileID })
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", language)
+	for _, member := range sorted {
+		digest := sha256.Sum256([]byte(optionalString(member.Digest)))
+		fmt.Fprintf(hash, "%d:%x\n", member.PDFFileID, digest)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordCollectionUsage adds usage to the run's totals
+func recordCollectionUsage(run *models.CollectionSummary, usage aiUsage) {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+	run.PromptTokens += usage.PromptTokens
+	run.CompletionTokens += usage.CompletionTokens
+	run.Cost += usage.Cost()
+	run.TokensEstimated = run.TokensEstimated || usage.Estimated
+	if run.AIModel == nil && usage.Model != "" {
+		model := usage.Model
+		run.AIModel = &model
+	}
+}
+
+// failCollectionSummary records a processing error like failJob; digests
+// already made are kept for the next attempt
+func failCollectionSummary(run *models.CollectionSummary, err error) error {
+	errMsg := err.Error()
+	run.ErrorMsg = &errMsg
+
+	switch {
+	case ai.HasCode(err, ai.CodeCircuitOpen):
+		// The AI provider is down, not the run: wait for the circuit without using up a retry
+		run.Status = models.JobStatusPending
+		run.StartedAt = nil
+		log.Printf("Collection summary %d paused, AI circuit open", run.ID)
+
+	case ai.IsPermanent(err) || run.RetryCount+1 >= run.MaxRetries:
+		run.RetryCount++
+		run.Status = models.JobStatusFailed
+		completedAt := time.Now()
+		run.CompletedAt = &completedAt
+		log.Printf("Collection summary %d failed: %s", run.ID, errMsg)
+
+	default:
+		run.RetryCount++
+		run.Status = models.JobStatusPending
+		run.StartedAt = nil
+		log.Printf("Collection summary %d will retry (attempt %d/%d)", run.ID, run.RetryCount+1, run.MaxRetries)
+	}
+
+	database.DB.Save(run)
+	return err
+}
+
+// queueCollectionSummary saves a pending collection summary and publishes it
+func queueCollectionSummary(run *models.CollectionSummary) error {
+	run.Status = models.JobStatusPending
+	run.MaxRetries = 3
+	if err := database.DB.Create(run).Error; err != nil {
+		return err
+	}
+
+	if err := queue.PublishCollectionSummary(run.ID, run.SubmitterID, run.Provider); err != nil {
+		log.Printf("Failed to publish collection summary to queue: %v", err)
+	}
+	return nil
+}
+
+// rerunCollectionSummary queues a new summary of a collection whose members
+// changed, in the language and with the provider of its latest summary.
+// Collections never summarized are left alone, and a run still pending
+// picks up the change when it starts.
+func rerunCollectionSummary(collectionID uint, submitterID string) {
+	var latest models.CollectionSummary
+	if err := database.DB.Where("collection_id = ?", collectionID).Order("created_at DESC").First(&latest).Error; err != nil {
+		return
+	}
+	if latest.Status == models.JobStatusPending {
+		return
+	}
+	members, err := collectionMembers(collectionID)
+	if err != nil || len(members) == 0 {
+		return
+	}
+
+	run := models.CollectionSummary{
+		CollectionID: collectionID,
+		Language:     latest.Language,
+		Provider:     latest.Provider,
+		Trigger:      models.CollectionTriggerMembers,
+		SubmitterID:  submitterID,
+	}
+	if err := queueCollectionSummary(&run); err != nil {
+		log.Printf("⚠️  Could not queue a new summary of collection %d: %v", collectionID, err)
+		return
+	}
+	log.Printf("Collection %d members changed, summary %d queued", collectionID, run.ID)
+}
+
+// sameID reports whether two optional IDs are equal
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/diff"
+	"pdf-summarizer-backend/models"
+	"time"
+)
+
+// processComparison runs a compare job: the page texts of both PDFs are
+// diffed in Go, then the provider turns the diff into added, removed and
+// changed obligations. The summary is stored under the older PDF and linked
+// to the newer one.
+func processComparison(job *models.SummarizationJob) error {
+	if job.ComparePDFFileID == nil {
+		return failJob(job, ai.Permanent(ai.CodeFileNotFound, "compare job %d has no second PDF", job.ID))
+	}
+	var newer models.PDFFile
+	if err := database.DB.First(&newer, *job.ComparePDFFileID).Error; err != nil {
+		return failJob(job, ai.Permanent(ai.CodeFileNotFound, "PDF %d to compare with not found", *job.ComparePDFFileID))
+	}
+	if budgetExceeded(job) {
+		return failJob(job, errBudgetExceeded(job))
+	}
+
+	startTime := time.Now()
+	oldPages, err := pdfPages(&job.PDFFile)
+	if err != nil {
+		return failJob(job, err)
+	}
+	newPages, err := pdfPages(&newer)
+	if err != nil {
+		return failJob(job, err)
+	}
+
+	result := diff.Pages(oldPages, newPages)
+	log.Printf("Job %d: %d differences between PDF %d and PDF %d (+%d/-%d lines)",
+		job.ID, len(result.Hunks), job.PDFFileID, newer.ID, result.AddedLines, result.RemovedLines)
+
+	req := ai.CompareRequest{
+		OldName:  job.PDFFile.OriginalFilename,
+		NewName:  newer.OriginalFilename,
+		Diff:     result,
+		Language: job.Language,
+	}
+
+	// Identical documents have nothing for a model to summarize
+	providerName := job.Provider
+	if result.Empty() {
+		providerName = ai.ProviderExtractive
+	}
+
+	comparison, usage, err := callAICompare(providerName, req)
+	recordJobUsage(job, usage)
+	if err != nil {
+		return failJob(job, err)
+	}
+
+	data, err := json.Marshal(comparison)
+	if err != nil {
+		return failJob(job, err)
+	}
+	comparisonJSON := string(data)
+
+	summaryLog := models.SummaryLog{
+		PDFFileID:      job.PDFFileID,
+		Mode:           models.ModeCompare,
+		Language:       job.Language,
+		SummaryText:    &comparison.Summary,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		Provider:       comparison.Provider, // The provider that ran, extractive when it stood in
+		Extractive:     comparison.Provider == ai.ProviderExtractive,
+
+		AIModel:          job.AIModel,
+		PromptTokens:     job.PromptTokens,
+		CompletionTokens: job.CompletionTokens,
+		Cost:             job.Cost,
+		TokensEstimated:  job.TokensEstimated,
+
+		ComparePDFFileID: &newer.ID,
+		Comparison:       &comparisonJSON,
+	}
+
+	return completeJob(job, &summaryLog)
+}
+
+// callAICompare summarizes a diff with the named provider, falling back to
+// the extractive listing of the diff while the provider's circuit is open.
+// The response names the provider that ran.
+func callAICompare(providerName string, req ai.CompareRequest) (*ai.CompareResponse, aiUsage, error) {
+	provider, err := ai.Get(providerName)
+	if err != nil {
+		return nil, aiUsage{}, err
+	}
+
+	acquireAISlot()
+	defer releaseAISlot()
+
+	ran := provider.Name()
+	resp, err := provider.Compare(context.Background(), req)
+	if fallback, ok := extractiveFallback(err); ok {
+		log.Printf("⚠️  %s circuit open, listing the differences extractively", provider.Name())
+		ran = fallback.Name()
+		resp, err = fallback.Compare(context.Background(), req)
+	}
+	if err != nil {
+		return nil, aiUsage{}, err
+	}
+	if resp.Provider == "" {
+		resp.Provider = ran
+	}
+
+	// Lists come back empty rather than null
+	for _, list := range []*[]ai.Change{&resp.Added, &resp.Removed, &resp.Changed} {
+		if *list == nil {
+			*list = []ai.Change{}
+		}
+	}
+	return resp, usageOf(charUsage(resp.Usage, diffChars(req.Diff), resp), resp), nil
+}
+
+// diffChars counts the characters of the differences sent to the provider
+func diffChars(result *diff.Result) int {
+	chars := 0
+	for _, hunk := range result.Hunks {
+		chars += len(hunk.Section) + textChars(hunk.Old...) + textChars(hunk.New...)
+	}
+	return chars
+}
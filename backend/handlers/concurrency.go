@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"pdf-summarizer-backend/config"
+	"sync"
+)
+
+var (
+	aiSlots     chan struct{}
+	aiSlotsOnce sync.Once
+)
+
+// acquireAISlot blocks until a process-wide AI call slot is free (AI_MAX_CONCURRENCY)
+func acquireAISlot() {
+	aiSlotsOnce.Do(func() {
+		aiSlots = make(chan struct{}, config.AppConfig.AIMaxConcurrency)
+	})
+	aiSlots <- struct{}{}
+}
+
+// releaseAISlot frees a slot taken by acquireAISlot
+func releaseAISlot() {
+	<-aiSlots
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/citation"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultTopK = 8
+	maxTopK     = 30
+)
+
+// AskCorpus answers a question from the passages most similar to it across
+// all documents (or the listed ones). Each sentence of the answer cites the
+// documents and pages it is based on, and the retrieval set is logged.
+func AskCorpus(c *fiber.Ctx) error {
+	type AskRequest struct {
+		Question string  `json:"question"`
+		TopK     int     `json:"top_k"`    // optional, default 8
+		PDFIDs   []uint  `json:"pdf_ids"`  // optional, nil = all documents
+		Language *string `json:"language"` // optional, nil = the language of the question
+		Provider string  `json:"provider"` // optional, defaults to AI_PROVIDER
+	}
+
+	var req AskRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	question := strings.TrimSpace(req.Question)
+	if question == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Question is required")
+	}
+	if req.TopK == 0 {
+		req.TopK = defaultTopK
+	}
+	if req.TopK < 1 || req.TopK > maxTopK {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("top_k must be between 1 and %d", maxTopK))
+	}
+
+	provider, err := ai.Get(req.Provider)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+	}
+	embedder, err := ai.DefaultEmbedder()
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+
+	startTime := time.Now()
+	ctx := context.Background()
+
+	// Documents not embedded yet are embedded in the background; the question
+	// is answered from what is embedded now
+	startEmbeddingBackfill(embedder)
+
+	retrieved, err := retrievePassages(ctx, embedder, question, req.TopK, req.PDFIDs)
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+	if len(retrieved) == 0 {
+		return utils.ErrorResponse(c, fiber.StatusUnprocessableEntity, "No embedded document text to answer from yet")
+	}
+	retrievalTime := time.Since(startTime).Seconds()
+
+	// The passages go to the provider as the pages of one document, numbered
+	// by source, so its page markers cite sources
+	sources := make([]ai.Page, len(retrieved))
+	for i, passage := range retrieved {
+		sources[i] = ai.Page{Number: passage.Source, Text: passage.Text}
+	}
+	aiReq := ai.Request{
+		Files:    []ai.File{{Name: "corpus", Pages: sources}},
+		Language: optionalString(req.Language),
+		Question: question,
+	}
+	result, err := ai.Call(ctx, provider, string(models.ModeQA), aiReq)
+	if fallback, ok := extractiveFallback(err); ok {
+		log.Printf("⚠️  %s circuit open, answering extractively", provider.Name())
+		result, err = ai.Call(ctx, fallback, string(models.ModeQA), aiReq)
+	}
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+	if result.QA == nil {
+		return aiErrorResponse(c, fmt.Errorf("provider returned no answer"))
+	}
+	estimateResultUsage(result, requestChars(aiReq))
+	usage := usageOf(result.Usage(), result)
+
+	answer, _ := citation.Strip(result.QA.Answer)
+	record := models.CorpusQuestion{
+		Question:          question,
+		Answer:            answer,
+		Language:          trimmedOrNil(req.Language),
+		TopK:              req.TopK,
+		Retrieved:         jsonValue(retrieved),
+		Citations:         jsonValue(corpusCitations(result.QA.Answer, retrieved)),
+		EmbeddingProvider: embedder.Name(),
+		EmbeddingModel:    embedder.Model(),
+		RetrievalTime:     retrievalTime,
+		ProcessingTime:    time.Since(startTime).Seconds(),
+		Provider:          provider.Name(),
+		PromptTokens:      usage.PromptTokens,
+		CompletionTokens:  usage.CompletionTokens,
+		Cost:              usage.Cost(),
+		TokensEstimated:   usage.Estimated,
+		Extractive:        result.Provider() == ai.ProviderExtractive,
+		SubmitterID:       utils.ClientID(c),
+	}
+	if len(req.PDFIDs) > 0 {
+		record.PDFFileIDs = jsonValue(req.PDFIDs)
+	}
+	if usage.Model != "" {
+		record.AIModel = &usage.Model
+	}
+
+	if err := database.DB.Create(&record).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to save answer")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Question answered successfully", newCorpusQuestionResponse(&record))
+}
+
+// ListCorpusQuestions lists earlier corpus questions, newest first, without
+// their retrieval sets
+func ListCorpusQuestions(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var questions []models.CorpusQuestion
+	if err := database.DB.Omit("retrieved").
+		Order("created_at DESC").
+		Limit(limit).Offset((page - 1) * limit).
+		Find(&questions).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch questions")
+	}
+
+	responses := []models.CorpusQuestionResponse{}
+	for i := range questions {
+		responses = append(responses, newCorpusQuestionResponse(&questions[i]))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Questions fetched successfully", responses)
+}
+
+// GetCorpusQuestion returns a corpus question with its answer and retrieval set
+func GetCorpusQuestion(c *fiber.Ctx) error {
+	var question models.CorpusQuestion
+	if err := database.DB.First(&question, c.Params("questionId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Question not found")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Question fetched successfully", newCorpusQuestionResponse(&question))
+}
+
+// EmbedPDF (re-)embeds the passages of a PDF with the deployment's embedding provider
+func EmbedPDF(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+	embedder, err := ai.DefaultEmbedder()
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+
+	embedMu.Lock()
+	count, err := embedPDF(context.Background(), embedder, &pdf)
+	embedMu.Unlock()
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "PDF embedded successfully", fiber.Map{
+		"pdf_file_id":        pdf.ID,
+		"passages":           count,
+		"embedding_provider": embedder.Name(),
+		"embedding_model":    embedder.Model(),
+	})
+}
+
+// corpusCitations parses the source markers of answer, checks each sentence
+// against the passages it cites and resolves the sources to documents and pages
+func corpusCitations(answer string, retrieved []models.RetrievedPassage) []models.CorpusCitation {
+	texts := make([]string, len(retrieved))
+	for i, passage := range retrieved {
+		texts[i] = passage.Text
+	}
+	report := citation.Report{Answer: citation.Sentences(answer)}
+	report.Verify(texts)
+
+	citations := make([]models.CorpusCitation, 0, len(report.Answer))
+	for _, sentence := range report.Answer {
+		cited := models.CorpusCitation{Text: sentence.Text, Sources: []models.CitedPage{}, Supported: sentence.Supported, Score: sentence.Score}
+		for _, source := range sentence.Pages {
+			if source < 1 || source > len(retrieved) {
+				continue
+			}
+			passage := retrieved[source-1]
+			cited.Sources = append(cited.Sources, models.CitedPage{
+				Source:     source,
+				PDFFileID:  passage.PDFFileID,
+				Filename:   passage.Filename,
+				PageNumber: passage.PageNumber,
+			})
+		}
+		switch {
+		case len(cited.Sources) == 0:
+			cited.Supported, cited.Reason = false, "no retrieved passage cited"
+		case !cited.Supported:
+			cited.Reason = "not found in the cited passages"
+		}
+		citations = append(citations, cited)
+	}
+	return citations
+}
+
+func newCorpusQuestionResponse(question *models.CorpusQuestion) models.CorpusQuestionResponse {
+	return models.CorpusQuestionResponse{
+		ID:                question.ID,
+		Question:          question.Question,
+		Answer:            question.Answer,
+		Language:          question.Language,
+		PDFFileIDs:        rawJSON(question.PDFFileIDs),
+		TopK:              question.TopK,
+		Retrieved:         rawJSON(question.Retrieved),
+		Citations:         rawJSON(question.Citations),
+		EmbeddingProvider: question.EmbeddingProvider,
+		EmbeddingModel:    question.EmbeddingModel,
+		RetrievalTime:     question.RetrievalTime,
+		ProcessingTime:    question.ProcessingTime,
+		Provider:          question.Provider,
+		AIModel:           question.AIModel,
+		PromptTokens:      question.PromptTokens,
+		CompletionTokens:  question.CompletionTokens,
+		Cost:              question.Cost,
+		TokensEstimated:   question.TokensEstimated,
+		Extractive:        question.Extractive,
+		CreatedAt:         question.CreatedAt,
+	}
+}
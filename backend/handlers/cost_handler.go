@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// costSources - Every stored run of an AI call with its usage: summarization
+// jobs, thread answers, corpus questions, collection summaries and tagging.
+// Reused results cost nothing and are left out. mode is the job mode, or
+// thread, corpus, collection or tagging; pdf_file_id is NULL when a run spans
+// documents.
+const costSources = `SELECT created_at, CAST(mode AS TEXT) AS mode, pdf_file_id, prompt_tokens, completion_tokens, cost
+		FROM summarization_jobs WHERE cache_hit = false AND deleted_at IS NULL
+	UNION ALL
+	SELECT m.created_at, 'thread', t.pdf_file_id, m.prompt_tokens, m.completion_tokens, m.cost
+		FROM qa_messages m JOIN qa_threads t ON t.id = m.thread_id WHERE m.deleted_at IS NULL
+	UNION ALL
+	SELECT created_at, 'corpus', NULL, prompt_tokens, completion_tokens, cost FROM corpus_questions
+	UNION ALL
+	SELECT created_at, 'collection', NULL, prompt_tokens, completion_tokens, cost
+		FROM collection_summaries WHERE cache_hit = false
+	UNION ALL
+	SELECT created_at, 'tagging', pdf_file_id, prompt_tokens, completion_tokens, cost FROM tagging_runs`
+
+// CostBucket - AI usage summed over one group of runs
+type CostBucket struct {
+	Key              string  `json:"key"`
+	Label            string  `json:"label,omitempty"`
+	Jobs             int64   `json:"jobs"` // Runs: jobs, answers, collection summaries and tagging calls
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// GetCostsByDay sums AI cost per day
+func GetCostsByDay(c *fiber.Ctx) error {
+	return costReport(c, "TO_CHAR(DATE(spend.created_at), 'YYYY-MM-DD')", "")
+}
+
+// GetCostsByMode sums AI cost per summarization mode, plus thread, corpus,
+// collection and tagging
+func GetCostsByMode(c *fiber.Ctx) error {
+	return costReport(c, "spend.mode", "")
+}
+
+// GetCostsByDocument sums AI cost per PDF; runs across documents (corpus
+// questions, collection summaries) are keyed "none"
+func GetCostsByDocument(c *fiber.Ctx) error {
+	return costReport(c, "COALESCE(CAST(spend.pdf_file_id AS TEXT), 'none')", "COALESCE(pdf_files.original_filename, '')")
+}
+
+// costReport groups AI usage by keyExpr, filtered by ?from= and ?to= (YYYY-MM-DD, inclusive)
+func costReport(c *fiber.Ctx, keyExpr, labelExpr string) error {
+	query := database.DB.Table("(" + costSources + ") AS spend")
+
+	query, err := filterCostDates(c, query)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+	}
+
+	label := "''"
+	group := keyExpr
+	if labelExpr != "" {
+		query = query.Joins("LEFT JOIN pdf_files ON pdf_files.id = spend.pdf_file_id")
+		label = labelExpr
+		group = keyExpr + ", " + labelExpr
+	}
+
+	var buckets []CostBucket
+	if err := query.
+		Select(keyExpr + " AS key, " + label + " AS label, COUNT(*) AS jobs, " +
+			"SUM(spend.prompt_tokens) AS prompt_tokens, " +
+			"SUM(spend.completion_tokens) AS completion_tokens, " +
+			"SUM(spend.cost) AS cost").
+		Group(group).
+		Order("key").
+		Scan(&buckets).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to aggregate costs")
+	}
+
+	total := CostBucket{Key: "total"}
+	for _, bucket := range buckets {
+		total.Jobs += bucket.Jobs
+		total.PromptTokens += bucket.PromptTokens
+		total.CompletionTokens += bucket.CompletionTokens
+		total.Cost += bucket.Cost
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Costs fetched successfully", fiber.Map{
+		"buckets": buckets,
+		"total":   total,
+	})
+}
+
+// filterCostDates applies the optional from/to query parameters
+func filterCostDates(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if from := c.Query("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("spend.created_at >= ?", day)
+	}
+	if to := c.Query("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("spend.created_at < ?", day.AddDate(0, 0, 1))
+	}
+	return query, nil
+}
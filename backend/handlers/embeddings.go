@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// passageWords - Length of an embedded passage; pages are split into passages
+	passageWords = 150
+
+	// passageOverlap - Words a passage repeats from the one before it on the same page
+	passageOverlap = 30
+
+	// embedBatchSize - Passages embedded per provider call
+	embedBatchSize = 32
+
+	// embedRetryBase, embedRetryMax - Backoff after failed embedding attempts,
+	// doubling per failure
+	embedRetryBase = time.Minute
+	embedRetryMax  = 24 * time.Hour
+)
+
+// embedMu serializes embedding PDFs, so the backfill, uploads and re-embeds
+// do not embed the same PDF twice
+var embedMu sync.Mutex
+
+// backfilling is set while a backfill runs; further requests for one are dropped
+var backfilling atomic.Bool
+
+// rankedChunk - A chunk embedding and its similarity to a question
+type rankedChunk struct {
+	ID    uint
+	Score float64
+}
+
+// passages splits the text of a page into overlapping runs of passageWords words
+func passages(text string) []string {
+	words := strings.Fields(text)
+	var result []string
+	for start := 0; start < len(words); start += passageWords - passageOverlap {
+		end := min(start+passageWords, len(words))
+		result = append(result, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+	}
+	return result
+}
+
+// embedPDF splits the pages of pdf into passages and stores their embeddings,
+// replacing those of the same embedding model. It returns the number of
+// passages. The outcome is recorded in pdf_embeddings either way.
+func embedPDF(ctx context.Context, embedder ai.Embedder, pdf *models.PDFFile) (int, error) {
+	count, err := embedPages(ctx, embedder, pdf)
+	if err != nil {
+		recordEmbedFailure(embedder, pdf.ID, err)
+	}
+	return count, err
+}
+
+func embedPages(ctx context.Context, embedder ai.Embedder, pdf *models.PDFFile) (int, error) {
+	pages, err := pageTexts(pdf, "")
+	if err != nil {
+		return 0, err
+	}
+
+	var chunks []models.ChunkEmbedding
+	var texts []string
+	for _, page := range pages {
+		for position, text := range passages(page.Text) {
+			chunks = append(chunks, models.ChunkEmbedding{
+				PDFFileID:         pdf.ID,
+				PageNumber:        page.Number,
+				Position:          position,
+				Text:              text,
+				EmbeddingProvider: embedder.Name(),
+				EmbeddingModel:    embedder.Model(),
+			})
+			texts = append(texts, text)
+		}
+	}
+
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(texts))
+		vectors, err := embedder.Embed(ctx, texts[start:end])
+		if err != nil {
+			return 0, err
+		}
+		for i, vector := range vectors {
+			chunks[start+i].Embedding = vector
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pdf_file_id = ? AND embedding_provider = ? AND embedding_model = ?", pdf.ID, embedder.Name(), embedder.Model()).
+			Delete(&models.ChunkEmbedding{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) > 0 {
+			if err := tx.CreateInBatches(chunks, 100).Error; err != nil {
+				return err
+			}
+		}
+
+		// A PDF without text counts as embedded too, so it is not tried again
+		now := time.Now()
+		return tx.Save(&models.PDFEmbedding{
+			PDFFileID:         pdf.ID,
+			EmbeddingProvider: embedder.Name(),
+			EmbeddingModel:    embedder.Model(),
+			Passages:          len(chunks),
+			EmbeddedAt:        &now,
+		}).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store embeddings of PDF %d: %w", pdf.ID, err)
+	}
+
+	log.Printf("PDF %d: %d passages embedded with %s (%s)", pdf.ID, len(chunks), embedder.Name(), embedder.Model())
+	return len(chunks), nil
+}
+
+// recordEmbedFailure counts a failed attempt to embed a PDF and sets when the
+// backfill may try it again
+func recordEmbedFailure(embedder ai.Embedder, pdfID uint, cause error) {
+	state := models.PDFEmbedding{PDFFileID: pdfID, EmbeddingProvider: embedder.Name(), EmbeddingModel: embedder.Model()}
+	database.DB.Where(&state).Limit(1).Find(&state)
+
+	state.Failures++
+	delay := embedRetryMax
+	if state.Failures < 12 {
+		delay = min(embedRetryBase<<(state.Failures-1), embedRetryMax)
+	}
+	retryAt := time.Now().Add(delay)
+	errMsg := cause.Error()
+	state.ErrorMsg = &errMsg
+	state.RetryAt = &retryAt
+
+	if err := database.DB.Save(&state).Error; err != nil {
+		log.Printf("⚠️  Could not record the embedding failure of PDF %d: %v", pdfID, err)
+	}
+}
+
+// embedAfterUpload embeds a newly uploaded PDF in the background; a failure
+// leaves it to the backfill
+func embedAfterUpload(pdf models.PDFFile) {
+	embedder, err := ai.DefaultEmbedder()
+	if err != nil {
+		return
+	}
+
+	embedMu.Lock()
+	defer embedMu.Unlock()
+	if _, err := embedPDF(context.Background(), embedder, &pdf); err != nil {
+		log.Printf("⚠️  Could not embed PDF %d: %v", pdf.ID, err)
+	}
+}
+
+// startEmbeddingBackfill embeds, in the background, the PDFs that have no
+// embeddings of embedder's model yet: documents uploaded before embeddings
+// existed, or whose embedding failed and is due for another attempt. PDFs
+// known to have no text are skipped. Only one backfill runs at a time.
+func startEmbeddingBackfill(embedder ai.Embedder) {
+	if !backfilling.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer backfilling.Store(false)
+
+		var pdfs []models.PDFFile
+		err := database.DB.
+			Where("COALESCE(word_count, -1) <> 0").
+			Where("NOT EXISTS (SELECT 1 FROM pdf_embeddings e WHERE e.pdf_file_id = pdf_files.id AND e.embedding_provider = ? AND e.embedding_model = ? AND (e.embedded_at IS NOT NULL OR e.retry_at > ?))",
+				embedder.Name(), embedder.Model(), time.Now()).
+			Where("NOT EXISTS (SELECT 1 FROM chunk_embeddings c WHERE c.pdf_file_id = pdf_files.id AND c.embedding_provider = ? AND c.embedding_model = ?)",
+				embedder.Name(), embedder.Model()).
+			Order("id ASC").
+			Find(&pdfs).Error
+		if err != nil {
+			log.Printf("⚠️  Could not look up PDFs to embed: %v", err)
+			return
+		}
+
+		for i := range pdfs {
+			embedMu.Lock()
+			_, err := embedPDF(context.Background(), embedder, &pdfs[i])
+			embedMu.Unlock()
+			if err != nil {
+				log.Printf("⚠️  Could not embed PDF %d: %v", pdfs[i].ID, err)
+			}
+		}
+	}()
+}
+
+// retrievePassages returns the topK passages most similar to question,
+// among the documents in pdfIDs (nil = all), best first
+func retrievePassages(ctx context.Context, embedder ai.Embedder, question string, topK int, pdfIDs []uint) ([]models.RetrievedPassage, error) {
+	vectors, err := embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, ai.Transient(ai.CodeBadResponse, "expected 1 embedding, got %d", len(vectors))
+	}
+
+	scope := func() *gorm.DB {
+		query := database.DB.Table("chunk_embeddings c").
+			Joins("JOIN pdf_files f ON f.id = c.pdf_file_id AND f.deleted_at IS NULL").
+			Where("c.embedding_provider = ? AND c.embedding_model = ?", embedder.Name(), embedder.Model())
+		if len(pdfIDs) > 0 {
+			query = query.Where("c.pdf_file_id IN ?", pdfIDs)
+		}
+		return query
+	}
+
+	var ranked []rankedChunk
+	if database.VectorSearch {
+		ranked, err = rankInPostgres(scope(), models.Vector(vectors[0]), topK)
+	} else {
+		ranked, err = rankInGo(scope(), vectors[0], topK)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank passages: %w", err)
+	}
+	if len(ranked) == 0 {
+		return []models.RetrievedPassage{}, nil
+	}
+
+	ids := make([]uint, len(ranked))
+	for i, chunk := range ranked {
+		ids[i] = chunk.ID
+	}
+	var rows []struct {
+		ID         uint
+		PDFFileID  uint
+		PageNumber int
+		Text       string
+		Filename   string
+	}
+	if err := database.DB.Table("chunk_embeddings c").
+		Select("c.id, c.pdf_file_id, c.page_number, c.text, f.original_filename AS filename").
+		Joins("JOIN pdf_files f ON f.id = c.pdf_file_id").
+		Where("c.id IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load passages: %w", err)
+	}
+	byID := make(map[uint]int, len(rows))
+	for i, row := range rows {
+		byID[row.ID] = i
+	}
+
+	result := make([]models.RetrievedPassage, 0, len(ranked))
+	for _, chunk := range ranked {
+		i, ok := byID[chunk.ID]
+		if !ok {
+			continue // Re-embedded meanwhile
+		}
+		result = append(result, models.RetrievedPassage{
+			Source:     len(result) + 1,
+			ChunkID:    chunk.ID,
+			PDFFileID:  rows[i].PDFFileID,
+			Filename:   rows[i].Filename,
+			PageNumber: rows[i].PageNumber,
+			Score:      chunk.Score,
+			Text:       rows[i].Text,
+		})
+	}
+	return result, nil
+}
+
+// rankInPostgres orders the chunks of scope by cosine distance with pgvector
+func rankInPostgres(scope *gorm.DB, query models.Vector, topK int) ([]rankedChunk, error) {
+	var ranked []rankedChunk
+	err := scope.
+		Select("c.id, 1 - (c.embedding_vector <=> CAST(? AS vector)) AS score", query.PGVector()).
+		Order("score DESC").
+		Limit(topK).
+		Scan(&ranked).Error
+	return ranked, err
+}
+
+// rankInGo streams the embeddings of scope and keeps the topK most similar
+func rankInGo(scope *gorm.DB, query []float32, topK int) ([]rankedChunk, error) {
+	rows, err := scope.Select("c.id, c.embedding").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranked := make([]rankedChunk, 0, topK+1)
+	for rows.Next() {
+		var (
+			id        uint
+			embedding models.Vector
+		)
+		if err := rows.Scan(&id, &embedding); err != nil {
+			return nil, err
+		}
+
+		score := ai.Cosine(query, embedding)
+		if len(ranked) == topK && score <= ranked[topK-1].Score {
+			continue
+		}
+		at := sort.Search(len(ranked), func(i int) bool { return ranked[i].Score < score })
+		ranked = append(ranked, rankedChunk{})
+		copy(ranked[at+1:], ranked[at:])
+		ranked[at] = rankedChunk{ID: id, Score: score}
+		if len(ranked) > topK {
+			ranked = ranked[:topK]
+		}
+	}
+	return ranked, rows.Err()
+}
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"pdf-summarizer-backend/ai"
 	"pdf-summarizer-backend/database"
 	"pdf-summarizer-backend/models"
 	"pdf-summarizer-backend/queue"
 	"pdf-summarizer-backend/utils"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -20,10 +23,16 @@ func CreateSummarizationJob(c *fiber.Ctx) error {
 
 	// Get request body
 	type JobRequest struct {
-		Mode     string  `json:"mode"`     // simple, structured, multi, qa
-		Language *string `json:"language"` // optional
-		Pages    *string `json:"pages"`    // optional
-		Question *string `json:"question"` // required for qa mode
+		Mode       string          `json:"mode"`           // simple, structured, multi, qa, extractive, extract, compare
+		Language   *string         `json:"language"`       // optional
+		Pages      *string         `json:"pages"`          // optional
+		Question   *string         `json:"question"`       // required for qa mode
+		BudgetUSD  *float64        `json:"budget_usd"`     // optional cost cap
+		Provider   string          `json:"provider"`       // optional, defaults to AI_PROVIDER
+		TemplateID *uint           `json:"template_id"`    // optional custom prompt template
+		Schema     json.RawMessage `json:"schema"`         // JSON Schema, required for extract mode
+		Style      *ai.Style       `json:"style"`          // optional length, audience, tone and format
+		CompareTo  *uint           `json:"compare_pdf_id"` // newer version of the document, required for compare mode
 	}
 
 	var req JobRequest
@@ -33,7 +42,7 @@ func CreateSummarizationJob(c *fiber.Ctx) error {
 
 	// Validate mode
 	validModes := map[string]bool{
-		"simple": true, "structured": true, "multi": true, "qa": true,
+		"simple": true, "structured": true, "multi": true, "qa": true, "extractive": true, "extract": true, "compare": true,
 	}
 	if !validModes[req.Mode] {
 		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid mode")
@@ -44,11 +53,60 @@ func CreateSummarizationJob(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Question is required for QA mode")
 	}
 
+	// Compare mode diffs the whole of both documents with the built-in prompt
+	if req.Mode == string(models.ModeCompare) {
+		if req.CompareTo == nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "compare_pdf_id is required for compare mode")
+		}
+		if req.Pages != nil || req.Question != nil || req.TemplateID != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "pages, question and template_id are not used by compare mode")
+		}
+	} else if req.CompareTo != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "compare_pdf_id is only used by compare mode")
+	}
+
+	if req.BudgetUSD != nil && *req.BudgetUSD <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "budget_usd must be greater than 0")
+	}
+
+	schema, err := extractSchema(req.Mode, req.Schema)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	style, err := summaryStyle(req.Mode, req.Style)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	// Extractive mode runs in-process, whatever provider was requested
+	if req.Mode == string(models.ModeExtractive) {
+		req.Provider = ai.ProviderExtractive
+	}
+
+	provider, err := ai.Get(req.Provider)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+	}
+
 	// Check if PDF exists
 	var pdf models.PDFFile
 	if err := database.DB.First(&pdf, pdfID).Error; err != nil {
 		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
 	}
+	if req.CompareTo != nil {
+		if *req.CompareTo == pdf.ID {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "compare_pdf_id must be a different PDF")
+		}
+		var other models.PDFFile
+		if err := database.DB.First(&other, *req.CompareTo).Error; err != nil {
+			return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF to compare with not found")
+		}
+	}
+
+	// Scanned pages are reported now rather than by a failed job
+	if message := noTextMessage(&pdf, req.Pages); message != "" {
+		return utils.ErrorResponse(c, fiber.StatusUnprocessableEntity, message)
+	}
 
 	// Get language
 	language := "english"
@@ -56,15 +114,58 @@ func CreateSummarizationJob(c *fiber.Ctx) error {
 		language = *req.Language
 	}
 
+	// Pin the template's current version so the job is reproducible
+	var templateVersion *int
+	if req.TemplateID != nil {
+		template, err := resolveTemplate(*req.TemplateID, req.Mode, language)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+		templateVersion = &template.Version
+	}
+
 	// Create job
 	job := models.SummarizationJob{
-		PDFFileID:  pdf.ID,
-		Status:     models.JobStatusPending,
-		Mode:       models.SummaryMode(req.Mode),
-		Language:   language,
-		Pages:      req.Pages,
-		Question:   req.Question,
-		MaxRetries: 3,
+		PDFFileID:   pdf.ID,
+		Status:      models.JobStatusPending,
+		Mode:        models.SummaryMode(req.Mode),
+		Language:    language,
+		Pages:       req.Pages,
+		Question:    req.Question,
+		SubmitterID: utils.ClientID(c),
+		Provider:    provider.Name(),
+		MaxRetries:  3,
+		BudgetCap:   req.BudgetUSD,
+
+		TemplateID:      req.TemplateID,
+		TemplateVersion: templateVersion,
+		ExtractSchema:   schema,
+		Style:           style,
+
+		ComparePDFFileID: req.CompareTo,
+	}
+
+	// Reuse identical work unless the caller forces a fresh run
+	if !c.QueryBool("force") {
+		if cached, err := findCachedSummary(&job); err == nil {
+			now := time.Now()
+			job.Status = models.JobStatusCompleted
+			job.StartedAt = &now
+			job.CompletedAt = &now
+			job.SummaryLogID = &cached.ID
+			job.CacheHit = true
+
+			if err := database.DB.Create(&job).Error; err != nil {
+				return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create job")
+			}
+
+			log.Printf("Job %d served from cached summary %d", job.ID, cached.ID)
+			return utils.SuccessResponse(c, fiber.StatusOK, "Identical summary found. Returning cached result.", newJobResponse(&job, pdf.OriginalFilename))
+		}
+
+		if existing, err := findInFlightJob(&job); err == nil {
+			return utils.SuccessResponse(c, fiber.StatusOK, "Identical job already in progress.", newJobResponse(existing, pdf.OriginalFilename))
+		}
 	}
 
 	if err := database.DB.Create(&job).Error; err != nil {
@@ -72,38 +173,16 @@ func CreateSummarizationJob(c *fiber.Ctx) error {
 	}
 
 	// Publish job to RabbitMQ queue
-	if err := queue.PublishJob(job.ID); err != nil {
+	if err := queue.PublishJob(job.ID, job.SubmitterID, job.Provider); err != nil {
 		log.Printf("Failed to publish job to queue: %v", err)
 		// Job is created but not queued - can be retried manually
 	}
 
-	// Return job info
-	response := models.JobResponse{
-		ID:          job.ID,
-		PDFFileID:   job.PDFFileID,
-		Status:      job.Status,
-		Mode:        job.Mode,
-		Language:    job.Language,
-		Pages:       job.Pages,
-		Question:    job.Question,
-		RetryCount:  job.RetryCount,
-		MaxRetries:  job.MaxRetries,
-		CreatedAt:   job.CreatedAt,
-		PDFFilename: pdf.OriginalFilename,
-	}
-
-	return utils.SuccessResponse(c, fiber.StatusCreated, "Job created successfully. Processing will start shortly.", response)
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Job created successfully. Processing will start shortly.", newJobResponse(&job, pdf.OriginalFilename))
 }
 
-// GetJob returns job status
-func GetJob(c *fiber.Ctx) error {
-	jobID := c.Params("jobId")
-
-	var job models.SummarizationJob
-	if err := database.DB.Preload("PDFFile").Preload("SummaryLog").First(&job, jobID).Error; err != nil {
-		return utils.ErrorResponse(c, fiber.StatusNotFound, "Job not found")
-	}
-
+// newJobResponse builds the API representation of a job
+func newJobResponse(job *models.SummarizationJob, pdfFilename string) models.JobResponse {
 	response := models.JobResponse{
 		ID:           job.ID,
 		PDFFileID:    job.PDFFileID,
@@ -112,19 +191,85 @@ func GetJob(c *fiber.Ctx) error {
 		Language:     job.Language,
 		Pages:        job.Pages,
 		Question:     job.Question,
+		Provider:     job.Provider,
 		RetryCount:   job.RetryCount,
 		MaxRetries:   job.MaxRetries,
 		ErrorMsg:     job.ErrorMsg,
 		SummaryLogID: job.SummaryLogID,
+		CacheHit:     job.CacheHit,
 		StartedAt:    job.StartedAt,
 		CompletedAt:  job.CompletedAt,
 		CreatedAt:    job.CreatedAt,
-		PDFFilename:  job.PDFFile.OriginalFilename,
+		PDFFilename:  pdfFilename,
+
+		LastProcessedPage: job.LastProcessedPage,
+		TotalPages:        job.TotalPages,
+
+		PromptTokens:     job.PromptTokens,
+		CompletionTokens: job.CompletionTokens,
+		Cost:             job.Cost,
+		BudgetCap:        job.BudgetCap,
+		AIModel:          job.AIModel,
+		TokensEstimated:  job.TokensEstimated,
+
+		TemplateID:      job.TemplateID,
+		TemplateVersion: job.TemplateVersion,
+		ExtractSchema:   rawJSON(job.ExtractSchema),
+		SourceSummaryID: job.SourceSummaryID,
+		Style:           rawJSON(job.Style),
+
+		ComparePDFFileID: job.ComparePDFFileID,
 	}
 
+	// Chunk progress from job_chunks
+	if !job.CacheHit {
+		if progress := GetChunkProgress(job.ID); progress.Total > 0 {
+			response.Progress = fmt.Sprintf("%d/%d chunks", progress.Completed, progress.Total)
+			response.CompletedChunks = progress.Completed
+			response.FailedChunks = progress.Failed
+			response.TotalChunks = progress.Total
+		}
+	}
+
+	return response
+}
+
+// GetJob returns job status
+func GetJob(c *fiber.Ctx) error {
+	jobID := c.Params("jobId")
+
+	var job models.SummarizationJob
+	if err := database.DB.Preload("PDFFile").Preload("SummaryLog").First(&job, jobID).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Job not found")
+	}
+
+	response := newJobResponse(&job, job.PDFFile.OriginalFilename)
+
 	return utils.SuccessResponse(c, fiber.StatusOK, "Job fetched successfully", response)
 }
 
+// ListJobChunks returns the per-chunk state of a job (page range, status, attempts, latency, result)
+func ListJobChunks(c *fiber.Ctx) error {
+	jobID := c.Params("jobId")
+
+	var job models.SummarizationJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Job not found")
+	}
+
+	query := database.DB.Where("job_id = ?", job.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var chunks []models.JobChunk
+	if err := query.Order("chunk_index").Find(&chunks).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch job chunks")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Job chunks fetched successfully", chunks)
+}
+
 // ListJobs returns all jobs with filters
 func ListJobs(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
@@ -150,23 +295,7 @@ func ListJobs(c *fiber.Ctx) error {
 
 	var responses []models.JobResponse
 	for _, job := range jobs {
-		responses = append(responses, models.JobResponse{
-			ID:           job.ID,
-			PDFFileID:    job.PDFFileID,
-			Status:       job.Status,
-			Mode:         job.Mode,
-			Language:     job.Language,
-			Pages:        job.Pages,
-			Question:     job.Question,
-			RetryCount:   job.RetryCount,
-			MaxRetries:   job.MaxRetries,
-			ErrorMsg:     job.ErrorMsg,
-			SummaryLogID: job.SummaryLogID,
-			StartedAt:    job.StartedAt,
-			CompletedAt:  job.CompletedAt,
-			CreatedAt:    job.CreatedAt,
-			PDFFilename:  job.PDFFile.OriginalFilename,
-		})
+		responses = append(responses, newJobResponse(&job, job.PDFFile.OriginalFilename))
 	}
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "Jobs fetched successfully", responses)
@@ -190,6 +319,7 @@ func RetryJob(c *fiber.Ctx) error {
 	job.Status = models.JobStatusPending
 	job.ErrorMsg = nil
 	job.StartedAt = nil
+	job.RetryAt = nil
 
 	if err := database.DB.Save(&job).Error; err != nil {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to retry job")
@@ -234,13 +364,11 @@ func ProcessJob(jobID uint) error {
 
 	// Call AI service (reuse existing logic from summary_handler.go)
 	startTime := time.Now()
-	result, err := callAIService(
-		job.PDFFile.FilePath,
-		string(job.Mode),
-		&job.Language,
-		job.Pages,
-		job.Question,
-	)
+	var result *ai.Result
+	prompt, err := jobPrompt(&job)
+	if err == nil {
+		result, err = callAIService(jobCall(&job, prompt, job.Pages))
+	}
 
 	if err != nil {
 		// Handle error - retry or mark as failed
@@ -271,32 +399,23 @@ func ProcessJob(jobID uint) error {
 		Language:       job.Language,
 		PagesProcessed: job.Pages,
 		ProcessingTime: processingTime,
+		Provider:       job.Provider,
+
+		TemplateID:      job.TemplateID,
+		TemplateVersion: job.TemplateVersion,
+		ExtractSchema:   job.ExtractSchema,
+		Style:           job.Style,
 	}
 
-	// Map result based on mode
-	switch string(job.Mode) {
-	case "simple":
-		if summaryText, ok := result["summary"].(string); ok {
-			summaryLog.SummaryText = &summaryText
-		}
-	case "structured":
-		if execSummary, ok := result["executive_summary"].(string); ok {
-			summaryLog.ExecutiveSummary = &execSummary
-		}
-		if bullets, ok := result["bullets"].([]interface{}); ok {
-			bulletsJSON := fmt.Sprintf("%v", bullets)
-			summaryLog.Bullets = &bulletsJSON
-		}
-		if highlights, ok := result["highlights"].([]interface{}); ok {
-			highlightsJSON := fmt.Sprintf("%v", highlights)
-			summaryLog.Highlights = &highlightsJSON
-		}
-	case "qa":
-		if answer, ok := result["answer"].(string); ok {
-			summaryLog.QAAnswer = &answer
-		}
-		summaryLog.QAQuestion = job.Question
+	applyUsage(&summaryLog, usageOf(result.Usage(), result))
+	if err := applyResult(&summaryLog, result, job.Question); err != nil {
+		errMsg := err.Error()
+		job.ErrorMsg = &errMsg
+		job.Status = models.JobStatusFailed
+		database.DB.Save(&job)
+		return err
 	}
+	summaryLog.Citations = verifyCitations(summaryLog.Citations, &job.PDFFile)
 
 	// Save summary
 	if err := database.DB.Create(&summaryLog).Error; err != nil {
@@ -313,6 +432,6 @@ func ProcessJob(jobID uint) error {
 	job.CompletedAt = &completedAt
 	job.SummaryLogID = &summaryLog.ID
 	database.DB.Save(&job)
-	
+
 	return nil
 }
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// Generated text is written to job_stream_chunks in batches, not per token
+	streamFlushBytes    = 200
+	streamFlushInterval = 250 * time.Millisecond
+
+	// How often an SSE connection checks for new text, and pings an idle client
+	streamPollInterval = 300 * time.Millisecond
+	streamHeartbeat    = 15 * time.Second
+)
+
+// jobStream - Collects the text a job generates and appends it to
+// job_stream_chunks, where any API instance can relay it to clients
+type jobStream struct {
+	mu        sync.Mutex
+	jobID     uint
+	attempt   int
+	offset    int // Bytes already written
+	pending   strings.Builder
+	lastFlush time.Time
+}
+
+// newJobStream starts a new stream attempt for job. Only modes that produce a
+// single text (simple, extractive) are streamed; other modes return nil.
+func newJobStream(job *models.SummarizationJob) *jobStream {
+	if job.Mode != models.ModeSimple && job.Mode != models.ModeExtractive {
+		return nil
+	}
+	return &jobStream{
+		jobID:     job.ID,
+		attempt:   latestStreamAttempt(job.ID) + 1,
+		lastFlush: time.Now(),
+	}
+}
+
+// onToken returns the callback feeding the stream, nil when nothing is streamed
+func (s *jobStream) onToken() ai.TokenFunc {
+	if s == nil {
+		return nil
+	}
+	return s.write
+}
+
+func (s *jobStream) write(delta string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending.WriteString(delta)
+	if s.pending.Len() >= streamFlushBytes || time.Since(s.lastFlush) >= streamFlushInterval {
+		s.flush()
+	}
+}
+
+// restart starts a new stream attempt for a reply that is generated again;
+// clients get a reset event and the new text from offset 0
+func (s *jobStream) restart() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+	s.attempt++
+	s.offset = 0
+}
+
+// Close writes any buffered text
+func (s *jobStream) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+// flush appends the buffered text; on failure it is kept for the next flush. Caller holds mu.
+func (s *jobStream) flush() {
+	s.lastFlush = time.Now()
+	if s.pending.Len() == 0 {
+		return
+	}
+
+	text := s.pending.String()
+	chunk := models.JobStreamChunk{
+		JobID:       s.jobID,
+		Attempt:     s.attempt,
+		StartOffset: s.offset,
+		EndOffset:   s.offset + len(text),
+		Text:        text,
+	}
+	if err := database.DB.Create(&chunk).Error; err != nil {
+		log.Printf("⚠️  Failed to write stream of job %d: %v", s.jobID, err)
+		return
+	}
+	s.offset = chunk.EndOffset
+	s.pending.Reset()
+}
+
+// latestStreamAttempt returns the job's newest stream attempt, 0 if none
+func latestStreamAttempt(jobID uint) int {
+	var attempt int
+	database.DB.Model(&models.JobStreamChunk{}).
+		Where("job_id = ?", jobID).
+		Select("COALESCE(MAX(attempt), 0)").
+		Scan(&attempt)
+	return attempt
+}
+
+// clearJobStream drops a finished job's stream; its text now lives in the summary
+func clearJobStream(jobID uint) {
+	database.DB.Where("job_id = ?", jobID).Delete(&models.JobStreamChunk{})
+}
+
+// StreamJob relays a job's generated text as Server-Sent Events:
+//
+//	event: delta  id: <attempt>:<offset>  data: {"text": "...", "offset": 120}
+//	event: reset  data: {"attempt": 2}  (the job was retried or the reply re-requested, text starts over)
+//	event: done   data: {"job_id": 1, "summary_id": 5, "summary_text": "...", "extractive": false}
+//	event: error  data: {"job_id": 1, "error": "..."}
+//
+// A reconnecting client resumes with the Last-Event-ID header, or with
+// ?offset=<bytes received> (and optionally &attempt=). The done event always
+// carries the complete text, so a client that missed deltas still ends up whole.
+func StreamJob(c *fiber.Ctx) error {
+	jobID, err := strconv.ParseUint(c.Params("jobId"), 10, 64)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid job ID")
+	}
+
+	var job models.SummarizationJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Job not found")
+	}
+
+	attempt, offset := c.QueryInt("attempt", 0), c.QueryInt("offset", 0)
+	if lastEventID := c.Get("Last-Event-ID"); lastEventID != "" {
+		if a, o, ok := parseStreamID(lastEventID); ok {
+			attempt, offset = a, o
+		}
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Don't let nginx buffer the stream
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		relayJobStream(w, uint(jobID), attempt, offset)
+	})
+	return nil
+}
+
+// relayJobStream polls the job and its stream until the job finishes or the client goes away
+func relayJobStream(w *bufio.Writer, jobID uint, attempt, offset int) {
+	lastWrite := time.Now()
+
+	for {
+		// Read the status before the text: the worker flushes all text before
+		// finishing, so a finished status means every chunk is already visible
+		var job models.SummarizationJob
+		if err := database.DB.First(&job, jobID).Error; err != nil {
+			writeEvent(w, "error", "", fiber.Map{"job_id": jobID, "error": "Job not found"})
+			w.Flush()
+			return
+		}
+
+		if latest := latestStreamAttempt(jobID); latest > attempt {
+			if attempt > 0 {
+				writeEvent(w, "reset", "", fiber.Map{"attempt": latest})
+				offset = 0
+			}
+			attempt = latest
+		}
+
+		var chunks []models.JobStreamChunk
+		if attempt > 0 {
+			database.DB.Where("job_id = ? AND attempt = ? AND end_offset > ?", jobID, attempt, offset).
+				Order("start_offset ASC").
+				Find(&chunks)
+		}
+		for _, chunk := range chunks {
+			text := chunk.Text
+			if skip := offset - chunk.StartOffset; skip > 0 {
+				text = text[skip:]
+			}
+			offset = chunk.EndOffset
+			writeEvent(w, "delta", formatStreamID(attempt, offset), fiber.Map{"text": text, "offset": offset})
+		}
+
+		switch job.Status {
+		case models.JobStatusCompleted:
+			done := fiber.Map{"job_id": jobID, "summary_id": job.SummaryLogID}
+			var summary models.SummaryLog
+			if job.SummaryLogID != nil && database.DB.First(&summary, *job.SummaryLogID).Error == nil {
+				done["summary_text"] = summary.SummaryText
+				done["extractive"] = summary.Extractive
+			}
+			writeEvent(w, "done", "", done)
+			w.Flush()
+			return
+
+		case models.JobStatusFailed:
+			writeEvent(w, "error", "", fiber.Map{"job_id": jobID, "error": job.ErrorMsg})
+			w.Flush()
+			return
+		}
+
+		if len(chunks) > 0 {
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= streamHeartbeat {
+			fmt.Fprint(w, ": ping\n\n")
+			lastWrite = time.Now()
+		}
+		if err := w.Flush(); err != nil {
+			return // Client disconnected
+		}
+
+		time.Sleep(streamPollInterval)
+	}
+}
+
+// writeEvent writes one SSE event with a JSON payload
+func writeEvent(w *bufio.Writer, event, id string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// formatStreamID encodes a resume position as the SSE event id
+func formatStreamID(attempt, offset int) string {
+	return fmt.Sprintf("%d:%d", attempt, offset)
+}
+
+// parseStreamID decodes an event id written by formatStreamID
+func parseStreamID(id string) (attempt, offset int, ok bool) {
+	a, o, found := strings.Cut(id, ":")
+	if !found {
+		return 0, 0, false
+	}
+	attempt, errA := strconv.Atoi(a)
+	offset, errO := strconv.Atoi(o)
+	if errA != nil || errO != nil {
+		return 0, 0, false
+	}
+	return attempt, offset, true
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"io"
 	"log"
+	"mime/multipart"
 	"pdf-summarizer-backend/config"
 	"pdf-summarizer-backend/database"
 	"pdf-summarizer-backend/models"
@@ -34,8 +36,16 @@ func UploadPDF(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to upload file to storage")
 	}
 
-	// Extract PDF metadata (total pages) - simplified version
+	// Extract PDF metadata (total pages), used to plan chunked processing
 	var totalPages *int
+	data, err := readUploadedFile(file)
+	if err != nil {
+		log.Printf("Could not read %s: %v", file.Filename, err)
+	} else if count, err := utils.CountPDFPages(data); err != nil {
+		log.Printf("Could not count pages of %s: %v", file.Filename, err)
+	} else {
+		totalPages = &count
+	}
 
 	// Create database record
 	pdfFile := models.PDFFile{
@@ -52,9 +62,30 @@ func UploadPDF(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to save file metadata")
 	}
 
+	// Extract the text of every page once; jobs send it instead of the PDF.
+	// If this fails the first job extracts it.
+	if data != nil {
+		if err := storePDFPages(&pdfFile, data); err != nil {
+			log.Printf("Could not extract the pages of %s: %v", file.Filename, err)
+		} else {
+			go embedAfterUpload(pdfFile)
+		}
+	}
+
 	return utils.SuccessResponse(c, fiber.StatusCreated, "File uploaded successfully", pdfFile)
 }
 
+// readUploadedFile reads the content of the uploaded file
+func readUploadedFile(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return io.ReadAll(src)
+}
+
 // ListPDFs returns list of all uploaded PDFs
 func ListPDFs(c *fiber.Ctx) error {
 	var pdfs []models.PDFFile
@@ -63,10 +94,46 @@ func ListPDFs(c *fiber.Ctx) error {
 	limit, _ := strconv.Atoi(c.Query("limit", "100"))
 	offset := (page - 1) * limit
 
-	if err := database.DB.Order("upload_date DESC").Offset(offset).Limit(limit).Find(&pdfs).Error; err != nil {
+	// ?tag=contract,person:jane doe keeps PDFs carrying every listed tag
+	query := database.DB.Order("upload_date DESC")
+	for _, filter := range strings.Split(c.Query("tag"), ",") {
+		kind, name, found := strings.Cut(filter, ":")
+		if !found {
+			kind, name = "", kind
+		}
+		slug := tagSlug(name)
+		if slug == "" {
+			continue
+		}
+		if kind == "" {
+			query = query.Where("EXISTS (SELECT 1 FROM document_tags t WHERE t.pdf_file_id = pdf_files.id AND t.slug = ? AND t.deleted_at IS NULL)", slug)
+		} else {
+			query = query.Where("EXISTS (SELECT 1 FROM document_tags t WHERE t.pdf_file_id = pdf_files.id AND t.kind = ? AND t.slug = ? AND t.deleted_at IS NULL)", strings.TrimSpace(kind), slug)
+		}
+	}
+
+	if collectionID := c.Query("collection_id"); collectionID != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM collection_members m WHERE m.pdf_file_id = pdf_files.id AND m.collection_id = ?)", collectionID)
+	}
+
+	if err := query.Offset(offset).Limit(limit).Find(&pdfs).Error; err != nil {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch PDFs")
 	}
 
+	// Tags of all listed PDFs in one query
+	ids := make([]uint, len(pdfs))
+	for i, pdf := range pdfs {
+		ids[i] = pdf.ID
+	}
+	var tags []models.DocumentTag
+	if len(ids) > 0 {
+		database.DB.Where("pdf_file_id IN ?", ids).Order("kind ASC, score DESC, name ASC").Find(&tags)
+	}
+	tagsByPDF := make(map[uint][]models.DocumentTag)
+	for _, tag := range tags {
+		tagsByPDF[tag.PDFFileID] = append(tagsByPDF[tag.PDFFileID], tag)
+	}
+
 	// Add summary count for each PDF
 	var responses []models.PDFFileResponse
 	for _, pdf := range pdfs {
@@ -79,6 +146,8 @@ func ListPDFs(c *fiber.Ctx) error {
 			FileSize:         pdf.FileSize,
 			FileSizeMB:       utils.GetFileSizeMB(pdf.FileSize),
 			TotalPages:       pdf.TotalPages,
+			WordCount:        pdf.WordCount,
+			ImageOnlyPages:   pdf.ImageOnlyPages,
 			UploadDate:       pdf.UploadDate,
 			UploadedAt:       pdf.UploadDate,
 			Mode:             pdf.Mode,
@@ -93,6 +162,7 @@ func ListPDFs(c *fiber.Ctx) error {
 			ProcessingTime:   pdf.ProcessingTime,
 			LastSummarizedAt: pdf.LastSummarizedAt,
 			SummaryCount:     summaryCount,
+			Tags:             append([]models.DocumentTag{}, tagsByPDF[pdf.ID]...),
 		})
 	}
 
@@ -117,6 +187,8 @@ func GetPDF(c *fiber.Ctx) error {
 		FileSize:         pdf.FileSize,
 		FileSizeMB:       utils.GetFileSizeMB(pdf.FileSize),
 		TotalPages:       pdf.TotalPages,
+		WordCount:        pdf.WordCount,
+		ImageOnlyPages:   pdf.ImageOnlyPages,
 		UploadDate:       pdf.UploadDate,
 		UploadedAt:       pdf.UploadDate,
 		Mode:             pdf.Mode,
@@ -132,6 +204,9 @@ func GetPDF(c *fiber.Ctx) error {
 		LastSummarizedAt: pdf.LastSummarizedAt,
 		SummaryCount:     summaryCount,
 	}
+	if tags, err := documentTags(pdf.ID); err == nil {
+		response.Tags = tags
+	}
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "PDF fetched successfully", response)
 }
@@ -160,6 +235,14 @@ func DeletePDF(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete PDF")
 	}
 
+	// Collections it belonged to are summarized again without it
+	var collectionIDs []uint
+	database.DB.Model(&models.CollectionMember{}).Where("pdf_file_id = ?", pdf.ID).Pluck("collection_id", &collectionIDs)
+	database.DB.Where("pdf_file_id = ?", pdf.ID).Delete(&models.CollectionMember{})
+	for _, collectionID := range collectionIDs {
+		rerunCollectionSummary(collectionID, utils.ClientID(c))
+	}
+
 	return utils.SuccessResponse(c, fiber.StatusOK, "PDF deleted successfully", nil)
 }
 
@@ -171,9 +254,22 @@ func GetPDFStats(c *fiber.Ctx) error {
 	database.DB.Model(&models.PDFFile{}).Count(&totalPDFs)
 	database.DB.Model(&models.SummaryLog{}).Count(&totalSummaries)
 
+	// Jobs answered from an identical completed summary, and the AI time they avoided
+	var cacheStats struct {
+		CacheHits int64
+		TimeSaved float64
+	}
+	database.DB.Model(&models.SummarizationJob{}).
+		Select("COUNT(*) AS cache_hits, COALESCE(SUM(summary_logs.processing_time), 0) AS time_saved").
+		Joins("JOIN summary_logs ON summary_logs.id = summarization_jobs.summary_log_id AND summary_logs.deleted_at IS NULL").
+		Where("summarization_jobs.cache_hit = ?", true).
+		Scan(&cacheStats)
+
 	stats := fiber.Map{
-		"total_pdfs":      totalPDFs,
-		"total_summaries": totalSummaries,
+		"total_pdfs":            totalPDFs,
+		"total_summaries":       totalSummaries,
+		"cache_hits":            cacheStats.CacheHits,
+		"ai_time_saved_seconds": cacheStats.TimeSaved,
 	}
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "Stats fetched successfully", stats)
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// scanMaxWords - A page with images and fewer words than this is treated
+	// as a scan; the words are usually a page number or a stamp
+	scanMaxWords = 3
+
+	// languagePageWords - Shorter pages take the language of the whole document
+	languagePageWords = 40
+
+	// languageSampleChars bounds the document text used to detect its language
+	languageSampleChars = 20000
+)
+
+// extractMu serializes extracting the pages of PDFs uploaded before pages
+// were stored, so the chunks of one job extract them once
+var extractMu sync.Mutex
+
+// ListPDFPages returns the extracted pages of a PDF with their char and word
+// counts; ?text=false leaves out the text itself
+func ListPDFPages(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+	if err := ensurePDFPages(&pdf); err != nil {
+		return aiErrorResponse(c, err)
+	}
+
+	query := database.DB.Where("pdf_file_id = ?", pdf.ID)
+	if !c.QueryBool("text", true) {
+		query = query.Omit("text")
+	}
+
+	var pages []models.PDFPage
+	if err := query.Order("page_number ASC").Find(&pages).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch pages")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Pages fetched successfully", pages)
+}
+
+// storePDFPages extracts the text of every page of data into pdf_pages,
+// replacing any stored pages, and records the totals on the PDF
+func storePDFPages(pdf *models.PDFFile, data []byte) error {
+	contents, err := utils.ReadPDFPages(data)
+	if err != nil {
+		return ai.Permanent(ai.CodeInvalidPDF, "PDF %d: %v", pdf.ID, err)
+	}
+
+	pages := make([]models.PDFPage, len(contents))
+	words := 0
+	var scanned []int
+	var sample strings.Builder
+	for i, content := range contents {
+		// Postgres text rejects NUL bytes and invalid UTF-8
+		text := strings.ToValidUTF8(strings.ReplaceAll(content.Text, "\x00", ""), "")
+		pages[i] = models.PDFPage{
+			PDFFileID:  pdf.ID,
+			PageNumber: i + 1,
+			Text:       text,
+			CharCount:  utf8.RuneCountInString(text),
+			WordCount:  len(strings.Fields(text)),
+			HasImages:  content.HasImages,
+		}
+		pages[i].ImageOnly = content.HasImages && pages[i].WordCount < scanMaxWords
+		if pages[i].ImageOnly {
+			scanned = append(scanned, i+1)
+		}
+		words += pages[i].WordCount
+		if sample.Len() < languageSampleChars {
+			sample.WriteString(text)
+			sample.WriteString("\n")
+		}
+	}
+
+	documentLanguage := utils.DetectLanguage(sample.String())
+	for i := range pages {
+		pages[i].Language = documentLanguage
+		if pages[i].WordCount >= languagePageWords {
+			if language := utils.DetectLanguage(pages[i].Text); language != "" {
+				pages[i].Language = language
+			}
+		}
+	}
+
+	totalPages := len(pages)
+	now := time.Now()
+	var imageOnlyPages *string
+	if len(scanned) > 0 {
+		spec := utils.FormatPageRange(scanned)
+		imageOnlyPages = &spec
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pdf_file_id = ?", pdf.ID).Delete(&models.PDFPage{}).Error; err != nil {
+			return err
+		}
+		if len(pages) > 0 {
+			if err := tx.CreateInBatches(pages, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(pdf).UpdateColumns(map[string]interface{}{
+			"total_pages":       totalPages,
+			"word_count":        words,
+			"image_only_pages":  imageOnlyPages,
+			"text_extracted_at": now,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store pages of PDF %d: %w", pdf.ID, err)
+	}
+
+	pdf.TotalPages = &totalPages
+	pdf.WordCount = &words
+	pdf.ImageOnlyPages = imageOnlyPages
+	pdf.TextExtractedAt = &now
+
+	if len(scanned) > 0 {
+		log.Printf("PDF %d: %d pages, %d words; pages %s are images only", pdf.ID, totalPages, words, *imageOnlyPages)
+	} else {
+		log.Printf("PDF %d: %d pages, %d words", pdf.ID, totalPages, words)
+	}
+	return nil
+}
+
+// ensurePDFPages extracts the pages of a PDF uploaded before pages were
+// stored, or whose extraction failed at upload
+func ensurePDFPages(pdf *models.PDFFile) error {
+	if pdf.TextExtractedAt != nil {
+		return nil
+	}
+
+	extractMu.Lock()
+	defer extractMu.Unlock()
+
+	// Another job may have extracted them meanwhile
+	var current models.PDFFile
+	if err := database.DB.Select("id", "total_pages", "word_count", "image_only_pages", "text_extracted_at").First(&current, pdf.ID).Error; err == nil && current.TextExtractedAt != nil {
+		pdf.TotalPages = current.TotalPages
+		pdf.WordCount = current.WordCount
+		pdf.ImageOnlyPages = current.ImageOnlyPages
+		pdf.TextExtractedAt = current.TextExtractedAt
+		return nil
+	}
+
+	_, data, err := downloadPDF(pdf.FilePath)
+	if err != nil {
+		return err
+	}
+	return storePDFPages(pdf, data)
+}
+
+// pageTexts returns the stored text of the pages in spec ("" = all pages),
+// in order; pages without text are included with an empty text
+func pageTexts(pdf *models.PDFFile, spec string) ([]ai.Page, error) {
+	if err := ensurePDFPages(pdf); err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Select("page_number", "text").Where("pdf_file_id = ?", pdf.ID)
+	if strings.TrimSpace(spec) != "" && pdf.TotalPages != nil {
+		query = query.Where("page_number IN ?", utils.ParsePageRange(spec, *pdf.TotalPages))
+	}
+
+	var pages []models.PDFPage
+	if err := query.Order("page_number ASC").Find(&pages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load pages of PDF %d: %w", pdf.ID, err)
+	}
+
+	result := make([]ai.Page, len(pages))
+	for i, page := range pages {
+		result[i] = ai.Page{Number: page.PageNumber, Text: page.Text}
+	}
+	return result, nil
+}
+
+// hasText reports whether any of pages has text
+func hasText(pages []ai.Page) bool {
+	for _, page := range pages {
+		if strings.TrimSpace(page.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfPages returns the text of every page of a PDF
+func pdfPages(pdf *models.PDFFile) ([]string, error) {
+	pages, err := pageTexts(pdf, "")
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = page.Text
+	}
+	if strings.TrimSpace(strings.Join(texts, "")) == "" {
+		return nil, ai.Permanent(ai.CodeNoText, "PDF %d has no extractable text", pdf.ID)
+	}
+	return texts, nil
+}
+
+// pagesWithText returns the numbers of the pages of pdf that have text, and
+// false when its pages have not been extracted yet
+func pagesWithText(pdf *models.PDFFile) (map[int]bool, bool) {
+	if pdf.TextExtractedAt == nil {
+		return nil, false
+	}
+	var numbers []int
+	if err := database.DB.Model(&models.PDFPage{}).
+		Where("pdf_file_id = ? AND word_count > 0", pdf.ID).
+		Pluck("page_number", &numbers).Error; err != nil {
+		return nil, false
+	}
+
+	withText := make(map[int]bool, len(numbers))
+	for _, number := range numbers {
+		withText[number] = true
+	}
+	return withText, true
+}
+
+// noTextMessage explains why none of the selected pages of pdf has text,
+// e.g. a scanned document, so the request fails before reaching the AI.
+// It is "" when some page has text or the pages are not extracted yet.
+func noTextMessage(pdf *models.PDFFile, spec *string) string {
+	withText, ok := pagesWithText(pdf)
+	if !ok || pdf.TotalPages == nil {
+		return ""
+	}
+	for _, number := range utils.ParsePageRange(optionalString(spec), *pdf.TotalPages) {
+		if withText[number] {
+			return ""
+		}
+	}
+
+	if pdf.ImageOnlyPages != nil {
+		return fmt.Sprintf("The selected pages have no extractable text (pages %s are images only and need OCR)", *pdf.ImageOnlyPages)
+	}
+	return "The selected pages have no extractable text"
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// Hit types of GET /api/search
+	searchTypePage    = "page"    // Extracted page text
+	searchTypeSummary = "summary" // Summary text, bullets, highlights or QA answer
+	searchTypeAnswer  = "answer"  // Message of a QA thread
+
+	// searchHeadline - Options of the highlighted snippet
+	searchHeadline = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10"
+
+	// searchSnippetBody - The hit's text with HTML escaped before ts_headline
+	// adds its <mark> tags, so the snippet is safe to render as HTML. The
+	// parser reads the escapes as entities, which are not search terms.
+	searchSnippetBody = `replace(replace(replace(replace(hits.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;')`
+)
+
+// SearchHit - One ranked match with its document and page references
+type SearchHit struct {
+	Type       string    `json:"type"` // page, summary or answer
+	PDFFileID  uint      `json:"pdf_file_id"`
+	Filename   string    `json:"filename"`
+	PageNumber *int      `json:"page_number,omitempty"` // Page hits
+	Pages      *string   `json:"pages,omitempty"`       // Page range a summary or thread covers, nil = all pages
+	SummaryID  *uint     `json:"summary_id,omitempty"`
+	ThreadID   *uint     `json:"thread_id,omitempty"`
+	MessageID  *uint     `json:"message_id,omitempty"`
+	Mode       *string   `json:"mode,omitempty"`
+	Language   string    `json:"language"`
+	Rank       float64   `json:"rank"`
+	Snippet    string    `json:"snippet"` // HTML-safe: escaped matching passages, terms wrapped in <mark>
+	CreatedAt  time.Time `json:"created_at"`
+	Total      int64     `json:"-"`
+}
+
+// Search runs a full-text query over page text, summaries and thread answers.
+// Filters: type (page, summary, answer; comma-separated), mode, language,
+// pdf_id, from and to (YYYY-MM-DD, inclusive). A mode filter leaves out page
+// hits, which have no mode.
+func Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "q is required")
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	params := map[string]interface{}{
+		"q":      q,
+		"limit":  limit,
+		"offset": (page - 1) * limit,
+	}
+
+	types := map[string]bool{searchTypePage: true, searchTypeSummary: true, searchTypeAnswer: true}
+	if value := c.Query("type"); value != "" {
+		types = map[string]bool{}
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			if t != searchTypePage && t != searchTypeSummary && t != searchTypeAnswer {
+				return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid type. Must be: page, summary or answer")
+			}
+			types[t] = true
+		}
+	}
+
+	// Filters shared by every source; the placeholder is the table alias
+	var filters []string
+	language := strings.ToLower(strings.TrimSpace(c.Query("language")))
+	if language != "" {
+		params["language"] = language
+		filters = append(filters, "LOWER(%[1]s.language) = @language")
+	}
+	if pdfID := c.Query("pdf_id"); pdfID != "" {
+		id, err := strconv.Atoi(pdfID)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid pdf_id")
+		}
+		params["pdf_id"] = id
+		filters = append(filters, "f.id = @pdf_id")
+	}
+	for _, bound := range []struct{ name, op string }{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		}
+		if bound.name == "to" {
+			day = day.AddDate(0, 0, 1)
+		}
+		params[bound.name] = day
+		filters = append(filters, fmt.Sprintf("%%[1]s.created_at %s @%s", bound.op, bound.name))
+	}
+
+	mode := c.Query("mode")
+	if mode != "" {
+		params["mode"] = mode
+		delete(types, searchTypePage)
+		if mode != "qa" {
+			delete(types, searchTypeAnswer)
+		}
+	}
+
+	where := func(alias string, extra ...string) string {
+		conditions := append([]string{alias + ".search_vector @@ q.query"}, extra...)
+		for _, filter := range filters {
+			conditions = append(conditions, fmt.Sprintf(filter, alias))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+
+	var branches []string
+	if types[searchTypePage] {
+		branches = append(branches, `
+			SELECT 'page' AS type, p.pdf_file_id, f.original_filename AS filename,
+				p.page_number, NULL::text AS pages, NULL::bigint AS summary_id, NULL::bigint AS thread_id,
+				NULL::bigint AS message_id, NULL::text AS mode, p.language, p.created_at,
+				ts_rank_cd(p.search_vector, q.query, 32) AS rank,
+				search_config(p.language) AS config, p.text AS body
+			FROM pdf_pages p
+			JOIN pdf_files f ON f.id = p.pdf_file_id AND f.deleted_at IS NULL, q
+			WHERE `+where("p"))
+	}
+	if types[searchTypeSummary] {
+		extra := []string{"s.deleted_at IS NULL"}
+		if mode != "" {
+			extra = append(extra, "s.mode = @mode")
+		}
+		branches = append(branches, `
+			SELECT 'summary', s.pdf_file_id, f.original_filename,
+				NULL::int, s.pages_processed, s.id, NULL::bigint,
+				NULL::bigint, s.mode, s.language, s.created_at,
+				ts_rank_cd(s.search_vector, q.query, 32),
+				search_config(s.language),
+				CONCAT_WS(E'\n', s.executive_summary, s.summary_text, s.bullets, s.highlights, s.qa_question, s.qa_answer)
+			FROM summary_logs s
+			JOIN pdf_files f ON f.id = s.pdf_file_id AND f.deleted_at IS NULL, q
+			WHERE `+where("s", extra...))
+	}
+	if types[searchTypeAnswer] {
+		branches = append(branches, `
+			SELECT 'answer', t.pdf_file_id, f.original_filename,
+				NULL::int, t.pages, NULL::bigint, t.id,
+				m.id, 'qa', m.language, m.created_at,
+				ts_rank_cd(m.search_vector, q.query, 32),
+				search_config(m.language),
+				m.question || E'\n' || m.answer
+			FROM qa_messages m
+			JOIN qa_threads t ON t.id = m.thread_id AND t.deleted_at IS NULL
+			JOIN pdf_files f ON f.id = t.pdf_file_id AND f.deleted_at IS NULL, q
+			WHERE `+where("m", "m.deleted_at IS NULL"))
+	}
+	if len(branches) == 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "No result type matches the filters")
+	}
+
+	query := `
+		WITH q AS (SELECT ` + searchQuery(language) + ` AS query)
+		SELECT hits.type, hits.pdf_file_id, hits.filename, hits.page_number, hits.pages,
+			hits.summary_id, hits.thread_id, hits.message_id, hits.mode, hits.language,
+			hits.created_at, hits.rank, hits.total,
+			ts_headline(hits.config, ` + searchSnippetBody + `, q.query, '` + searchHeadline + `') AS snippet
+		FROM (
+			SELECT matches.*, COUNT(*) OVER () AS total
+			FROM (` + strings.Join(branches, "\n\t\t\tUNION ALL") + `
+			) matches
+			ORDER BY matches.rank DESC, matches.created_at DESC
+			LIMIT @limit OFFSET @offset
+		) hits, q
+		ORDER BY hits.rank DESC, hits.created_at DESC`
+
+	hits := []SearchHit{}
+	if err := database.DB.Raw(query, params).Scan(&hits).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to search")
+	}
+
+	var total int64
+	if len(hits) > 0 {
+		total = hits[0].Total
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Search completed successfully", fiber.Map{
+		"query": q,
+		"hits":  hits,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// searchQuery is the SQL tsquery for @q. With a language filter it is parsed
+// with that language's configuration; otherwise with every configuration,
+// since each row is indexed with its own.
+func searchQuery(language string) string {
+	if language != "" {
+		return "websearch_to_tsquery(search_config(@language), @q)"
+	}
+	parts := make([]string, 0, len(database.SearchLanguages)+1)
+	for _, config := range append(database.SearchLanguages, "simple") {
+		parts = append(parts, fmt.Sprintf("websearch_to_tsquery('%s', @q)", config))
+	}
+	return strings.Join(parts, " || ")
+}
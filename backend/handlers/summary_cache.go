@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// findCachedSummary returns a completed summary produced with the same inputs as job.
+// Extractive fallbacks from an open circuit are not reused; the provider should get another try.
+func findCachedSummary(job *models.SummarizationJob) (*models.SummaryLog, error) {
+	query := database.DB.Where("pdf_file_id = ? AND mode = ? AND LOWER(language) = LOWER(?) AND provider = ? AND (extractive = false OR provider = ?) AND source_summary_id IS NULL",
+		job.PDFFileID, job.Mode, job.Language, job.Provider, ai.ProviderExtractive)
+	query = whereNullable(query, "pages_processed", job.Pages)
+	query = whereTemplate(query, job)
+	query = whereSchema(query, job)
+	query = whereStyle(query, job)
+	query = whereCompare(query, job)
+	if job.Mode == models.ModeQA {
+		query = whereNullable(query, "qa_question", job.Question)
+	}
+
+	var summary models.SummaryLog
+	if err := query.Order("created_at DESC").First(&summary).Error; err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// findCachedTranslation returns an existing translation of the job's source summary
+func findCachedTranslation(job *models.SummarizationJob) (*models.SummaryLog, error) {
+	var summary models.SummaryLog
+	err := database.DB.Where("source_summary_id = ? AND LOWER(language) = LOWER(?) AND provider = ?",
+		*job.SourceSummaryID, job.Language, job.Provider).
+		Order("created_at DESC").
+		First(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// findInFlightJob returns a pending or processing job with the same inputs as job
+func findInFlightJob(job *models.SummarizationJob) (*models.SummarizationJob, error) {
+	query := database.DB.Where("pdf_file_id = ? AND mode = ? AND LOWER(language) = LOWER(?) AND provider = ? AND status IN ?",
+		job.PDFFileID, job.Mode, job.Language, job.Provider,
+		[]models.JobStatus{models.JobStatusPending, models.JobStatusProcessing})
+	query = whereNullable(query, "pages", job.Pages)
+	query = whereTemplate(query, job)
+	query = whereSchema(query, job)
+	query = whereStyle(query, job)
+	query = whereCompare(query, job)
+	if job.SourceSummaryID != nil {
+		query = query.Where("source_summary_id = ?", *job.SourceSummaryID)
+	}
+	if job.Mode == models.ModeQA {
+		query = whereNullable(query, "question", job.Question)
+	}
+
+	var existing models.SummarizationJob
+	if err := query.Order("created_at ASC").First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// whereNullable matches a nullable text column, treating nil and "" as NULL
+func whereNullable(query *gorm.DB, column string, value *string) *gorm.DB {
+	if value == nil || *value == "" {
+		return query.Where("(" + column + " IS NULL OR " + column + " = '')")
+	}
+	return query.Where(column+" = ?", *value)
+}
+
+// whereTemplate matches the prompt template version job runs with, or none
+func whereTemplate(query *gorm.DB, job *models.SummarizationJob) *gorm.DB {
+	if job.TemplateID == nil || job.TemplateVersion == nil {
+		return query.Where("template_id IS NULL")
+	}
+	return query.Where("template_id = ? AND template_version = ?", *job.TemplateID, *job.TemplateVersion)
+}
+
+// whereSchema matches the extract schema of job; jsonb equality ignores key order and whitespace
+func whereSchema(query *gorm.DB, job *models.SummarizationJob) *gorm.DB {
+	if job.ExtractSchema == nil {
+		return query
+	}
+	return query.Where("extract_schema = ?::jsonb", *job.ExtractSchema)
+}
+
+// whereStyle matches the style options of job, or none
+func whereStyle(query *gorm.DB, job *models.SummarizationJob) *gorm.DB {
+	if job.Style == nil {
+		return query.Where("style IS NULL")
+	}
+	return query.Where("style = ?::jsonb", *job.Style)
+}
+
+// whereCompare matches the document job compares against, or none
+func whereCompare(query *gorm.DB, job *models.SummarizationJob) *gorm.DB {
+	if job.ComparePDFFileID == nil {
+		return query.Where("compare_pdf_file_id IS NULL")
+	}
+	return query.Where("compare_pdf_file_id = ?", *job.ComparePDFFileID)
+}
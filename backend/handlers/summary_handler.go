@@ -1,12 +1,13 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
+	"log"
+	"math"
+	"pdf-summarizer-backend/ai"
 	"pdf-summarizer-backend/config"
 	"pdf-summarizer-backend/database"
 	"pdf-summarizer-backend/models"
@@ -19,17 +20,20 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-// SummarizePDF handles PDF summarization by calling Python AI service
+// SummarizePDF handles PDF summarization by calling the AI provider
 func SummarizePDF(c *fiber.Ctx) error {
 	// Get PDF ID from params
 	pdfID := c.Params("id")
 
 	// Get request body
 	type SummarizeRequest struct {
-		Mode     string  `json:"mode"`     // simple, structured, multi, qa
-		Language *string `json:"language"` // optional
-		Pages    *string `json:"pages"`    // optional, e.g., "1-5, 7, 9"
-		Question *string `json:"question"` // required for qa mode
+		Mode     string          `json:"mode"`     // simple, structured, multi, qa, extractive, extract
+		Language *string         `json:"language"` // optional
+		Pages    *string         `json:"pages"`    // optional, e.g., "1-5, 7, 9"
+		Question *string         `json:"question"` // required for qa mode
+		Provider string          `json:"provider"` // optional, defaults to AI_PROVIDER
+		Schema   json.RawMessage `json:"schema"`   // JSON Schema, required for extract mode
+		Style    *ai.Style       `json:"style"`    // optional length, audience, tone and format
 	}
 
 	var req SummarizeRequest
@@ -39,10 +43,10 @@ func SummarizePDF(c *fiber.Ctx) error {
 
 	// Validate mode
 	validModes := map[string]bool{
-		"simple": true, "structured": true, "multi": true, "qa": true,
+		"simple": true, "structured": true, "multi": true, "qa": true, "extractive": true, "extract": true,
 	}
 	if !validModes[req.Mode] {
-		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid mode. Must be: simple, structured, multi, or qa")
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid mode. Must be: simple, structured, multi, qa, extractive, or extract")
 	}
 
 	// For QA mode, question is required
@@ -50,6 +54,25 @@ func SummarizePDF(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Question is required for QA mode")
 	}
 
+	schema, err := extractSchema(req.Mode, req.Schema)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+	style, err := summaryStyle(req.Mode, req.Style)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	// Extractive mode runs in-process, whatever provider was requested
+	if req.Mode == string(models.ModeExtractive) {
+		req.Provider = ai.ProviderExtractive
+	}
+
+	provider, err := ai.Get(req.Provider)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+	}
+
 	// Get PDF from database
 	var pdf models.PDFFile
 	if err := database.DB.First(&pdf, pdfID).Error; err != nil {
@@ -59,11 +82,21 @@ func SummarizePDF(c *fiber.Ctx) error {
 	// Start timing
 	startTime := time.Now()
 
-	// Call Python AI service
-	result, err := callAIService(pdf.FilePath, req.Mode, req.Language, req.Pages, req.Question)
+	// Call AI provider
+	result, err := callAIService(aiCall{
+		Provider: provider.Name(),
+		PDF:      &pdf,
+		Mode:     req.Mode,
+		Language: req.Language,
+		Pages:    req.Pages,
+		Question: req.Question,
+		Schema:   schema,
+		Style:    style,
+	})
 	if err != nil {
-		return utils.ErrorResponse(c, fiber.StatusInternalServerError, fmt.Sprintf("AI service error: %s", err.Error()))
+		return aiErrorResponse(c, err)
 	}
+	usage := usageOf(result.Usage(), result)
 
 	// Calculate processing time
 	processingTime := time.Since(startTime).Seconds()
@@ -75,41 +108,16 @@ func SummarizePDF(c *fiber.Ctx) error {
 		Language:       getLanguage(req.Language),
 		PagesProcessed: req.Pages,
 		ProcessingTime: processingTime,
+		Provider:       provider.Name(),
+		ExtractSchema:  schema,
+		Style:          style,
 	}
+	applyUsage(&summaryLog, usage)
 
-	// Map result based on mode
-	switch req.Mode {
-	case "simple":
-		if summaryText, ok := result["summary"].(string); ok {
-			summaryLog.SummaryText = &summaryText
-		}
-	case "structured":
-		if execSummary, ok := result["executive_summary"].(string); ok {
-			summaryLog.ExecutiveSummary = &execSummary
-		}
-		if bullets, ok := result["bullets"].([]interface{}); ok {
-			bulletsJSON, _ := json.Marshal(bullets)
-			bulletsStr := string(bulletsJSON)
-			summaryLog.Bullets = &bulletsStr
-		}
-		if highlights, ok := result["highlights"].([]interface{}); ok {
-			highlightsJSON, _ := json.Marshal(highlights)
-			highlightsStr := string(highlightsJSON)
-			summaryLog.Highlights = &highlightsStr
-		}
-	case "multi":
-		if combinedSummary, ok := result["combined_summary"].(string); ok {
-			summaryLog.SummaryText = &combinedSummary
-		}
-		if execSummary, ok := result["executive_summary"].(string); ok {
-			summaryLog.ExecutiveSummary = &execSummary
-		}
-	case "qa":
-		if answer, ok := result["answer"].(string); ok {
-			summaryLog.QAAnswer = &answer
-		}
-		summaryLog.QAQuestion = req.Question
+	if err := applyResult(&summaryLog, result, req.Question); err != nil {
+		return aiErrorResponse(c, err)
 	}
+	summaryLog.Citations = verifyCitations(summaryLog.Citations, &pdf)
 
 	// Save to database (trigger will auto-update pdf_files table)
 	if err := database.DB.Create(&summaryLog).Error; err != nil {
@@ -117,113 +125,220 @@ func SummarizePDF(c *fiber.Ctx) error {
 	}
 
 	// Prepare response
-	response := models.SummaryLogResponse{
-		ID:               summaryLog.ID,
-		PDFFileID:        summaryLog.PDFFileID,
-		Mode:             summaryLog.Mode,
-		Language:         summaryLog.Language,
-		PagesProcessed:   summaryLog.PagesProcessed,
-		SummaryText:      summaryLog.SummaryText,
-		ExecutiveSummary: summaryLog.ExecutiveSummary,
-		Bullets:          summaryLog.Bullets,
-		Highlights:       summaryLog.Highlights,
-		QAQuestion:       summaryLog.QAQuestion,
-		QAAnswer:         summaryLog.QAAnswer,
-		ProcessingTime:   summaryLog.ProcessingTime,
-		CreatedAt:        summaryLog.CreatedAt,
-	}
+	response := newSummaryResponse(&summaryLog)
 
 	return utils.SuccessResponse(c, fiber.StatusCreated, "Summary created successfully", response)
 }
 
-// callAIService sends PDF to Python AI service and returns the result
-func callAIService(filePath, mode string, language, pages, question *string) (map[string]interface{}, error) {
-	// Determine endpoint based on mode
-	endpoint := ""
-	switch mode {
-	case "simple":
-		endpoint = "/summarize"
-	case "structured":
-		endpoint = "/summarize-structured"
-	case "multi":
-		endpoint = "/summarize-multi"
-	case "qa":
-		endpoint = "/qa"
-	}
+// aiCall - One AI call on a stored PDF
+type aiCall struct {
+	Provider string // "" = deployment default
+	PDF      *models.PDFFile
+	Mode     string
+	Language *string
+	Pages    *string
+	Question *string
+	History  []ai.Turn  // QA threads: earlier questions and answers, oldest first
+	Prompt   string     // Custom prompt template text, "" = the provider's own prompt
+	Schema   *string    // Extract mode's JSON Schema
+	Style    *string    // Stored style options; the length is checked unless Partial
+	Partial  bool       // The pages are one chunk of the job, combined later
+	Stream   *jobStream // If set, receives the text of streamable modes as it is generated
+}
 
-	url := config.AppConfig.AIServiceURL + endpoint
+// jobCall describes the AI call for job over pages, using its template text
+func jobCall(job *models.SummarizationJob, prompt string, pages *string) aiCall {
+	return aiCall{
+		Provider: job.Provider,
+		PDF:      &job.PDFFile,
+		Mode:     string(job.Mode),
+		Language: &job.Language,
+		Pages:    pages,
+		Question: job.Question,
+		Prompt:   prompt,
+		Schema:   job.ExtractSchema,
+		Style:    job.Style,
+	}
+}
 
-	// Extract filename from MinIO path (bucket/filename)
-	parts := strings.Split(filePath, "/")
-	filename := parts[len(parts)-1]
+// callAIService sends the stored text of the call's pages to its AI provider
+// and runs the call's mode. Pages without text never reach the provider.
+func callAIService(call aiCall) (*ai.Result, error) {
+	provider, err := ai.Get(call.Provider)
+	if err != nil {
+		return nil, err
+	}
 
-	// Download file from MinIO
-	fileReader, err := storage.DownloadFile(filename)
+	pages, err := pageTexts(call.PDF, optionalString(call.Pages))
 	if err != nil {
-		return nil, fmt.Errorf("failed to download PDF from storage: %w", err)
+		return nil, err
+	}
+	if !hasText(pages) {
+		return nil, ai.Permanent(ai.CodeNoText, "could not extract text from %s: pages %s have no text",
+			call.PDF.OriginalFilename, describePages(call.Pages))
+	}
+
+	req := ai.Request{
+		Files:    []ai.File{{Name: call.PDF.Filename, Pages: pages}},
+		Language: optionalString(call.Language),
+		Pages:    optionalString(call.Pages),
+		Question: optionalString(call.Question),
+		History:  call.History,
+		Prompt:   call.Prompt,
+		Style:    parseStyle(call.Style),
+		Partial:  call.Partial,
+	}
+	if call.Schema != nil {
+		if req.Schema, err = ai.ParseSchema([]byte(*call.Schema)); err != nil {
+			return nil, ai.Permanent(ai.CodeInvalidSchema, "invalid extract schema: %v", err)
+		}
 	}
-	defer fileReader.Close()
 
-	// Create multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	run := func(style *ai.Style) (*ai.Result, error) {
+		req.Style = style
+		result, err := ai.CallStream(context.Background(), provider, call.Mode, req, call.Stream.onToken())
+		// Extracted data must come from a model; the extractive summarizer can only guess it
+		if fallback, ok := extractiveFallback(err); ok && call.Mode != string(models.ModeExtract) {
+			log.Printf("⚠️  %s circuit open, summarizing extractively", provider.Name())
+			result, err = ai.CallStream(context.Background(), fallback, call.Mode, req, call.Stream.onToken())
+		}
+		if err == nil {
+			estimateResultUsage(result, requestChars(req))
+		}
+		return result, err
+	}
 
-	// Add file
-	part, err := writer.CreateFormFile("files", filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create form file: %w", err)
+	// A chunk's length is not checked; the combined text is
+	if call.Partial {
+		return run(req.Style)
 	}
-	if _, err := io.Copy(part, fileReader); err != nil {
-		return nil, fmt.Errorf("failed to copy file: %w", err)
+	return lengthChecked(req.Style, call.Stream, run)
+}
+
+// callAICombine merges per-chunk summaries (or per-chunk answers when question is set)
+// in style, streaming the merged text when stream is set
+func callAICombine(providerName string, summaries []string, language, question *string, style *ai.Style, stream *jobStream) (string, aiUsage, error) {
+	provider, err := ai.Get(providerName)
+	if err != nil {
+		return "", aiUsage{}, err
 	}
 
-	// Add optional fields
-	if language != nil && *language != "" {
-		writer.WriteField("language", *language)
+	combine := func(provider ai.Provider, style *ai.Style) (*ai.SummaryResponse, error) {
+		if onToken := stream.onToken(); onToken != nil {
+			return provider.CombineStream(context.Background(), summaries, optionalString(language), optionalString(question), style, onToken)
+		}
+		return provider.Combine(context.Background(), summaries, optionalString(language), optionalString(question), style)
 	}
-	if pages != nil && *pages != "" {
-		writer.WriteField("pages", *pages)
+
+	result, err := lengthChecked(style, stream, func(style *ai.Style) (*ai.Result, error) {
+		resp, err := combine(provider, style)
+		if fallback, ok := extractiveFallback(err); ok {
+			log.Printf("⚠️  %s circuit open, combining extractively", provider.Name())
+			resp, err = combine(fallback, style)
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Usage = charUsage(resp.Usage, textChars(summaries...)+textChars(optionalString(question), style.Instructions()), resp)
+		return &ai.Result{Simple: resp}, nil
+	})
+	if err != nil {
+		return "", aiUsage{}, err
 	}
-	if question != nil && *question != "" {
-		writer.WriteField("question", *question)
+
+	return result.Simple.Summary, usageOf(result.Simple.Usage, result.Simple), nil
+}
+
+// lengthChecked runs call and re-requests with feedback while the reply's
+// text is far off the style's target length, adding up the usage of every
+// reply. The last reply is kept even if it is still off, and when a
+// re-request fails. A streamed reply starts over in a new stream attempt.
+func lengthChecked(style *ai.Style, stream *jobStream, call func(style *ai.Style) (*ai.Result, error)) (*ai.Result, error) {
+	result, err := call(style)
+	for attempt := 2; err == nil && attempt <= lengthAttempts; attempt++ {
+		feedback := style.CheckLength(result.Text())
+		if feedback == "" || result.Provider() == ai.ProviderExtractive {
+			// Extractive selection already fits the target as closely as it can
+			break
+		}
+		log.Printf("⚠️  %s reply is off its target length, re-requesting (%d/%d): %s",
+			result.Provider(), attempt, lengthAttempts, feedback)
+
+		stream.restart()
+		retried, retryErr := call(style.WithFeedback(feedback))
+		if retryErr != nil {
+			log.Printf("⚠️  Length re-request failed, keeping the previous reply: %v", retryErr)
+			break
+		}
+		retried.AddUsage(result.Usage())
+		result = retried
 	}
+	return result, err
+}
 
-	writer.Close()
+// extractiveFallback returns the extractive provider when err is an open circuit
+// and the deployment falls back instead of waiting
+func extractiveFallback(err error) (ai.Provider, bool) {
+	if err == nil || !config.AppConfig.ExtractiveFallback || !ai.HasCode(err, ai.CodeCircuitOpen) {
+		return nil, false
+	}
+	provider, err := ai.Get(ai.ProviderExtractive)
+	return provider, err == nil
+}
 
-	// Create request
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// aiErrorResponse maps a classified AI error to an HTTP response
+func aiErrorResponse(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	if aiErr, ok := ai.AsError(err); ok {
+		switch aiErr.Kind {
+		case ai.KindPermanent:
+			status = fiber.StatusUnprocessableEntity
+		case ai.KindTimeout:
+			status = fiber.StatusGatewayTimeout
+		case ai.KindRateLimited, ai.KindTransient:
+			status = fiber.StatusServiceUnavailable
+			if aiErr.RetryAfter > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(aiErr.RetryAfter.Seconds()))))
+			}
+		}
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return utils.ErrorResponse(c, status, fmt.Sprintf("AI service error: %s", err.Error()))
+}
 
-	// Send request with configurable timeout
-	// Default: 10 minutes for large PDFs
-	timeout := time.Duration(config.AppConfig.AITimeout) * time.Second
-	client := &http.Client{Timeout: timeout}
-	resp, err := client.Do(req)
+// downloadPDF reads a stored PDF, returning its object name and content
+func downloadPDF(filePath string) (string, []byte, error) {
+	// Extract filename from MinIO path (bucket/filename)
+	parts := strings.Split(filePath, "/")
+	filename := parts[len(parts)-1]
+
+	// Download file from MinIO
+	fileReader, err := storage.DownloadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return "", nil, storageError(err)
 	}
-	defer resp.Body.Close()
+	defer fileReader.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(fileReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return "", nil, storageError(err)
 	}
+	return filename, data, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("AI service returned error: %s", string(respBody))
+// storageError classifies a PDF download failure; a missing object is permanent
+func storageError(err error) error {
+	if storage.IsNotFound(err) {
+		return ai.Permanent(ai.CodeFileNotFound, "PDF not found in storage: %v", err)
 	}
+	return fmt.Errorf("failed to download PDF from storage: %w", err)
+}
 
-	// Parse response
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// optionalString dereferences an optional request field
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
 	}
-
-	return result, nil
+	return *value
 }
 
 // getLanguage returns language string, defaults to "english"
@@ -239,27 +354,14 @@ func ListSummaries(c *fiber.Ctx) error {
 	pdfID := c.Params("id")
 
 	var summaries []models.SummaryLog
-	if err := database.DB.Where("pdf_file_id = ?", pdfID).Order("created_at DESC").Find(&summaries).Error; err != nil {
+	// Comparisons are listed under both documents
+	if err := database.DB.Where("pdf_file_id = ? OR compare_pdf_file_id = ?", pdfID, pdfID).Order("created_at DESC").Find(&summaries).Error; err != nil {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch summaries")
 	}
 
 	var responses []models.SummaryLogResponse
 	for _, summary := range summaries {
-		responses = append(responses, models.SummaryLogResponse{
-			ID:               summary.ID,
-			PDFFileID:        summary.PDFFileID,
-			Mode:             summary.Mode,
-			Language:         summary.Language,
-			PagesProcessed:   summary.PagesProcessed,
-			SummaryText:      summary.SummaryText,
-			ExecutiveSummary: summary.ExecutiveSummary,
-			Bullets:          summary.Bullets,
-			Highlights:       summary.Highlights,
-			QAQuestion:       summary.QAQuestion,
-			QAAnswer:         summary.QAAnswer,
-			ProcessingTime:   summary.ProcessingTime,
-			CreatedAt:        summary.CreatedAt,
-		})
+		responses = append(responses, newSummaryResponse(&summary))
 	}
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "Summaries fetched successfully", responses)
@@ -274,21 +376,7 @@ func GetSummary(c *fiber.Ctx) error {
 		return utils.ErrorResponse(c, fiber.StatusNotFound, "Summary not found")
 	}
 
-	response := models.SummaryLogResponse{
-		ID:               summary.ID,
-		PDFFileID:        summary.PDFFileID,
-		Mode:             summary.Mode,
-		Language:         summary.Language,
-		PagesProcessed:   summary.PagesProcessed,
-		SummaryText:      summary.SummaryText,
-		ExecutiveSummary: summary.ExecutiveSummary,
-		Bullets:          summary.Bullets,
-		Highlights:       summary.Highlights,
-		QAQuestion:       summary.QAQuestion,
-		QAAnswer:         summary.QAAnswer,
-		ProcessingTime:   summary.ProcessingTime,
-		CreatedAt:        summary.CreatedAt,
-	}
+	response := newSummaryResponse(&summary)
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "Summary fetched successfully", response)
 }
@@ -315,28 +403,26 @@ func GetAllSummaries(c *fiber.Ctx) error {
 	limit, _ := strconv.Atoi(c.Query("limit", "50"))
 	offset := (page - 1) * limit
 
+	query := database.DB.Order("created_at DESC")
+	if mode := c.Query("mode"); mode != "" {
+		query = query.Where("mode = ?", mode)
+	}
+	// ?data={"governing_law":"Delaware"} matches extract results containing that JSON
+	if data := c.Query("data"); data != "" {
+		if !json.Valid([]byte(data)) {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "data must be valid JSON")
+		}
+		query = query.Where("extracted_data @> ?::jsonb", data)
+	}
+
 	var summaries []models.SummaryLog
-	if err := database.DB.Order("created_at DESC").Offset(offset).Limit(limit).Find(&summaries).Error; err != nil {
+	if err := query.Offset(offset).Limit(limit).Find(&summaries).Error; err != nil {
 		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch summaries")
 	}
 
 	var responses []models.SummaryLogResponse
 	for _, summary := range summaries {
-		responses = append(responses, models.SummaryLogResponse{
-			ID:               summary.ID,
-			PDFFileID:        summary.PDFFileID,
-			Mode:             summary.Mode,
-			Language:         summary.Language,
-			PagesProcessed:   summary.PagesProcessed,
-			SummaryText:      summary.SummaryText,
-			ExecutiveSummary: summary.ExecutiveSummary,
-			Bullets:          summary.Bullets,
-			Highlights:       summary.Highlights,
-			QAQuestion:       summary.QAQuestion,
-			QAAnswer:         summary.QAAnswer,
-			ProcessingTime:   summary.ProcessingTime,
-			CreatedAt:        summary.CreatedAt,
-		})
+		responses = append(responses, newSummaryResponse(&summary))
 	}
 
 	return utils.SuccessResponse(c, fiber.StatusOK, "Summaries fetched successfully", responses)
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/citation"
+	"pdf-summarizer-backend/models"
+	"strings"
+)
+
+// applyResult maps a validated AI result onto summaryLog's columns.
+// Shared by the sync endpoint and the job workers.
+func applyResult(summaryLog *models.SummaryLog, result *ai.Result, question *string) error {
+	if result == nil {
+		return ai.Permanent(ai.CodeSchemaMismatch, "no result for mode %s", summaryLog.Mode)
+	}
+	summaryLog.Extractive = result.Provider() == ai.ProviderExtractive
+
+	switch {
+
+	case result.Simple != nil:
+		summaryLog.SummaryText = &result.Simple.Summary
+
+	case result.Structured != nil:
+		// Page markers move from the text into the citations column
+		executiveSummary, _ := citation.Strip(result.Structured.ExecutiveSummary)
+		report := &citation.Report{
+			Bullets:    citedItems(result.Structured.Bullets),
+			Highlights: citedItems(result.Structured.Highlights),
+		}
+		summaryLog.ExecutiveSummary = &executiveSummary
+		summaryLog.Bullets = jsonList(citationTexts(report.Bullets))
+		summaryLog.Highlights = jsonList(citationTexts(report.Highlights))
+		summaryLog.Citations = jsonReport(report)
+
+	case result.Multi != nil:
+		summaryLog.SummaryText = &result.Multi.CombinedSummary
+
+		var execSummaries []string
+		var bullets, highlights [][]string
+		for _, item := range result.Multi.Items {
+			if len(result.Multi.Items) > 1 {
+				execSummaries = append(execSummaries, fmt.Sprintf("%s: %s", item.Filename, item.ExecutiveSummary))
+			} else {
+				execSummaries = append(execSummaries, item.ExecutiveSummary)
+			}
+			bullets = append(bullets, item.Bullets)
+			highlights = append(highlights, item.Highlights)
+		}
+		execSummary := strings.Join(execSummaries, "\n\n")
+		summaryLog.ExecutiveSummary = &execSummary
+		summaryLog.Bullets = jsonList(mergeLists(bullets))
+		summaryLog.Highlights = jsonList(mergeLists(highlights))
+
+	case result.QA != nil:
+		answer, citations := citedAnswer(result.QA.Answer)
+		summaryLog.QAAnswer = &answer
+		summaryLog.QAQuestion = question
+		summaryLog.Citations = citations
+
+	case result.Extract != nil:
+		data := string(result.Extract.Data)
+		summaryLog.ExtractedData = &data
+	}
+
+	return nil
+}
+
+// newSummaryResponse builds the API representation of a summary
+func newSummaryResponse(summary *models.SummaryLog) models.SummaryLogResponse {
+	return models.SummaryLogResponse{
+		ID:               summary.ID,
+		PDFFileID:        summary.PDFFileID,
+		Mode:             summary.Mode,
+		Language:         summary.Language,
+		PagesProcessed:   summary.PagesProcessed,
+		SummaryText:      summary.SummaryText,
+		ExecutiveSummary: summary.ExecutiveSummary,
+		Bullets:          summary.Bullets,
+		Highlights:       summary.Highlights,
+		QAQuestion:       summary.QAQuestion,
+		QAAnswer:         summary.QAAnswer,
+		ProcessingTime:   summary.ProcessingTime,
+		Provider:         summary.Provider,
+		AIModel:          summary.AIModel,
+		PromptTokens:     summary.PromptTokens,
+		CompletionTokens: summary.CompletionTokens,
+		Cost:             summary.Cost,
+		TokensEstimated:  summary.TokensEstimated,
+		Extractive:       summary.Extractive,
+		TemplateID:       summary.TemplateID,
+		TemplateVersion:  summary.TemplateVersion,
+		ExtractSchema:    rawJSON(summary.ExtractSchema),
+		ExtractedData:    rawJSON(summary.ExtractedData),
+		Style:            rawJSON(summary.Style),
+		SourceSummaryID:  summary.SourceSummaryID,
+		ComparePDFFileID: summary.ComparePDFFileID,
+		Comparison:       rawJSON(summary.Comparison),
+		Citations:        rawJSON(summary.Citations),
+		CreatedAt:        summary.CreatedAt,
+	}
+}
+
+// jsonList encodes a list column as a JSON array
+func jsonList(items []string) *string {
+	if items == nil {
+		items = []string{}
+	}
+	data, _ := json.Marshal(items)
+	value := string(data)
+	return &value
+}
+
+// jsonValue encodes any value for a jsonb column
+func jsonValue(value interface{}) *string {
+	data, _ := json.Marshal(value)
+	encoded := string(data)
+	return &encoded
+}
+
+// rawJSON returns a jsonb column as-is for responses
+func rawJSON(value *string) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	return json.RawMessage(*value)
+}
+
+// extractSchema checks the schema of an extract request and returns it
+// compacted for storage; other modes must not send one
+func extractSchema(mode string, schema json.RawMessage) (*string, error) {
+	if mode != string(models.ModeExtract) {
+		if len(schema) > 0 && string(schema) != "null" {
+			return nil, fmt.Errorf("schema is only used by extract mode")
+		}
+		return nil, nil
+	}
+	if len(schema) == 0 || string(schema) == "null" {
+		return nil, fmt.Errorf("schema is required for extract mode")
+	}
+
+	parsed, err := ai.ParseSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	compact := parsed.String()
+	return &compact, nil
+}
+
+// summaryStyle checks the style options of a request and returns them as
+// JSON for storage; nil when none are set
+func summaryStyle(mode string, style *ai.Style) (*string, error) {
+	if style.IsZero() {
+		return nil, nil
+	}
+	if err := style.Normalize(mode); err != nil {
+		return nil, fmt.Errorf("invalid style: %v", err)
+	}
+
+	data, err := json.Marshal(style)
+	if err != nil {
+		return nil, err
+	}
+	value := string(data)
+	return &value, nil
+}
+
+// parseStyle decodes a stored style; nil when there is none
+func parseStyle(value *string) *ai.Style {
+	if value == nil {
+		return nil
+	}
+	style := &ai.Style{}
+	if err := json.Unmarshal([]byte(*value), style); err != nil {
+		return nil
+	}
+	return style
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/tagging"
+	"pdf-summarizer-backend/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ListPDFTags returns the tags of a PDF (?kind= filters by kind)
+func ListPDFTags(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	query := database.DB.Where("pdf_file_id = ?", pdf.ID)
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	tags := []models.DocumentTag{}
+	if err := query.Order("kind ASC, score DESC, name ASC").Find(&tags).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch tags")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Tags fetched successfully", tags)
+}
+
+// CreatePDFTag adds a tag to a PDF by hand
+func CreatePDFTag(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	var req tagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	kind, name, err := req.validate("", "")
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	// A tag deleted earlier is restored rather than duplicated
+	var tag models.DocumentTag
+	err = database.DB.Unscoped().Where("pdf_file_id = ? AND kind = ? AND slug = ?", pdf.ID, kind, tagSlug(name)).First(&tag).Error
+	switch {
+	case err == nil && !tag.DeletedAt.Valid:
+		return utils.ErrorResponse(c, fiber.StatusConflict, "Tag already exists")
+	case err == nil:
+		err = database.DB.Unscoped().Model(&tag).Updates(map[string]interface{}{
+			"name":       name,
+			"source":     models.TagSourceManual,
+			"extractor":  nil,
+			"score":      1,
+			"deleted_at": nil,
+		}).Error
+	default:
+		tag = models.DocumentTag{PDFFileID: pdf.ID, Kind: kind, Name: name, Slug: tagSlug(name), Source: models.TagSourceManual, Score: 1}
+		err = database.DB.Create(&tag).Error
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to save tag")
+	}
+	database.DB.First(&tag, tag.ID)
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Tag added successfully", tag)
+}
+
+// UpdatePDFTag renames a tag or changes its kind. An edited tag counts as
+// added by hand; the extracted original is not extracted again.
+func UpdatePDFTag(c *fiber.Ctx) error {
+	tag, err := findTag(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Tag not found")
+	}
+
+	var req tagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	kind, name, err := req.validate(tag.Kind, tag.Name)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	var count int64
+	database.DB.Model(&models.DocumentTag{}).
+		Where("pdf_file_id = ? AND kind = ? AND slug = ? AND id <> ?", tag.PDFFileID, kind, tagSlug(name), tag.ID).
+		Count(&count)
+	if count > 0 {
+		return utils.ErrorResponse(c, fiber.StatusConflict, "Tag already exists")
+	}
+
+	original := *tag
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if original.Source == models.TagSourceAuto && (kind != original.Kind || tagSlug(name) != original.Slug) {
+			tombstone := original
+			tombstone.ID = 0
+			tombstone.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			if err := tx.Create(&tombstone).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(tag).Updates(map[string]interface{}{
+			"kind":      kind,
+			"name":      name,
+			"slug":      tagSlug(name),
+			"source":    models.TagSourceManual,
+			"extractor": nil,
+		}).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to update tag")
+	}
+	database.DB.First(tag, tag.ID)
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Tag updated successfully", tag)
+}
+
+// DeletePDFTag removes a tag from a PDF; extraction does not add it again
+func DeletePDFTag(c *fiber.Ctx) error {
+	tag, err := findTag(c)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Tag not found")
+	}
+	if err := database.DB.Delete(tag).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete tag")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Tag deleted successfully", nil)
+}
+
+// ExtractPDFTags extracts the tags of a PDF now, replacing the extracted
+// ones. With "provider" in the body the provider reads the latest summary;
+// otherwise the built-in extractor reads the page text.
+func ExtractPDFTags(c *fiber.Ctx) error {
+	type ExtractRequest struct {
+		Provider string `json:"provider"` // optional, "" = built-in extractor
+	}
+
+	var req ExtractRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if req.Provider != "" {
+		if _, err := ai.Get(req.Provider); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+		}
+	}
+
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	summary := ""
+	if pdf.LatestSummaryID != nil {
+		var latest models.SummaryLog
+		if err := database.DB.First(&latest, *pdf.LatestSummaryID).Error; err == nil {
+			summary = strings.Join(translationFields(&latest).texts, "\n")
+		}
+	}
+
+	tags, err := tagPDF(&pdf, req.Provider, summary)
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Tags extracted successfully", tags)
+}
+
+// ListTags lists the tags in use with the number of documents carrying each
+// (?kind= filters by kind, ?q= by a part of the name)
+func ListTags(c *fiber.Ctx) error {
+	type TagCount struct {
+		Kind      string `json:"kind"`
+		Slug      string `json:"slug"`
+		Name      string `json:"name"`
+		Documents int64  `json:"documents"`
+	}
+
+	query := database.DB.Model(&models.DocumentTag{}).
+		Select("document_tags.kind, document_tags.slug, MIN(document_tags.name) AS name, COUNT(DISTINCT document_tags.pdf_file_id) AS documents").
+		Joins("JOIN pdf_files ON pdf_files.id = document_tags.pdf_file_id AND pdf_files.deleted_at IS NULL")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("document_tags.kind = ?", kind)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("document_tags.slug LIKE ?", "%"+tagSlug(q)+"%")
+	}
+
+	counts := []TagCount{}
+	if err := query.Group("document_tags.kind, document_tags.slug").
+		Order("documents DESC, slug ASC").
+		Limit(200).
+		Scan(&counts).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch tags")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Tags fetched successfully", counts)
+}
+
+// tagRequest - Body of creating or editing a tag
+type tagRequest struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// validate returns the kind and name of the request, defaulting to the
+// current ones when editing. Dates must be YYYY-MM-DD.
+func (r tagRequest) validate(currentKind, currentName string) (string, string, error) {
+	kind, name := strings.TrimSpace(r.Kind), strings.Join(strings.Fields(r.Name), " ")
+	if kind == "" {
+		kind = currentKind
+	}
+	if name == "" {
+		name = currentName
+	}
+
+	switch {
+	case !slices.Contains(tagging.Kinds, kind):
+		return "", "", fmt.Errorf("Invalid kind. Must be one of: %s", strings.Join(tagging.Kinds, ", "))
+	case name == "":
+		return "", "", fmt.Errorf("Name is required")
+	case len(name) > 255:
+		return "", "", fmt.Errorf("Name is too long (max 255 characters)")
+	}
+	if kind == tagging.KindDate {
+		if _, err := time.Parse("2006-01-02", name); err != nil {
+			return "", "", fmt.Errorf("Date tags must be YYYY-MM-DD")
+		}
+	}
+	return kind, name, nil
+}
+
+func findTag(c *fiber.Ctx) (*models.DocumentTag, error) {
+	var tag models.DocumentTag
+	if err := database.DB.Where("pdf_file_id = ?", c.Params("id")).First(&tag, c.Params("tagId")).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/tagging"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Values of TAGGING
+const (
+	taggingBuiltin  = "builtin"
+	taggingProvider = "provider"
+	taggingOff      = "off"
+)
+
+// maxTaggingChars bounds the page text read by the built-in extractor
+const maxTaggingChars = 200000
+
+// tagSchema - What the provider fills in to tag a document
+const tagSchema = `{
+	"type": "object",
+	"required": ["people", "organizations", "dates", "topics", "keywords"],
+	"properties": {
+		"people": {"type": "array", "items": {"type": "string"}, "maxItems": 10, "description": "full names of the people mentioned"},
+		"organizations": {"type": "array", "items": {"type": "string"}, "maxItems": 10, "description": "companies, institutions and agencies"},
+		"dates": {"type": "array", "items": {"type": "string", "format": "date"}, "maxItems": 10, "description": "key dates such as signing, effective and end dates"},
+		"topics": {"type": "array", "items": {"type": "string"}, "maxItems": 8, "description": "subjects of the document, two or three words each"},
+		"keywords": {"type": "array", "items": {"type": "string"}, "maxItems": 12, "description": "single words that best describe the document"}
+	}
+}`
+
+// tagAfterSummary tags the PDF of a completed job. Only summaries of the
+// whole document describe it: answers, extracted data and summaries of a page
+// range would replace its tags with those of a part, so they are skipped
+// (POST /api/pdfs/:id/tags/extract re-tags on request). A failure is only
+// logged, the summary is already saved.
+func tagAfterSummary(job *models.SummarizationJob, summaryLog *models.SummaryLog) {
+	if config.AppConfig.Tagging == taggingOff || summaryLog.PagesProcessed != nil {
+		return
+	}
+	switch job.Mode {
+	case models.ModeSimple, models.ModeStructured, models.ModeExtractive:
+	default:
+		return
+	}
+
+	providerName := ""
+	if config.AppConfig.Tagging == taggingProvider && !summaryLog.Extractive {
+		providerName = job.Provider
+		if providerName == "" {
+			providerName = ai.DefaultName()
+		}
+	}
+
+	summary := strings.Join(translationFields(summaryLog).texts, "\n")
+	if _, err := tagPDF(&job.PDFFile, providerName, summary); err != nil {
+		log.Printf("⚠️  Could not tag PDF %d: %v", job.PDFFileID, err)
+	}
+}
+
+// tagPDF replaces the extracted tags of pdf and returns its tags. A provider
+// reads the summary (or the document when there is none); without one, or
+// when it fails, the built-in extractor reads the page text.
+func tagPDF(pdf *models.PDFFile, providerName, summary string) ([]models.DocumentTag, error) {
+	var (
+		tags      []tagging.Tag
+		extractor = taggingBuiltin
+	)
+	if providerName != "" && providerName != ai.ProviderFake && providerName != ai.ProviderExtractive {
+		var err error
+		if tags, err = providerTags(pdf, providerName, summary); err != nil {
+			log.Printf("⚠️  %s could not tag PDF %d, using the built-in extractor: %v", providerName, pdf.ID, err)
+		} else {
+			extractor = providerName
+		}
+	}
+
+	if extractor == taggingBuiltin {
+		text, err := taggingText(pdf, summary)
+		if err != nil {
+			return nil, err
+		}
+		tags = tagging.Extract(text)
+	}
+
+	return storeTags(pdf, tags, extractor)
+}
+
+// taggingText is the page text of pdf, or summary when it has none
+func taggingText(pdf *models.PDFFile, summary string) (string, error) {
+	pages, err := pageTexts(pdf, "")
+	if err != nil && strings.TrimSpace(summary) == "" {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, page := range pages {
+		if sb.Len() >= maxTaggingChars {
+			break
+		}
+		sb.WriteString(page.Text)
+		sb.WriteString("\n\n")
+	}
+	if strings.TrimSpace(sb.String()) == "" {
+		return summary, nil
+	}
+	return sb.String(), nil
+}
+
+// providerTags asks the named provider to fill in tagSchema from summary,
+// or from the document when summary is empty
+func providerTags(pdf *models.PDFFile, providerName, summary string) ([]tagging.Tag, error) {
+	provider, err := ai.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := ai.ParseSchema([]byte(tagSchema))
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []ai.Page{{Number: 1, Text: summary}}
+	if strings.TrimSpace(summary) == "" {
+		if pages, err = pageTexts(pdf, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	req := ai.Request{
+		Files:  []ai.File{{Name: pdf.Filename, Pages: pages}},
+		Schema: schema,
+	}
+	result, err := ai.Call(context.Background(), provider, string(models.ModeExtract), req)
+	if err != nil {
+		return nil, err
+	}
+	estimateResultUsage(result, requestChars(req))
+	recordTaggingUsage(pdf, provider.Name(), usageOf(result.Usage(), result))
+
+	var data map[string][]string
+	if err := json.Unmarshal(result.Extract.Data, &data); err != nil {
+		return nil, fmt.Errorf("invalid tags: %w", err)
+	}
+
+	var tags []tagging.Tag
+	for field, kind := range map[string]string{
+		"people":        tagging.KindPerson,
+		"organizations": tagging.KindOrganization,
+		"dates":         tagging.KindDate,
+		"topics":        tagging.KindTopic,
+		"keywords":      tagging.KindKeyword,
+	} {
+		// The provider lists the most important first
+		for i, name := range data[field] {
+			tags = append(tags, tagging.Tag{Kind: kind, Name: name, Score: 1 - float64(i)/float64(len(data[field]))})
+		}
+	}
+	return tags, nil
+}
+
+// recordTaggingUsage stores the usage of a provider tagging call for the cost reports
+func recordTaggingUsage(pdf *models.PDFFile, providerName string, usage aiUsage) {
+	run := models.TaggingRun{
+		PDFFileID:        pdf.ID,
+		Provider:         providerName,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             usage.Cost(),
+		TokensEstimated:  usage.Estimated,
+	}
+	if usage.Model != "" {
+		run.AIModel = &usage.Model
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		log.Printf("⚠️  Could not record the tagging usage of PDF %d: %v", pdf.ID, err)
+	}
+}
+
+// storeTags replaces the extracted tags of pdf with tags, leaving out those
+// already added by hand and those deleted through the API, and returns all
+// tags of pdf
+func storeTags(pdf *models.PDFFile, tags []tagging.Tag, extractor string) ([]models.DocumentTag, error) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("pdf_file_id = ? AND source = ? AND deleted_at IS NULL", pdf.ID, models.TagSourceAuto).
+			Delete(&models.DocumentTag{}).Error; err != nil {
+			return err
+		}
+
+		// Manual tags and deleted tags of any source
+		var kept []models.DocumentTag
+		if err := tx.Unscoped().Where("pdf_file_id = ?", pdf.ID).Find(&kept).Error; err != nil {
+			return err
+		}
+		skip := make(map[string]bool, len(kept))
+		for _, tag := range kept {
+			skip[tag.Kind+":"+tag.Slug] = true
+		}
+
+		var rows []models.DocumentTag
+		for _, tag := range tags {
+			name := strings.Join(strings.Fields(tag.Name), " ")
+			slug := tagSlug(name)
+			if slug == "" || len(name) > 255 || skip[tag.Kind+":"+slug] {
+				continue
+			}
+			skip[tag.Kind+":"+slug] = true
+			rows = append(rows, models.DocumentTag{
+				PDFFileID: pdf.ID,
+				Kind:      tag.Kind,
+				Name:      name,
+				Slug:      slug,
+				Source:    models.TagSourceAuto,
+				Extractor: &extractor,
+				Score:     tag.Score,
+			})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store tags of PDF %d: %w", pdf.ID, err)
+	}
+
+	log.Printf("PDF %d tagged by %s", pdf.ID, extractor)
+	return documentTags(pdf.ID)
+}
+
+// documentTags returns the tags of a PDF by kind, most prominent first
+func documentTags(pdfID uint) ([]models.DocumentTag, error) {
+	tags := []models.DocumentTag{}
+	err := database.DB.Where("pdf_file_id = ?", pdfID).Order("kind ASC, score DESC, name ASC").Find(&tags).Error
+	return tags, err
+}
+
+// tagSlug is the lowercase form of a tag name that filters match
+func tagSlug(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
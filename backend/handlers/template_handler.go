@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CreatePromptTemplate stores a new template as version 1
+func CreatePromptTemplate(c *fiber.Ctx) error {
+	type TemplateRequest struct {
+		Name        string  `json:"name"`
+		Description *string `json:"description"`
+		Mode        string  `json:"mode"`     // simple, structured or qa
+		Language    *string `json:"language"` // optional, nil = any language
+		Template    string  `json:"template"` // uses {{document}}, {{language}}, {{question}}
+	}
+
+	var req TemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Name is required")
+	}
+	if err := ai.ValidateTemplate(req.Template, req.Mode); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid template: %s", err.Error()))
+	}
+
+	template := models.PromptTemplate{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Mode:        models.SummaryMode(req.Mode),
+		Language:    normalizeTemplateLanguage(req.Language),
+		Template:    req.Template,
+		Version:     1,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&template).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PromptTemplateVersion{
+			TemplateID: template.ID,
+			Version:    template.Version,
+			Template:   template.Template,
+		}).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create template")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Template created successfully", template)
+}
+
+// ListPromptTemplates lists templates, optionally filtered by mode, language and name
+func ListPromptTemplates(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.PromptTemplate{})
+
+	if mode := c.Query("mode"); mode != "" {
+		query = query.Where("mode = ?", mode)
+	}
+	if language := c.Query("language"); language != "" {
+		query = query.Where("(language IS NULL OR LOWER(language) = LOWER(?))", language)
+	}
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name ILIKE ?", "%"+name+"%")
+	}
+
+	var templates []models.PromptTemplate
+	if err := query.Order("name ASC, id ASC").Find(&templates).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch templates")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Templates fetched successfully", templates)
+}
+
+// GetPromptTemplate returns the current version of a template
+func GetPromptTemplate(c *fiber.Ctx) error {
+	var template models.PromptTemplate
+	if err := database.DB.First(&template, c.Params("templateId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Template not found")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Template fetched successfully", template)
+}
+
+// ListPromptTemplateVersions returns every version of a template, newest first
+func ListPromptTemplateVersions(c *fiber.Ctx) error {
+	var template models.PromptTemplate
+	if err := database.DB.Unscoped().First(&template, c.Params("templateId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Template not found")
+	}
+
+	var versions []models.PromptTemplateVersion
+	if err := database.DB.Where("template_id = ?", template.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch template versions")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Template versions fetched successfully", versions)
+}
+
+// UpdatePromptTemplate edits a template. Changing the template text creates a
+// new version; jobs that already ran keep pointing at the version they used.
+func UpdatePromptTemplate(c *fiber.Ctx) error {
+	type TemplateUpdateRequest struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Language    *string `json:"language"` // "" = any language
+		Template    *string `json:"template"`
+	}
+
+	var req TemplateUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	var template models.PromptTemplate
+	if err := database.DB.First(&template, c.Params("templateId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Template not found")
+	}
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Name cannot be empty")
+		}
+		template.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		template.Description = req.Description
+	}
+	if req.Language != nil {
+		template.Language = normalizeTemplateLanguage(req.Language)
+	}
+
+	newVersion := req.Template != nil && *req.Template != template.Template
+	if newVersion {
+		if err := ai.ValidateTemplate(*req.Template, string(template.Mode)); err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid template: %s", err.Error()))
+		}
+		template.Template = *req.Template
+		template.Version++
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&template).Error; err != nil {
+			return err
+		}
+		if !newVersion {
+			return nil
+		}
+		return tx.Create(&models.PromptTemplateVersion{
+			TemplateID: template.ID,
+			Version:    template.Version,
+			Template:   template.Template,
+		}).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to update template")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Template updated successfully", template)
+}
+
+// DeletePromptTemplate hides a template from new jobs; its versions are kept
+// so earlier jobs stay reproducible
+func DeletePromptTemplate(c *fiber.Ctx) error {
+	var template models.PromptTemplate
+	if err := database.DB.First(&template, c.Params("templateId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Template not found")
+	}
+
+	if err := database.DB.Delete(&template).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete template")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Template deleted successfully", nil)
+}
+
+// resolveTemplate loads the template a new job asked for and checks it fits the job
+func resolveTemplate(templateID uint, mode, language string) (*models.PromptTemplate, error) {
+	var template models.PromptTemplate
+	if err := database.DB.First(&template, templateID).Error; err != nil {
+		return nil, fmt.Errorf("template %d not found", templateID)
+	}
+	if string(template.Mode) != mode {
+		return nil, fmt.Errorf("template %d is for %s mode, not %s", templateID, template.Mode, mode)
+	}
+	if template.Language != nil && !strings.EqualFold(*template.Language, language) {
+		return nil, fmt.Errorf("template %d is for %s summaries, not %s", templateID, *template.Language, language)
+	}
+	return &template, nil
+}
+
+// jobPrompt returns the text of the exact template version recorded on job,
+// "" when the job uses the built-in prompt
+func jobPrompt(job *models.SummarizationJob) (string, error) {
+	if job.TemplateID == nil || job.TemplateVersion == nil {
+		return "", nil
+	}
+
+	var version models.PromptTemplateVersion
+	err := database.DB.Where("template_id = ? AND version = ?", *job.TemplateID, *job.TemplateVersion).First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ai.Permanent("template_not_found", "prompt template %d version %d not found", *job.TemplateID, *job.TemplateVersion)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load prompt template: %w", err)
+	}
+	return version.Template, nil
+}
+
+// normalizeTemplateLanguage treats a blank language as "any"
+func normalizeTemplateLanguage(language *string) *string {
+	if language == nil || strings.TrimSpace(*language) == "" {
+		return nil
+	}
+	value := strings.ToLower(strings.TrimSpace(*language))
+	return &value
+}
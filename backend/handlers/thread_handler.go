@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"fmt"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxHistoryTurns is how many earlier messages of a thread are sent with a question
+const maxHistoryTurns = 10
+
+// CreateThread starts a conversation about a PDF
+func CreateThread(c *fiber.Ctx) error {
+	type ThreadRequest struct {
+		Title    *string `json:"title"`    // optional
+		Language *string `json:"language"` // optional, nil = the document's language
+		Pages    *string `json:"pages"`    // optional, e.g., "1-5, 7, 9"
+		Provider string  `json:"provider"` // optional, defaults to AI_PROVIDER
+	}
+
+	var req ThreadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	provider, err := ai.Get(req.Provider)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Invalid provider. Must be one of: %s", strings.Join(ai.Names(), ", ")))
+	}
+
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	thread := models.QAThread{
+		PDFFileID:   pdf.ID,
+		Title:       trimmedOrNil(req.Title),
+		Language:    trimmedOrNil(req.Language),
+		Pages:       trimmedOrNil(req.Pages),
+		Provider:    provider.Name(),
+		SubmitterID: utils.ClientID(c),
+	}
+	if thread.Language != nil {
+		language := strings.ToLower(*thread.Language)
+		thread.Language = &language
+	}
+
+	if err := database.DB.Create(&thread).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create thread")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Thread created successfully", newThreadResponse(&thread, pdf.OriginalFilename, 0))
+}
+
+// ListThreads lists the threads of a PDF, most recently active first
+func ListThreads(c *fiber.Ctx) error {
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, c.Params("id")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	var threads []models.QAThread
+	if err := database.DB.Where("pdf_file_id = ?", pdf.ID).Order("updated_at DESC").Find(&threads).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch threads")
+	}
+
+	// Message counts of all threads in one query
+	type threadCount struct {
+		ThreadID uint
+		Count    int64
+	}
+	var counts []threadCount
+	database.DB.Model(&models.QAMessage{}).
+		Select("thread_id, COUNT(*) AS count").
+		Where("thread_id IN (SELECT id FROM qa_threads WHERE pdf_file_id = ?)", pdf.ID).
+		Group("thread_id").
+		Scan(&counts)
+	countByThread := make(map[uint]int64)
+	for _, count := range counts {
+		countByThread[count.ThreadID] = count.Count
+	}
+
+	responses := []models.QAThreadResponse{}
+	for i := range threads {
+		responses = append(responses, newThreadResponse(&threads[i], pdf.OriginalFilename, countByThread[threads[i].ID]))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Threads fetched successfully", responses)
+}
+
+// GetThread returns a thread with all of its messages
+func GetThread(c *fiber.Ctx) error {
+	thread, err := findThread(c.Params("threadId"))
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Thread not found")
+	}
+
+	messages, err := threadMessages(thread.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch messages")
+	}
+
+	var pdf models.PDFFile
+	database.DB.Select("original_filename").First(&pdf, thread.PDFFileID)
+
+	response := newThreadResponse(thread, pdf.OriginalFilename, int64(len(messages)))
+	for i := range messages {
+		response.Messages = append(response.Messages, newMessageResponse(&messages[i]))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Thread fetched successfully", response)
+}
+
+// DeleteThread deletes a thread and its messages
+func DeleteThread(c *fiber.Ctx) error {
+	thread, err := findThread(c.Params("threadId"))
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Thread not found")
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("thread_id = ?", thread.ID).Delete(&models.QAMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(thread).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete thread")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Thread deleted successfully", nil)
+}
+
+// ListThreadMessages lists the messages of a thread, oldest first
+func ListThreadMessages(c *fiber.Ctx) error {
+	thread, err := findThread(c.Params("threadId"))
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Thread not found")
+	}
+
+	messages, err := threadMessages(thread.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch messages")
+	}
+
+	responses := []models.QAMessageResponse{}
+	for i := range messages {
+		responses = append(responses, newMessageResponse(&messages[i]))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Messages fetched successfully", responses)
+}
+
+// CreateThreadMessage answers a question in a thread. The latest turns of the
+// thread go to the provider with it, so follow-up questions can refer to
+// earlier answers.
+func CreateThreadMessage(c *fiber.Ctx) error {
+	type MessageRequest struct {
+		Question string `json:"question"`
+	}
+
+	var req MessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	question := strings.TrimSpace(req.Question)
+	if question == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Question is required")
+	}
+
+	thread, err := findThread(c.Params("threadId"))
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Thread not found")
+	}
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, thread.PDFFileID).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+
+	history, err := threadHistory(thread.ID)
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch messages")
+	}
+
+	startTime := time.Now()
+	result, err := callAIService(aiCall{
+		Provider: thread.Provider,
+		PDF:      &pdf,
+		Mode:     string(models.ModeQA),
+		Language: thread.Language,
+		Pages:    thread.Pages,
+		Question: &question,
+		History:  history,
+	})
+	if err != nil {
+		return aiErrorResponse(c, err)
+	}
+	if result.QA == nil {
+		return aiErrorResponse(c, fmt.Errorf("provider returned no answer"))
+	}
+	usage := usageOf(result.Usage(), result)
+
+	answer, citations := citedAnswer(result.QA.Answer)
+	message := models.QAMessage{
+		ThreadID:         thread.ID,
+		Question:         question,
+		Answer:           answer,
+		Language:         answerLanguage(thread.Language, answer),
+		Citations:        verifyCitations(citations, &pdf),
+		ProcessingTime:   time.Since(startTime).Seconds(),
+		Provider:         thread.Provider,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             usage.Cost(),
+		TokensEstimated:  usage.Estimated,
+		Extractive:       result.Provider() == ai.ProviderExtractive,
+	}
+	if usage.Model != "" {
+		message.AIModel = &usage.Model
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		return tx.Model(thread).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to save message")
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Question answered successfully", newMessageResponse(&message))
+}
+
+func findThread(id string) (*models.QAThread, error) {
+	var thread models.QAThread
+	if err := database.DB.First(&thread, id).Error; err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+func threadMessages(threadID uint) ([]models.QAMessage, error) {
+	var messages []models.QAMessage
+	err := database.DB.Where("thread_id = ?", threadID).Order("created_at ASC, id ASC").Find(&messages).Error
+	return messages, err
+}
+
+// threadHistory returns the latest maxHistoryTurns messages of a thread as
+// conversation turns, oldest first
+func threadHistory(threadID uint) ([]ai.Turn, error) {
+	var messages []models.QAMessage
+	err := database.DB.Where("thread_id = ?", threadID).
+		Order("created_at DESC, id DESC").
+		Limit(maxHistoryTurns).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	turns := make([]ai.Turn, len(messages))
+	for i, message := range messages {
+		turns[len(messages)-1-i] = ai.Turn{Question: message.Question, Answer: message.Answer}
+	}
+	return turns, nil
+}
+
+// answerLanguage is the thread's language, or else the one detected in answer
+func answerLanguage(language *string, answer string) string {
+	if language != nil {
+		return *language
+	}
+	return utils.DetectLanguage(answer)
+}
+
+func trimmedOrNil(value *string) *string {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	return &trimmed
+}
+
+func newThreadResponse(thread *models.QAThread, filename string, messageCount int64) models.QAThreadResponse {
+	return models.QAThreadResponse{
+		ID:           thread.ID,
+		PDFFileID:    thread.PDFFileID,
+		PDFFilename:  filename,
+		Title:        thread.Title,
+		Language:     thread.Language,
+		Pages:        thread.Pages,
+		Provider:     thread.Provider,
+		MessageCount: messageCount,
+		CreatedAt:    thread.CreatedAt,
+		UpdatedAt:    thread.UpdatedAt,
+	}
+}
+
+func newMessageResponse(message *models.QAMessage) models.QAMessageResponse {
+	return models.QAMessageResponse{
+		ID:               message.ID,
+		ThreadID:         message.ThreadID,
+		Question:         message.Question,
+		Answer:           message.Answer,
+		Language:         message.Language,
+		Citations:        rawJSON(message.Citations),
+		ProcessingTime:   message.ProcessingTime,
+		Provider:         message.Provider,
+		AIModel:          message.AIModel,
+		PromptTokens:     message.PromptTokens,
+		CompletionTokens: message.CompletionTokens,
+		Cost:             message.Cost,
+		TokensEstimated:  message.TokensEstimated,
+		Extractive:       message.Extractive,
+		CreatedAt:        message.CreatedAt,
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/queue"
+	"pdf-summarizer-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TranslateSummary creates a job translating a stored summary into another
+// language. The PDF is not read again; the new summary links to its source.
+func TranslateSummary(c *fiber.Ctx) error {
+	type TranslateRequest struct {
+		Language  string   `json:"language"`   // required, e.g. "indonesian"
+		Provider  string   `json:"provider"`   // optional, defaults to AI_PROVIDER
+		BudgetUSD *float64 `json:"budget_usd"` // optional cost cap
+	}
+
+	var req TranslateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	language := strings.ToLower(strings.TrimSpace(req.Language))
+	if language == "" {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Language is required")
+	}
+	if req.BudgetUSD != nil && *req.BudgetUSD <= 0 {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "budget_usd must be greater than 0")
+	}
+
+	var source models.SummaryLog
+	if err := database.DB.First(&source, c.Params("summaryId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Summary not found")
+	}
+	var pdf models.PDFFile
+	if err := database.DB.First(&pdf, source.PDFFileID).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "PDF not found")
+	}
+	if source.Mode == models.ModeExtract {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Extracted data is not translated; run an extract job with the target language instead")
+	}
+	if source.Mode == models.ModeCompare {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Comparisons are not translated; run a compare job with the target language instead")
+	}
+	if strings.EqualFold(source.Language, language) {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, fmt.Sprintf("Summary is already in %s", source.Language))
+	}
+
+	provider, err := ai.Get(req.Provider)
+	if err != nil || provider.Name() == ai.ProviderExtractive {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid provider for translation")
+	}
+
+	job := models.SummarizationJob{
+		PDFFileID:       source.PDFFileID,
+		Status:          models.JobStatusPending,
+		Mode:            models.ModeTranslate,
+		Language:        language,
+		Pages:           source.PagesProcessed,
+		Question:        source.QAQuestion,
+		SubmitterID:     utils.ClientID(c),
+		Provider:        provider.Name(),
+		MaxRetries:      3,
+		BudgetCap:       req.BudgetUSD,
+		SourceSummaryID: &source.ID,
+	}
+
+	// Reuse an existing translation unless the caller forces a fresh run
+	if !c.QueryBool("force") {
+		if cached, err := findCachedTranslation(&job); err == nil {
+			now := time.Now()
+			job.Status = models.JobStatusCompleted
+			job.StartedAt = &now
+			job.CompletedAt = &now
+			job.SummaryLogID = &cached.ID
+			job.CacheHit = true
+
+			if err := database.DB.Create(&job).Error; err != nil {
+				return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create job")
+			}
+
+			log.Printf("Job %d served from cached translation %d", job.ID, cached.ID)
+			return utils.SuccessResponse(c, fiber.StatusOK, "Translation found. Returning cached result.", newJobResponse(&job, pdf.OriginalFilename))
+		}
+
+		if existing, err := findInFlightJob(&job); err == nil {
+			return utils.SuccessResponse(c, fiber.StatusOK, "Identical translation already in progress.", newJobResponse(existing, pdf.OriginalFilename))
+		}
+	}
+
+	if err := database.DB.Create(&job).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to create job")
+	}
+
+	if err := queue.PublishJob(job.ID, job.SubmitterID, job.Provider); err != nil {
+		log.Printf("Failed to publish job to queue: %v", err)
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusCreated, "Translation job created successfully.", newJobResponse(&job, pdf.OriginalFilename))
+}
+
+// ListTranslations lists the translations of a summary, newest first
+func ListTranslations(c *fiber.Ctx) error {
+	var source models.SummaryLog
+	if err := database.DB.First(&source, c.Params("summaryId")).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusNotFound, "Summary not found")
+	}
+
+	var translations []models.SummaryLog
+	if err := database.DB.Where("source_summary_id = ?", source.ID).Order("created_at DESC").Find(&translations).Error; err != nil {
+		return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to fetch translations")
+	}
+
+	responses := []models.SummaryLogResponse{}
+	for _, translation := range translations {
+		responses = append(responses, newSummaryResponse(&translation))
+	}
+
+	return utils.SuccessResponse(c, fiber.StatusOK, "Translations fetched successfully", responses)
+}
+
+// processTranslation runs a translate job: every text field of the source
+// summary is translated in one call and saved as a new summary of the same mode
+func processTranslation(job *models.SummarizationJob) error {
+	if job.SourceSummaryID == nil {
+		return failJob(job, ai.Permanent("summary_not_found", "translate job %d has no source summary", job.ID))
+	}
+	var source models.SummaryLog
+	if err := database.DB.First(&source, *job.SourceSummaryID).Error; err != nil {
+		return failJob(job, ai.Permanent("summary_not_found", "source summary %d not found", *job.SourceSummaryID))
+	}
+	if budgetExceeded(job) {
+		return failJob(job, errBudgetExceeded(job))
+	}
+
+	startTime := time.Now()
+	fields := translationFields(&source)
+	if len(fields.texts) == 0 {
+		return failJob(job, ai.Permanent(ai.CodeNoText, "summary %d has no text to translate", source.ID))
+	}
+
+	translations, usage, err := callAITranslate(job.Provider, fields.texts, job.Language)
+	recordJobUsage(job, usage)
+	if err != nil {
+		return failJob(job, err)
+	}
+
+	summaryLog := models.SummaryLog{
+		PDFFileID:      source.PDFFileID,
+		Mode:           source.Mode,
+		Language:       job.Language,
+		PagesProcessed: source.PagesProcessed,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		Provider:       job.Provider,
+
+		AIModel:          job.AIModel,
+		PromptTokens:     job.PromptTokens,
+		CompletionTokens: job.CompletionTokens,
+		Cost:             job.Cost,
+		TokensEstimated:  job.TokensEstimated,
+
+		SourceSummaryID: &source.ID,
+		Style:           source.Style,
+
+		// Citations of the source statements, in the same order as the translated ones
+		Citations: source.Citations,
+	}
+	fields.apply(&summaryLog, translations)
+
+	return completeJob(job, &summaryLog)
+}
+
+// summaryFields - The translatable text of a summary, flattened into one list
+type summaryFields struct {
+	texts []string
+
+	summaryText, executiveSummary, qaQuestion, qaAnswer int // Index in texts, -1 if unset
+	bullets, highlights                                 []int
+	hasBullets, hasHighlights                           bool
+}
+
+// translationFields collects the non-empty text fields and list items of summary
+func translationFields(summary *models.SummaryLog) summaryFields {
+	fields := summaryFields{}
+	add := func(value *string) int {
+		if value == nil || strings.TrimSpace(*value) == "" {
+			return -1
+		}
+		fields.texts = append(fields.texts, *value)
+		return len(fields.texts) - 1
+	}
+	addList := func(value *string) ([]int, bool) {
+		var items []string
+		if value == nil || json.Unmarshal([]byte(*value), &items) != nil {
+			return nil, false
+		}
+		var indexes []int
+		for i := range items {
+			if index := add(&items[i]); index >= 0 {
+				indexes = append(indexes, index)
+			}
+		}
+		return indexes, true
+	}
+
+	fields.summaryText = add(summary.SummaryText)
+	fields.executiveSummary = add(summary.ExecutiveSummary)
+	fields.bullets, fields.hasBullets = addList(summary.Bullets)
+	fields.highlights, fields.hasHighlights = addList(summary.Highlights)
+	fields.qaQuestion = add(summary.QAQuestion)
+	fields.qaAnswer = add(summary.QAAnswer)
+	return fields
+}
+
+// apply writes the translations back into the same fields of summary
+func (f summaryFields) apply(summary *models.SummaryLog, translations []string) {
+	text := func(index int) *string {
+		if index < 0 {
+			return nil
+		}
+		return &translations[index]
+	}
+	list := func(indexes []int) *string {
+		items := make([]string, len(indexes))
+		for i, index := range indexes {
+			items[i] = translations[index]
+		}
+		return jsonList(items)
+	}
+
+	summary.SummaryText = text(f.summaryText)
+	summary.ExecutiveSummary = text(f.executiveSummary)
+	summary.QAQuestion = text(f.qaQuestion)
+	summary.QAAnswer = text(f.qaAnswer)
+	if f.hasBullets {
+		summary.Bullets = list(f.bullets)
+	}
+	if f.hasHighlights {
+		summary.Highlights = list(f.highlights)
+	}
+}
+
+// callAITranslate translates texts with the named provider. There is no
+// extractive fallback: while the circuit is open the job waits here, whatever
+// AI_EXTRACTIVE_FALLBACK says, instead of cycling through the queue.
+func callAITranslate(providerName string, texts []string, language string) ([]string, aiUsage, error) {
+	provider, err := ai.Get(providerName)
+	if err != nil {
+		return nil, aiUsage{}, err
+	}
+	if err := ai.WaitAvailable(context.Background(), provider.Name()); err != nil {
+		return nil, aiUsage{}, err
+	}
+
+	acquireAISlot()
+	defer releaseAISlot()
+
+	resp, err := provider.Translate(context.Background(), texts, language)
+	if err != nil {
+		return nil, aiUsage{}, err
+	}
+	return resp.Translations, usageOf(charUsage(resp.Usage, textChars(texts...), resp), resp), nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// charsPerToken is the fallback ratio when the AI service reports no token counts
+const charsPerToken = 4
+
+// aiUsage - Token usage of one or more AI calls
+type aiUsage struct {
+	Model            string
+	PromptTokens     int64
+	CompletionTokens int64
+	Estimated        bool // Derived from character counts
+	Extractive       bool // Produced by the built-in extractive summarizer
+}
+
+// usageOf converts the usage reported with an AI response. When the provider
+// reported no token counts it estimates from characters; see charUsage.
+func usageOf(reported *ai.Usage, output interface{}) aiUsage {
+	if reported == nil {
+		// Nothing reported and no input known: estimate the output side from the returned JSON
+		data, _ := json.Marshal(output)
+		return aiUsage{CompletionTokens: int64(len(data)) / charsPerToken, Estimated: true}
+	}
+
+	if reported.Model == ai.ProviderExtractive {
+		// No model ran, nothing to bill
+		return aiUsage{Extractive: true}
+	}
+
+	usage := aiUsage{
+		Model:            reported.Model,
+		PromptTokens:     reported.PromptTokens,
+		CompletionTokens: reported.CompletionTokens,
+	}
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		usage.PromptTokens = reported.InputChars / charsPerToken
+		usage.CompletionTokens = reported.OutputChars / charsPerToken
+		usage.Estimated = true
+	}
+	return usage
+}
+
+// charUsage returns the usage a provider reported or, when it reported none,
+// the characters sent and returned by the call, so usageOf estimates the
+// prompt as well as the completion
+func charUsage(reported *ai.Usage, inputChars int, output interface{}) *ai.Usage {
+	if reported != nil {
+		return reported
+	}
+	data, _ := json.Marshal(output)
+	return &ai.Usage{InputChars: int64(inputChars), OutputChars: int64(len(data)), Calls: 1}
+}
+
+// estimateResultUsage attaches character counts to a result without usage
+func estimateResultUsage(result *ai.Result, inputChars int) {
+	if result.Usage() == nil {
+		result.AddUsage(charUsage(nil, inputChars, result))
+	}
+}
+
+// requestChars counts the characters a request sends: the page text,
+// question, earlier turns, prompt template and schema
+func requestChars(req ai.Request) int {
+	chars := len(req.Question) + len(req.Prompt)
+	for _, file := range req.Files {
+		for _, page := range file.Pages {
+			chars += len(page.Text)
+		}
+	}
+	for _, turn := range req.History {
+		chars += len(turn.Question) + len(turn.Answer)
+	}
+	if req.Schema != nil {
+		chars += len(req.Schema.String())
+	}
+	return chars
+}
+
+// textChars counts the characters of texts
+func textChars(texts ...string) int {
+	chars := 0
+	for _, text := range texts {
+		chars += len(text)
+	}
+	return chars
+}
+
+// Add accumulates another call's usage
+func (u *aiUsage) Add(other aiUsage) {
+	if u.Model == "" {
+		u.Model = other.Model
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Estimated = u.Estimated || other.Estimated
+	u.Extractive = u.Extractive || other.Extractive
+}
+
+// Cost converts the usage to USD with the configured price table
+func (u aiUsage) Cost() float64 {
+	price, ok := config.AppConfig.AIPriceTable[u.Model]
+	if !ok {
+		price = config.AppConfig.AIPriceTable["default"]
+	}
+	return (float64(u.PromptTokens)*price.Input + float64(u.CompletionTokens)*price.Output) / 1_000_000
+}
+
+// applyUsage copies usage totals onto a summary
+func applyUsage(summaryLog *models.SummaryLog, usage aiUsage) {
+	if usage.Model != "" {
+		model := usage.Model
+		summaryLog.AIModel = &model
+	}
+	summaryLog.PromptTokens = usage.PromptTokens
+	summaryLog.CompletionTokens = usage.CompletionTokens
+	summaryLog.Cost = usage.Cost()
+	summaryLog.TokensEstimated = usage.Estimated
+}
+
+// recordJobUsage adds usage to the job's running totals without rewriting the row
+func recordJobUsage(job *models.SummarizationJob, usage aiUsage) {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+	cost := usage.Cost()
+
+	job.PromptTokens += usage.PromptTokens
+	job.CompletionTokens += usage.CompletionTokens
+	job.Cost += cost
+	job.TokensEstimated = job.TokensEstimated || usage.Estimated
+	if job.AIModel == nil && usage.Model != "" {
+		job.AIModel = &usage.Model
+	}
+
+	updates := map[string]interface{}{
+		"prompt_tokens":     gorm.Expr("prompt_tokens + ?", usage.PromptTokens),
+		"completion_tokens": gorm.Expr("completion_tokens + ?", usage.CompletionTokens),
+		"cost":              gorm.Expr("cost + ?", cost),
+		"tokens_estimated":  job.TokensEstimated,
+	}
+	if job.AIModel != nil {
+		updates["ai_model"] = *job.AIModel
+	}
+	database.DB.Model(job).UpdateColumns(updates)
+}
+
+// budgetExceeded reports whether the job has spent more than its budget cap
+func budgetExceeded(job *models.SummarizationJob) bool {
+	return job.BudgetCap != nil && job.Cost > *job.BudgetCap
+}
+
+// errBudgetExceeded reports the spend that stopped the job
+func errBudgetExceeded(job *models.SummarizationJob) error {
+	return ai.Permanent(ai.CodeBudgetExceeded, "budget exceeded: spent $%.4f of $%.4f cap", job.Cost, *job.BudgetCap)
+}
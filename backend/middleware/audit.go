@@ -66,6 +66,9 @@ func extractResource(c *fiber.Ctx) string {
 	if id := c.Params("summaryId"); id != "" {
 		return fmt.Sprintf("summary:%s", id)
 	}
+	if id := c.Params("templateId"); id != "" {
+		return fmt.Sprintf("template:%s", id)
+	}
 	return c.Path()
 }
 
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"pdf-summarizer-backend/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyLease is how long a key stays claimed by a request in flight
+// beyond the AI timeout. A claim left behind by a dead process expires after
+// it instead of answering 409 until the replay TTL runs out.
+const idempotencyLease = time.Minute
+
+// idempotencySweepInterval is how often expired keys are deleted
+const idempotencySweepInterval = 10 * time.Minute
+
+// sweepOnce starts one sweeper per process, however many routes use the middleware
+var sweepOnce sync.Once
+
+// IdempotencyMiddleware replays the stored response for a repeated Idempotency-Key
+func IdempotencyMiddleware() fiber.Handler {
+	sweepOnce.Do(func() { go sweepIdempotencyKeys() })
+
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimSpace(c.Get(IdempotencyHeader))
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		}
+
+		clientID := utils.ClientID(c)
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		// Drop expired keys and abandoned claims so they can be reused
+		database.DB.Where("client_id = ? AND key = ? AND expires_at < ?", clientID, key, time.Now()).
+			Delete(&models.IdempotencyKey{})
+
+		// The claim is leased for as long as the request may run; the replay TTL starts once it is answered
+		lease := time.Duration(config.AppConfig.AITimeout)*time.Second + idempotencyLease
+
+		record := models.IdempotencyKey{
+			ClientID:    clientID,
+			Key:         key,
+			Method:      c.Method(),
+			Path:        c.Path(),
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().Add(lease),
+		}
+
+		// Claim the key; a conflict means it has been seen before
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			log.Printf("Failed to store idempotency key: %v", result.Error)
+			return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to process Idempotency-Key")
+		}
+
+		if result.RowsAffected == 0 {
+			var existing models.IdempotencyKey
+			if err := database.DB.Where("client_id = ? AND key = ?", clientID, key).First(&existing).Error; err != nil {
+				return utils.ErrorResponse(c, fiber.StatusInternalServerError, "Failed to process Idempotency-Key")
+			}
+			return replayIdempotentResponse(c, &existing, fingerprint)
+		}
+
+		// Let the client retry server-side failures under the same key, also
+		// when the handler panics
+		answered := false
+		defer func() {
+			if !answered {
+				database.DB.Delete(&record)
+			}
+		}()
+
+		err = c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil || status >= 500 {
+			return err
+		}
+
+		body := string(c.Response().Body())
+		database.DB.Model(&record).Updates(map[string]interface{}{
+			"status_code":   status,
+			"response_body": body,
+			"expires_at":    time.Now().Add(time.Duration(config.AppConfig.IdempotencyTTL) * time.Hour),
+		})
+		answered = true
+
+		return nil
+	}
+}
+
+// replayIdempotentResponse answers a repeated key from the stored record
+func replayIdempotentResponse(c *fiber.Ctx, record *models.IdempotencyKey, fingerprint string) error {
+	if record.Method != c.Method() || record.Path != c.Path() || record.Fingerprint != fingerprint {
+		return utils.ErrorResponse(c, fiber.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request payload")
+	}
+
+	if record.StatusCode == 0 || record.ResponseBody == nil {
+		return utils.ErrorResponse(c, fiber.StatusConflict, "A request with this Idempotency-Key is still being processed")
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(record.StatusCode).SendString(*record.ResponseBody)
+}
+
+// requestFingerprint hashes the parts of the request that define its payload.
+// Multipart bodies are hashed by field and file content, since clients pick a
+// fresh boundary on every attempt.
+func requestFingerprint(c *fiber.Ctx) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		h.Write(c.Body())
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "", err
+	}
+
+	fields := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	for _, name := range fields {
+		h.Write([]byte("field:" + name + "=" + strings.Join(form.Value[name], ",") + "\n"))
+	}
+
+	files := make([]string, 0, len(form.File))
+	for name := range form.File {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		for _, header := range form.File[name] {
+			h.Write([]byte("file:" + name + "=" + header.Filename + "\n"))
+			src, err := header.Open()
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(h, src)
+			src.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sweepIdempotencyKeys deletes expired keys and abandoned claims, which are
+// otherwise only dropped when their client sends the same key again
+func sweepIdempotencyKeys() {
+	ticker := time.NewTicker(idempotencySweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+		if result.Error != nil {
+			log.Printf("Failed to delete expired idempotency keys: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired idempotency keys", result.RowsAffected)
+		}
+	}
+}
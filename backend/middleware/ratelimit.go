@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"math"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/utils"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tokenBucket - Refills at a fixed rate up to its burst capacity
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter - In-memory buckets per client for one route group
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   config.RateLimit
+	buckets map[string]*tokenBucket
+}
+
+// RateLimitMiddleware limits requests per client (API key or IP) with a token bucket.
+// Buckets are kept in memory, so each API instance enforces the limit separately.
+func RateLimitMiddleware(limit config.RateLimit) fiber.Handler {
+	if limit.Rate <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	limiter := &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+	go limiter.cleanup()
+
+	return func(c *fiber.Ctx) error {
+		allowed, remaining, retryAfter := limiter.take(utils.ClientID(c))
+
+		c.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+		if !allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return utils.ErrorResponse(c, fiber.StatusTooManyRequests, "Rate limit exceeded. Please slow down.")
+		}
+
+		return c.Next()
+	}
+}
+
+// take consumes one token for client, reporting how long to wait when empty
+func (l *rateLimiter) take(client string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), lastSeen: now}
+		l.buckets[client] = bucket
+	}
+
+	// Refill since last request
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(float64(l.limit.Burst), bucket.tokens+elapsed*l.limit.Rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.limit.Rate * float64(time.Second))
+		return false, 0, wait
+	}
+
+	bucket.tokens--
+	return true, int(bucket.tokens), 0
+}
+
+// cleanup drops buckets that have been idle long enough to be full again
+func (l *rateLimiter) cleanup() {
+	idle := time.Duration(float64(l.limit.Burst)/l.limit.Rate*float64(time.Second)) + time.Minute
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.mu.Lock()
+		for client, bucket := range l.buckets {
+			if time.Since(bucket.lastSeen) > idle {
+				delete(l.buckets, client)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Collection summary triggers
+const (
+	CollectionTriggerAPI     = "api"     // Requested through the API
+	CollectionTriggerMembers = "members" // Queued because the members changed
+)
+
+// Collection - A named group of PDFs, e.g. the documents of one project.
+// A PDF can belong to any number of collections.
+type Collection struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"size:255;not null;index" json:"name"`
+	Description *string        `gorm:"type:text" json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// CollectionMember - A PDF in a collection, with its digest: the map step of
+// the collection summary, kept so a rerun only redoes the documents that changed
+type CollectionMember struct {
+	CollectionID uint      `gorm:"primaryKey" json:"collection_id"`
+	PDFFileID    uint      `gorm:"primaryKey;index" json:"pdf_file_id"`
+	AddedAt      time.Time `gorm:"not null" json:"added_at"`
+
+	Digest          *string    `gorm:"type:text" json:"-"`
+	DigestLanguage  *string    `gorm:"size:50" json:"digest_language"`
+	DigestSummaryID *uint      `json:"digest_summary_id"` // Summary the digest was taken from, nil = summarized for the collection
+	DigestedAt      *time.Time `json:"digested_at"`
+}
+
+// CollectionSummary - A synthesis across the members of a collection. It is
+// queued and processed by the worker like a summarization job.
+type CollectionSummary struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID uint      `gorm:"not null;index" json:"collection_id"`
+	Status       JobStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Language     string    `gorm:"size:50;not null;default:'english'" json:"language"`
+	Provider     string    `gorm:"size:50;not null" json:"provider"`
+	Force        bool      `gorm:"default:false" json:"force"`      // Every member summarized again, nothing reused
+	Trigger      string    `gorm:"size:20;not null" json:"trigger"` // api, or members when queued by a membership change
+	SubmitterID  string    `gorm:"size:255;index" json:"submitter_id"`
+
+	// Retry mechanism
+	RetryCount int     `gorm:"default:0" json:"retry_count"`
+	MaxRetries int     `gorm:"default:3" json:"max_retries"`
+	ErrorMsg   *string `gorm:"type:text" json:"error_msg"`
+
+	// Result
+	Summary     *string `gorm:"type:text" json:"summary"`
+	Members     *string `gorm:"type:jsonb" json:"members"`       // []CollectionSummaryMember, the documents summarized
+	Fingerprint *string `gorm:"size:64;index" json:"-"`          // Hash of the language and member digests
+	Summarized  int     `gorm:"default:0" json:"summarized"`     // Members summarized by this run
+	Reused      int     `gorm:"default:0" json:"reused"`         // Members whose digest from an earlier run was reused
+	CacheHit    bool    `gorm:"default:false" json:"cache_hit"`  // Digests unchanged: an earlier synthesis was reused
+	Extractive  bool    `gorm:"default:false" json:"extractive"` // A step fell back to the extractive summarizer
+
+	// AI usage and cost of the map and reduce calls
+	AIModel          *string `gorm:"size:100" json:"ai_model"`
+	PromptTokens     int64   `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64   `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64 `gorm:"default:0" json:"cost"` // USD
+	TokensEstimated  bool    `gorm:"default:false" json:"tokens_estimated"`
+
+	ProcessingTime float64    `gorm:"default:0" json:"processing_time"`
+	StartedAt      *time.Time `json:"started_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CollectionSummaryMember - A document of a collection summary and where its digest came from
+type CollectionSummaryMember struct {
+	PDFFileID uint   `json:"pdf_file_id"`
+	Filename  string `json:"filename"`
+	SummaryID *uint  `json:"summary_id"` // Stored summary used, nil = summarized for the collection
+	Reused    bool   `json:"reused"`     // Digest of an earlier run
+}
+
+// CollectionResponse - A collection with its member count and latest summary
+type CollectionResponse struct {
+	ID            uint                       `json:"id"`
+	Name          string                     `json:"name"`
+	Description   *string                    `json:"description"`
+	MemberCount   int64                      `json:"member_count"`
+	Members       []CollectionMemberResponse `json:"members,omitempty"`
+	LatestSummary *CollectionSummaryResponse `json:"latest_summary"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	UpdatedAt     time.Time                  `json:"updated_at"`
+}
+
+// CollectionMemberResponse - A PDF of a collection
+type CollectionMemberResponse struct {
+	PDFFileID        uint       `json:"pdf_file_id"`
+	OriginalFilename string     `json:"original_filename"`
+	TotalPages       *int       `json:"total_pages"`
+	AddedAt          time.Time  `json:"added_at"`
+	Digested         bool       `json:"digested"` // Has a digest in DigestLanguage
+	DigestLanguage   *string    `json:"digest_language"`
+	DigestSummaryID  *uint      `json:"digest_summary_id"`
+	DigestedAt       *time.Time `json:"digested_at"`
+}
+
+type CollectionSummaryResponse struct {
+	ID               uint            `json:"id"`
+	CollectionID     uint            `json:"collection_id"`
+	Status           JobStatus       `json:"status"`
+	Language         string          `json:"language"`
+	Provider         string          `json:"provider"`
+	Force            bool            `json:"force"`
+	Trigger          string          `json:"trigger"`
+	RetryCount       int             `json:"retry_count"`
+	ErrorMsg         *string         `json:"error_msg"`
+	Summary          *string         `json:"summary"`
+	Members          json.RawMessage `json:"members,omitempty"`
+	Summarized       int             `json:"summarized"`
+	Reused           int             `json:"reused"`
+	CacheHit         bool            `json:"cache_hit"`
+	Extractive       bool            `json:"extractive"`
+	AIModel          *string         `json:"ai_model"`
+	PromptTokens     int64           `json:"prompt_tokens"`
+	CompletionTokens int64           `json:"completion_tokens"`
+	Cost             float64         `json:"cost"`
+	TokensEstimated  bool            `json:"tokens_estimated"`
+	ProcessingTime   float64         `json:"processing_time"`
+	StartedAt        *time.Time      `json:"started_at"`
+	CompletedAt      *time.Time      `json:"completed_at"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
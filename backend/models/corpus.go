@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CorpusQuestion - A question answered from the passages most similar to it
+// across all documents, logged with that retrieval set
+type CorpusQuestion struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	Question          string    `gorm:"type:text;not null" json:"question"`
+	Answer            string    `gorm:"type:text;not null" json:"answer"`
+	Language          *string   `gorm:"size:50" json:"language"`        // nil = the language of the question
+	PDFFileIDs        *string   `gorm:"type:jsonb" json:"pdf_file_ids"` // Documents searched, nil = all
+	TopK              int       `gorm:"not null" json:"top_k"`          // Passages retrieved
+	Retrieved         *string   `gorm:"type:jsonb" json:"retrieved"`    // []RetrievedPassage, in rank order
+	Citations         *string   `gorm:"type:jsonb" json:"citations"`    // []CorpusCitation, one per sentence of the answer
+	EmbeddingProvider string    `gorm:"size:50;not null" json:"embedding_provider"`
+	EmbeddingModel    string    `gorm:"size:100;not null" json:"embedding_model"`
+	RetrievalTime     float64   `gorm:"not null" json:"retrieval_time"`  // Seconds spent embedding the question and ranking passages
+	ProcessingTime    float64   `gorm:"not null" json:"processing_time"` // Seconds from question to answer
+	Provider          string    `gorm:"size:50;not null" json:"provider"`
+	AIModel           *string   `gorm:"size:100" json:"ai_model"`
+	PromptTokens      int64     `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens  int64     `gorm:"default:0" json:"completion_tokens"`
+	Cost              float64   `gorm:"default:0" json:"cost"` // USD
+	TokensEstimated   bool      `gorm:"default:false" json:"tokens_estimated"`
+	Extractive        bool      `gorm:"default:false" json:"extractive"`
+	SubmitterID       string    `gorm:"size:255;index" json:"submitter_id"`
+	CreatedAt         time.Time `gorm:"index" json:"created_at"`
+}
+
+// RetrievedPassage - One passage of a retrieval set. The answer cites it by
+// its source number.
+type RetrievedPassage struct {
+	Source     int     `json:"source"` // From 1, in rank order
+	ChunkID    uint    `json:"chunk_id"`
+	PDFFileID  uint    `json:"pdf_file_id"`
+	Filename   string  `json:"filename"`
+	PageNumber int     `json:"page_number"`
+	Score      float64 `json:"score"` // Cosine similarity to the question
+	Text       string  `json:"text"`
+}
+
+// CorpusCitation - One sentence of a corpus answer and the pages it cites
+type CorpusCitation struct {
+	Text      string      `json:"text"`
+	Sources   []CitedPage `json:"sources"`
+	Supported bool        `json:"supported"` // The cited passages contain the sentence's words
+	Score     float64     `json:"score"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// CitedPage - A page of a document, cited through a retrieved passage
+type CitedPage struct {
+	Source     int    `json:"source"`
+	PDFFileID  uint   `json:"pdf_file_id"`
+	Filename   string `json:"filename"`
+	PageNumber int    `json:"page_number"`
+}
+
+type CorpusQuestionResponse struct {
+	ID                uint            `json:"id"`
+	Question          string          `json:"question"`
+	Answer            string          `json:"answer"`
+	Language          *string         `json:"language"`
+	PDFFileIDs        json.RawMessage `json:"pdf_file_ids,omitempty"`
+	TopK              int             `json:"top_k"`
+	Retrieved         json.RawMessage `json:"retrieved,omitempty"`
+	Citations         json.RawMessage `json:"citations,omitempty"`
+	EmbeddingProvider string          `json:"embedding_provider"`
+	EmbeddingModel    string          `json:"embedding_model"`
+	RetrievalTime     float64         `json:"retrieval_time"`
+	ProcessingTime    float64         `json:"processing_time"`
+	Provider          string          `json:"provider"`
+	AIModel           *string         `json:"ai_model"`
+	PromptTokens      int64           `json:"prompt_tokens"`
+	CompletionTokens  int64           `json:"completion_tokens"`
+	Cost              float64         `json:"cost"`
+	TokensEstimated   bool            `json:"tokens_estimated"`
+	Extractive        bool            `json:"extractive"`
+	CreatedAt         time.Time       `json:"created_at"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChunkEmbedding - A passage of one page with its embedding, for questions
+// across all documents. Every PDF is embedded once per embedding model.
+type ChunkEmbedding struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	PDFFileID         uint      `gorm:"not null;index;index:idx_chunk_embedding_model,priority:3" json:"pdf_file_id"`
+	PageNumber        int       `gorm:"not null" json:"page_number"`
+	Position          int       `gorm:"not null;default:0" json:"position"` // Passage of the page, from 0
+	Text              string    `gorm:"type:text;not null" json:"text"`
+	Embedding         Vector    `gorm:"type:real[];not null" json:"-"`
+	EmbeddingProvider string    `gorm:"size:50;not null;index:idx_chunk_embedding_model,priority:1" json:"embedding_provider"`
+	EmbeddingModel    string    `gorm:"size:100;not null;index:idx_chunk_embedding_model,priority:2" json:"embedding_model"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// PDFEmbedding - Whether a PDF is embedded with an embedding model. A failed
+// attempt is retried by the backfill after a growing delay, not on every question.
+type PDFEmbedding struct {
+	PDFFileID         uint       `gorm:"primaryKey" json:"pdf_file_id"`
+	EmbeddingProvider string     `gorm:"primaryKey;size:50" json:"embedding_provider"`
+	EmbeddingModel    string     `gorm:"primaryKey;size:100" json:"embedding_model"`
+	Passages          int        `gorm:"default:0" json:"passages"`
+	EmbeddedAt        *time.Time `json:"embedded_at"`                // nil until an attempt succeeds
+	Failures          int        `gorm:"default:0" json:"failures"`  // Failed attempts since the last success
+	ErrorMsg          *string    `gorm:"type:text" json:"error_msg"` // Last failure
+	RetryAt           *time.Time `gorm:"index" json:"retry_at"`      // No backfill attempt before this
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Vector - An embedding, stored as a Postgres real[]
+type Vector []float32
+
+// Value encodes the vector as an array literal, e.g. {0.1,-0.2}
+func (v Vector) Value() (driver.Value, error) {
+	return "{" + v.join() + "}", nil
+}
+
+// Scan decodes an array literal
+func (v *Vector) Scan(src interface{}) error {
+	var literal string
+	switch value := src.(type) {
+	case string:
+		literal = value
+	case []byte:
+		literal = string(value)
+	case nil:
+		*v = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+
+	literal = strings.Trim(strings.TrimSpace(literal), "{}[]")
+	if literal == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(literal, ",")
+	vector := make(Vector, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		vector[i] = float32(number)
+	}
+	*v = vector
+	return nil
+}
+
+// PGVector renders the vector as a pgvector literal, e.g. [0.1,-0.2]
+func (v Vector) PGVector() string {
+	return "[" + v.join() + "]"
+}
+
+func (v Vector) join() string {
+	parts := make([]string, len(v))
+	for i, value := range v {
+		parts[i] = strconv.FormatFloat(float64(value), 'g', -1, 32)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey - Stored response for a client-supplied Idempotency-Key
+type IdempotencyKey struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ClientID     string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_client_key" json:"client_id"`
+	Key          string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_client_key" json:"key"`
+	Method       string    `gorm:"size:10;not null" json:"method"`
+	Path         string    `gorm:"size:255;not null" json:"path"`
+	Fingerprint  string    `gorm:"size:64;not null" json:"fingerprint"` // SHA-256 of the request payload
+	StatusCode   int       `gorm:"default:0" json:"status_code"`        // 0 while the original request is in flight
+	ResponseBody *string   `gorm:"type:text" json:"response_body"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"` // End of the claim's lease while in flight, of the replay TTL once answered
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -24,19 +25,47 @@ type SummarizationJob struct {
 	Language    string         `gorm:"size:50;not null;default:'english'" json:"language"`
 	Pages       *string        `gorm:"size:100" json:"pages"`
 	Question    *string        `gorm:"type:text" json:"question"`
+	SubmitterID string         `gorm:"size:255;index" json:"submitter_id"` // API key hash or IP, used for fair scheduling
+	ClaimToken  *uint          `gorm:"index" json:"-"`                     // Job ID of the queue message running the job, to resume it after a crash
+	Provider    string         `gorm:"size:50;not null;default:'python'" json:"provider"` // AI backend (python, openai, fake)
+	
+	// Custom prompt: the exact template version this job runs with (nil = built-in prompt)
+	TemplateID      *uint `gorm:"index" json:"template_id"`
+	TemplateVersion *int  `json:"template_version"`
+	
+	// Extract mode: the JSON Schema to fill in
+	ExtractSchema *string `gorm:"type:jsonb" json:"extract_schema"`
+
+	// Length, audience, tone and format asked for (ai.Style as JSON, nil = provider default)
+	Style *string `gorm:"type:jsonb" json:"style"`
+
+	// Translate mode: the summary translated into Language (no PDF is read)
+	SourceSummaryID *uint `gorm:"index" json:"source_summary_id"`
+
+	// Compare mode: the newer version of the document; PDFFileID is the older one
+	ComparePDFFileID *uint `gorm:"index" json:"compare_pdf_file_id"`
 	
 	// Retry mechanism
 	RetryCount  int            `gorm:"default:0" json:"retry_count"`
 	MaxRetries  int            `gorm:"default:3" json:"max_retries"`
 	ErrorMsg    *string        `gorm:"type:text" json:"error_msg"`
+	RetryAt     *time.Time     `json:"retry_at"` // Rate-limited: not picked up again before this
 	
-	// Checkpoint/Resume mechanism for cost optimization
-	LastProcessedPage *int      `gorm:"default:0" json:"last_processed_page"` // Last successfully processed page
-	PartialResult     *string   `gorm:"type:text" json:"partial_result"`      // Partial summary result (JSON)
+	// Checkpoint/Resume mechanism for cost optimization (per-chunk state lives in job_chunks)
+	LastProcessedPage *int      `gorm:"default:0" json:"last_processed_page"` // Last page of the finished prefix of chunks
 	TotalPages        *int      `json:"total_pages"`                          // Total pages to process
 	
+	// AI usage and cost, accumulated per chunk and combine call
+	PromptTokens     int64    `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64    `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64  `gorm:"default:0" json:"cost"`                 // USD
+	BudgetCap        *float64 `json:"budget_cap"`                            // USD, nil = unlimited
+	AIModel          *string  `gorm:"size:100" json:"ai_model"`
+	TokensEstimated  bool     `gorm:"default:false" json:"tokens_estimated"` // Counts derived from characters
+	
 	// Result
 	SummaryLogID *uint         `gorm:"index" json:"summary_log_id"`
+	CacheHit     bool          `gorm:"default:false;index" json:"cache_hit"` // Reused an identical completed summary
 	
 	// Timestamps
 	StartedAt   *time.Time     `json:"started_at"`
@@ -48,6 +77,7 @@ type SummarizationJob struct {
 	// Relations
 	PDFFile     PDFFile        `gorm:"foreignKey:PDFFileID" json:"pdf_file,omitempty"`
 	SummaryLog  *SummaryLog    `gorm:"foreignKey:SummaryLogID" json:"summary_log,omitempty"`
+	Chunks      []JobChunk     `gorm:"foreignKey:JobID" json:"chunks,omitempty"`
 }
 
 type JobResponse struct {
@@ -58,6 +88,13 @@ type JobResponse struct {
 	Language     string     `json:"language"`
 	Pages        *string    `json:"pages"`
 	Question     *string    `json:"question"`
+	Provider     string     `json:"provider"`
+	TemplateID   *uint      `json:"template_id,omitempty"`
+	TemplateVersion *int    `json:"template_version,omitempty"`
+	ExtractSchema json.RawMessage `json:"extract_schema,omitempty"`
+	SourceSummaryID *uint `json:"source_summary_id,omitempty"`
+	Style        json.RawMessage `json:"style,omitempty"`
+	ComparePDFFileID *uint `json:"compare_pdf_file_id,omitempty"`
 	RetryCount   int        `json:"retry_count"`
 	MaxRetries   int        `json:"max_retries"`
 	ErrorMsg     *string    `json:"error_msg"`
@@ -65,9 +102,21 @@ type JobResponse struct {
 	// Checkpoint info
 	LastProcessedPage *int   `json:"last_processed_page,omitempty"`
 	TotalPages        *int   `json:"total_pages,omitempty"`
-	Progress          string `json:"progress,omitempty"` // e.g., "50/100 pages"
+	Progress          string `json:"progress,omitempty"` // e.g., "3/5 chunks"
+	CompletedChunks   int    `json:"completed_chunks,omitempty"`
+	FailedChunks      int    `json:"failed_chunks,omitempty"`
+	TotalChunks       int    `json:"total_chunks,omitempty"`
+	
+	// Usage info
+	PromptTokens     int64    `json:"prompt_tokens"`
+	CompletionTokens int64    `json:"completion_tokens"`
+	Cost             float64  `json:"cost"`
+	BudgetCap        *float64 `json:"budget_cap,omitempty"`
+	AIModel          *string  `json:"ai_model,omitempty"`
+	TokensEstimated  bool     `json:"tokens_estimated"`
 	
 	SummaryLogID *uint      `json:"summary_log_id"`
+	CacheHit     bool       `json:"cache_hit"`
 	StartedAt    *time.Time `json:"started_at"`
 	CompletedAt  *time.Time `json:"completed_at"`
 	CreatedAt    time.Time  `json:"created_at"`
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+type ChunkStatus string
+
+const (
+	ChunkStatusPending    ChunkStatus = "pending"
+	ChunkStatusProcessing ChunkStatus = "processing"
+	ChunkStatusCompleted  ChunkStatus = "completed"
+	ChunkStatusSkipped    ChunkStatus = "skipped" // No extractable text in the page range
+	ChunkStatusFailed     ChunkStatus = "failed"
+)
+
+// JobChunk - One page-range chunk of a summarization job (checkpoint unit)
+type JobChunk struct {
+	ID               uint        `gorm:"primaryKey" json:"id"`
+	JobID            uint        `gorm:"not null;uniqueIndex:idx_job_chunk" json:"job_id"`
+	ChunkIndex       int         `gorm:"not null;uniqueIndex:idx_job_chunk" json:"chunk_index"`
+	Pages            *string     `gorm:"size:100" json:"pages"` // Page range sent to the AI, nil = whole job range
+	PageStart        int         `json:"page_start"`
+	PageEnd          int         `json:"page_end"`
+	Status           ChunkStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	AttemptCount     int         `gorm:"default:0" json:"attempt_count"`
+	Result           *string     `gorm:"type:jsonb" json:"result"` // AI result for this chunk
+	AILatencyMs      int64       `gorm:"default:0" json:"ai_latency_ms"`
+	AIModel          *string     `gorm:"size:100" json:"ai_model"`
+	PromptTokens     int64       `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64       `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64     `gorm:"default:0" json:"cost"` // USD
+	ErrorMsg         *string     `gorm:"type:text" json:"error_msg"`
+	StartedAt        *time.Time  `json:"started_at"`
+	CompletedAt      *time.Time  `json:"completed_at"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// JobStreamChunk - A piece of a job's generated text, relayed to clients over SSE.
+// Offsets are byte positions in the text of one processing attempt, so a
+// reconnecting client can resume anywhere; a retried job starts a new attempt.
+type JobStreamChunk struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	JobID       uint      `gorm:"not null;index:idx_job_stream" json:"job_id"`
+	Attempt     int       `gorm:"not null;index:idx_job_stream" json:"attempt"`
+	StartOffset int       `gorm:"not null" json:"start_offset"`
+	EndOffset   int       `gorm:"not null;index:idx_job_stream" json:"end_offset"`
+	Text        string    `gorm:"type:text;not null" json:"text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -16,6 +16,11 @@ type PDFFile struct {
 	TotalPages       *int           `json:"total_pages"`
 	UploadDate       time.Time      `gorm:"autoCreateTime" json:"upload_date"`
 	
+	// Page text extraction (pdf_pages), run once after upload
+	WordCount        *int           `json:"word_count"`                             // nil until the text is extracted
+	ImageOnlyPages   *string        `gorm:"type:text" json:"image_only_pages"`      // Pages with images but no text, e.g. "3-5, 9"
+	TextExtractedAt  *time.Time     `json:"text_extracted_at"`
+	
 	// Latest Summary Fields (auto-updated by trigger)
 	LatestSummaryID  *uint          `gorm:"index" json:"latest_summary_id"`
 	Mode             *string        `gorm:"size:50" json:"mode"`
@@ -41,6 +46,8 @@ type PDFFileResponse struct {
 	FileSize         int64      `json:"file_size"`
 	FileSizeMB       float64    `json:"file_size_mb"`
 	TotalPages       *int       `json:"total_pages"`
+	WordCount        *int       `json:"word_count"`
+	ImageOnlyPages   *string    `json:"image_only_pages"`
 	UploadDate       time.Time  `json:"upload_date"`
 	UploadedAt       time.Time  `json:"uploaded_at"`
 	
@@ -58,4 +65,5 @@ type PDFFileResponse struct {
 	LastSummarizedAt *time.Time `json:"last_summarized_at"`
 	
 	SummaryCount     int64      `json:"summary_count"`
+	Tags             []DocumentTag `json:"tags"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// PDFPage - The text of one page, extracted once after upload. Jobs send
+// this text to the AI instead of the PDF.
+type PDFPage struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	PDFFileID  uint      `gorm:"not null;uniqueIndex:idx_pdf_page" json:"pdf_file_id"`
+	PageNumber int       `gorm:"not null;uniqueIndex:idx_pdf_page" json:"page_number"`
+	Text       string    `gorm:"type:text;not null" json:"text"`
+	CharCount  int       `gorm:"not null;default:0" json:"char_count"`
+	WordCount  int       `gorm:"not null;default:0" json:"word_count"`
+	HasImages  bool      `gorm:"default:false" json:"has_images"`
+	ImageOnly  bool      `gorm:"default:false" json:"image_only"` // Images but no text: probably a scan that needs OCR
+	Language   string    `gorm:"size:50" json:"language"`         // Detected; picks the full-text search configuration, "" = simple
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PromptTemplate - A custom prompt for one mode, managed through the API.
+// Editing the template text bumps Version; every version is kept in
+// prompt_template_versions so jobs stay reproducible.
+type PromptTemplate struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"size:100;not null;index" json:"name"`
+	Description *string        `gorm:"type:text" json:"description"`
+	Mode        SummaryMode    `gorm:"type:varchar(50);not null;index" json:"mode"`
+	Language    *string        `gorm:"size:50" json:"language"`            // nil = any language
+	Template    string         `gorm:"type:text;not null" json:"template"` // Text with {{document}}, {{language}}, {{question}}
+	Version     int            `gorm:"not null;default:1" json:"version"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// PromptTemplateVersion - Immutable text of one template version
+type PromptTemplateVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TemplateID uint      `gorm:"not null;uniqueIndex:idx_template_version" json:"template_id"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_template_version" json:"version"`
+	Template   string    `gorm:"type:text;not null" json:"template"`
+	CreatedAt  time.Time `json:"created_at"`
+}
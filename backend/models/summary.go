@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,6 +14,10 @@ const (
 	ModeStructured SummaryMode = "structured"
 	ModeMulti      SummaryMode = "multi"
 	ModeQA         SummaryMode = "qa"
+	ModeExtractive SummaryMode = "extractive" // Built-in LexRank, no AI call
+	ModeExtract    SummaryMode = "extract"    // Fills in a user-defined JSON Schema
+	ModeTranslate  SummaryMode = "translate"  // Job mode only: the summary keeps its source's mode
+	ModeCompare    SummaryMode = "compare"    // Differences between two PDFs
 )
 
 // SummaryLog - History of all summarizations
@@ -29,23 +34,55 @@ type SummaryLog struct {
 	QAQuestion       *string        `gorm:"type:text" json:"qa_question"`
 	QAAnswer         *string        `gorm:"type:text" json:"qa_answer"`
 	ProcessingTime   float64        `gorm:"not null" json:"processing_time"`
+	Provider         string         `gorm:"size:50;not null;default:'python'" json:"provider"` // AI backend that produced it
+	AIModel          *string        `gorm:"size:100" json:"ai_model"`
+	PromptTokens     int64          `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64          `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64        `gorm:"default:0" json:"cost"` // USD
+	TokensEstimated  bool           `gorm:"default:false" json:"tokens_estimated"`
+	Extractive       bool           `gorm:"default:false" json:"extractive"` // Sentences selected from the PDF, not generated
+	TemplateID       *uint          `gorm:"index" json:"template_id"`        // Custom prompt used, for A/B comparison
+	TemplateVersion  *int           `json:"template_version"`
+	ExtractSchema    *string        `gorm:"type:jsonb" json:"extract_schema"`
+	ExtractedData    *string        `gorm:"type:jsonb;index:,type:gin" json:"extracted_data"` // Extract mode result, queryable with jsonb operators
+	SourceSummaryID  *uint          `gorm:"index" json:"source_summary_id"`                   // Set on translations of another summary
+	Style            *string        `gorm:"type:jsonb" json:"style"`                          // Length, audience, tone and format it was written for
+	ComparePDFFileID *uint          `gorm:"index" json:"compare_pdf_file_id"`                 // Compare mode: the newer version; PDFFileID is the older one
+	Comparison       *string        `gorm:"type:jsonb" json:"comparison"`                     // Compare mode: added, removed and changed obligations
+	Citations        *string        `gorm:"type:jsonb" json:"citations"`                      // Structured and qa modes: pages cited by each statement (citation.Report)
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type SummaryLogResponse struct {
-	ID               uint        `json:"id"`
-	PDFFileID        uint        `json:"pdf_file_id"`
-	Mode             SummaryMode `json:"mode"`
-	Language         string      `json:"language"`
-	PagesProcessed   *string     `json:"pages_processed"`
-	SummaryText      *string     `json:"summary_text"`
-	ExecutiveSummary *string     `json:"executive_summary"`
-	Bullets          *string     `json:"bullets"`
-	Highlights       *string     `json:"highlights"`
-	QAQuestion       *string     `json:"qa_question"`
-	QAAnswer         *string     `json:"qa_answer"`
-	ProcessingTime   float64     `json:"processing_time"`
-	CreatedAt        time.Time   `json:"created_at"`
+	ID               uint            `json:"id"`
+	PDFFileID        uint            `json:"pdf_file_id"`
+	Mode             SummaryMode     `json:"mode"`
+	Language         string          `json:"language"`
+	PagesProcessed   *string         `json:"pages_processed"`
+	SummaryText      *string         `json:"summary_text"`
+	ExecutiveSummary *string         `json:"executive_summary"`
+	Bullets          *string         `json:"bullets"`
+	Highlights       *string         `json:"highlights"`
+	QAQuestion       *string         `json:"qa_question"`
+	QAAnswer         *string         `json:"qa_answer"`
+	ProcessingTime   float64         `json:"processing_time"`
+	Provider         string          `json:"provider"`
+	AIModel          *string         `json:"ai_model"`
+	PromptTokens     int64           `json:"prompt_tokens"`
+	CompletionTokens int64           `json:"completion_tokens"`
+	Cost             float64         `json:"cost"`
+	TokensEstimated  bool            `json:"tokens_estimated"`
+	Extractive       bool            `json:"extractive"`
+	TemplateID       *uint           `json:"template_id,omitempty"`
+	TemplateVersion  *int            `json:"template_version,omitempty"`
+	ExtractSchema    json.RawMessage `json:"extract_schema,omitempty"`
+	ExtractedData    json.RawMessage `json:"extracted_data,omitempty"`
+	SourceSummaryID  *uint           `json:"source_summary_id,omitempty"`
+	Style            json.RawMessage `json:"style,omitempty"`
+	ComparePDFFileID *uint           `json:"compare_pdf_file_id,omitempty"`
+	Comparison       json.RawMessage `json:"comparison,omitempty"`
+	Citations        json.RawMessage `json:"citations,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag sources
+const (
+	TagSourceAuto   = "auto"   // Extracted after summarization
+	TagSourceManual = "manual" // Added or edited through the API
+)
+
+// DocumentTag - A person, organization, date, topic or keyword of a PDF.
+// Deleted tags are kept soft-deleted so extraction does not add them again.
+type DocumentTag struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	PDFFileID uint           `gorm:"not null;index" json:"pdf_file_id"`
+	Kind      string         `gorm:"size:20;not null;index" json:"kind"` // person, organization, date, topic or keyword
+	Name      string         `gorm:"size:255;not null" json:"name"`
+	Slug      string         `gorm:"size:255;not null;index" json:"slug"` // Lowercase name, matched by ?tag=
+	Source    string         `gorm:"size:20;not null" json:"source"`
+	Extractor *string        `gorm:"size:50" json:"extractor"` // builtin or the provider that extracted it, nil = manual
+	Score     float64        `gorm:"default:0" json:"score"`   // Prominence in the document, 0-1
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TaggingRun - The AI usage of one tagging call to a provider, for the cost
+// reports. The built-in extractor costs nothing and is not recorded.
+type TaggingRun struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	PDFFileID        uint      `gorm:"not null;index" json:"pdf_file_id"`
+	Provider         string    `gorm:"size:50;not null" json:"provider"`
+	AIModel          *string   `gorm:"size:100" json:"ai_model"`
+	PromptTokens     int64     `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64     `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64   `gorm:"default:0" json:"cost"` // USD
+	TokensEstimated  bool      `gorm:"default:false" json:"tokens_estimated"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QAThread - A conversation about one PDF. Each question is answered with
+// the earlier turns of the thread as context.
+type QAThread struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	PDFFileID   uint           `gorm:"not null;index" json:"pdf_file_id"`
+	Title       *string        `gorm:"size:255" json:"title"`
+	Language    *string        `gorm:"size:50" json:"language"` // nil = answer in the document's language
+	Pages       *string        `gorm:"size:100" json:"pages"`   // Page range the answers are drawn from, nil = all pages
+	Provider    string         `gorm:"size:50;not null" json:"provider"`
+	SubmitterID string         `gorm:"size:255;index" json:"submitter_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"` // Bumped by every message
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// QAMessage - One question of a thread and its answer
+type QAMessage struct {
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	ThreadID         uint           `gorm:"not null;index" json:"thread_id"`
+	Question         string         `gorm:"type:text;not null" json:"question"`
+	Answer           string         `gorm:"type:text;not null" json:"answer"`
+	Language         string         `gorm:"size:50" json:"language"`         // Language of the answer, for full-text search
+	Citations        *string        `gorm:"type:jsonb" json:"citations"`     // Pages cited by each sentence of the answer (citation.Report)
+	ProcessingTime   float64        `gorm:"not null" json:"processing_time"` // Seconds from question to answer
+	Provider         string         `gorm:"size:50;not null" json:"provider"`
+	AIModel          *string        `gorm:"size:100" json:"ai_model"`
+	PromptTokens     int64          `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int64          `gorm:"default:0" json:"completion_tokens"`
+	Cost             float64        `gorm:"default:0" json:"cost"` // USD
+	TokensEstimated  bool           `gorm:"default:false" json:"tokens_estimated"`
+	Extractive       bool           `gorm:"default:false" json:"extractive"`
+	CreatedAt        time.Time      `json:"created_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type QAThreadResponse struct {
+	ID           uint                `json:"id"`
+	PDFFileID    uint                `json:"pdf_file_id"`
+	PDFFilename  string              `json:"pdf_filename,omitempty"`
+	Title        *string             `json:"title"`
+	Language     *string             `json:"language"`
+	Pages        *string             `json:"pages"`
+	Provider     string              `json:"provider"`
+	MessageCount int64               `json:"message_count"`
+	Messages     []QAMessageResponse `json:"messages,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+type QAMessageResponse struct {
+	ID               uint            `json:"id"`
+	ThreadID         uint            `json:"thread_id"`
+	Question         string          `json:"question"`
+	Answer           string          `json:"answer"`
+	Language         string          `json:"language"`
+	Citations        json.RawMessage `json:"citations,omitempty"`
+	ProcessingTime   float64         `json:"processing_time"`
+	Provider         string          `json:"provider"`
+	AIModel          *string         `json:"ai_model"`
+	PromptTokens     int64           `json:"prompt_tokens"`
+	CompletionTokens int64           `json:"completion_tokens"`
+	Cost             float64         `json:"cost"`
+	TokensEstimated  bool            `json:"tokens_estimated"`
+	Extractive       bool            `json:"extractive"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
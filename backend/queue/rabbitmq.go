@@ -28,7 +28,12 @@ const (
 
 // JobMessage represents a job message in the queue
 type JobMessage struct {
-	JobID uint `json:"job_id"`
+	JobID       uint   `json:"job_id"`
+	SubmitterID string `json:"submitter_id,omitempty"` // Submitter of JobID; the worker picks fairly among all pending jobs
+	Provider    string `json:"provider,omitempty"`     // AI provider, so workers can wait out its circuit breaker
+
+	// Set instead of JobID for a collection summary
+	CollectionSummaryID uint `json:"collection_summary_id,omitempty"`
 }
 
 // Connect establishes connection to RabbitMQ with retry logic
@@ -200,17 +205,46 @@ func setupAuditQueue() error {
 }
 
 // PublishJob publishes a new job to the queue
-func PublishJob(jobID uint) error {
+func PublishJob(jobID uint, submitterID, provider string) error {
 	message := JobMessage{
-		JobID: jobID,
+		JobID:       jobID,
+		SubmitterID: submitterID,
+		Provider:    provider,
+	}
+
+	if err := publish(message); err != nil {
+		return err
 	}
 
+	log.Printf("Published job %d to queue", jobID)
+	return nil
+}
+
+// PublishCollectionSummary publishes a collection summary to the job queue,
+// where it shares the workers and fair scheduling of summarization jobs
+func PublishCollectionSummary(summaryID uint, submitterID, provider string) error {
+	message := JobMessage{
+		CollectionSummaryID: summaryID,
+		SubmitterID:         submitterID,
+		Provider:            provider,
+	}
+
+	if err := publish(message); err != nil {
+		return err
+	}
+
+	log.Printf("Published collection summary %d to queue", summaryID)
+	return nil
+}
+
+// publish sends a job message to the jobs exchange
+func publish(message JobMessage) error {
 	body, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 
-	err = Channel.Publish(
+	return Channel.Publish(
 		ExchangeName, // exchange
 		RoutingKey,   // routing key
 		false,        // mandatory
@@ -221,13 +255,6 @@ func PublishJob(jobID uint) error {
 			Body:         body,
 		},
 	)
-
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Published job %d to queue", jobID)
-	return nil
 }
 
 // PublishAudit publishes audit log to queue
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -123,7 +124,7 @@ func DownloadFile(objectName string) (io.ReadCloser, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("failed to download from MinIO after %d attempts: %v", maxRetries, lastErr)
+	return nil, fmt.Errorf("failed to download from MinIO after %d attempts: %w", maxRetries, lastErr)
 }
 
 // DeleteFile deletes a file from MinIO with retry mechanism
@@ -168,3 +169,9 @@ func GetPresignedURL(objectName string, expiry time.Duration) (string, error) {
 
 	return presignedURL.String(), nil
 }
+
+// IsNotFound reports whether err means the object does not exist
+func IsNotFound(err error) bool {
+	var resp minio.ErrorResponse
+	return errors.As(err, &resp) && resp.Code == "NoSuchKey"
+}
@@ -0,0 +1,393 @@
+// Package tagging extracts the keywords, topics and named entities (people,
+// organizations and dates) of a document without a language model.
+package tagging
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"pdf-summarizer-backend/extractive"
+)
+
+// Tag kinds
+const (
+	KindPerson       = "person"
+	KindOrganization = "organization"
+	KindDate         = "date"    // YYYY-MM-DD
+	KindTopic        = "topic"   // Recurring phrase of two words
+	KindKeyword      = "keyword" // Recurring word
+)
+
+// Kinds lists the tag kinds
+var Kinds = []string{KindPerson, KindOrganization, KindDate, KindTopic, KindKeyword}
+
+// maxTags - Most tags of each kind kept for one document
+var maxTags = map[string]int{
+	KindPerson:       10,
+	KindOrganization: 10,
+	KindDate:         10,
+	KindTopic:        8,
+	KindKeyword:      12,
+}
+
+// minCount - Occurrences a topic or keyword needs; entities need one
+const minCount = 2
+
+// Tag - One extracted tag
+type Tag struct {
+	Kind  string  `json:"kind"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"` // Occurrences relative to the most frequent tag of its kind, 0-1
+}
+
+var (
+	// titles precede the name of a person
+	titles = toSet("mr", "mrs", "ms", "dr", "prof", "sir", "madam", "bapak", "ibu", "pak")
+
+	// abbreviations end with a full stop that does not end the sentence
+	abbreviations = toSet("mr", "mrs", "ms", "dr", "prof", "st", "inc", "co", "corp", "ltd", "no", "jr", "sr")
+
+	// orgSuffixes end, and orgPrefixes start, the name of an organization
+	orgSuffixes = toSet("inc", "ltd", "llc", "llp", "corp", "corporation", "company", "co", "gmbh", "ag", "plc", "tbk",
+		"group", "holdings", "bank", "university", "institute", "ministry", "department", "agency", "association",
+		"foundation", "council", "commission", "authority", "committee", "court", "organization", "organisation")
+	orgPrefixes = toSet("pt", "cv", "bank", "university", "universitas", "ministry", "kementerian", "department")
+
+	// connectors may join the capitalized words of a name, e.g. "Bank of America"
+	// ("and" is not one: it more often joins two names)
+	connectors = toSet("of", "de", "van", "von", "der", "bin", "binti", "for")
+
+	// shortWords - Function words of one or two letters, which extractive's stopwords leave out
+	shortWords = toSet("a", "an", "as", "at", "by", "if", "in", "is", "it", "on", "or", "so", "to", "we", "up")
+
+	// extraStopwords - Frequent in documents, too generic to be keywords
+	extraStopwords = toSet("shall", "must", "within", "under", "upon", "between", "including", "page", "pages",
+		"section", "following", "herein", "thereof", "hereby", "per", "may", "yang", "tidak", "akan")
+)
+
+// months maps English and Indonesian month names and abbreviations to their number
+var months = func() map[string]time.Month {
+	names := map[time.Month][]string{
+		time.January: {"january", "jan", "januari"}, time.February: {"february", "feb", "februari"},
+		time.March: {"march", "mar", "maret"}, time.April: {"april", "apr"},
+		time.May: {"may", "mei"}, time.June: {"june", "jun", "juni"},
+		time.July: {"july", "jul", "juli"}, time.August: {"august", "aug", "agustus", "agu"},
+		time.September: {"september", "sep", "sept"}, time.October: {"october", "oct", "oktober", "okt"},
+		time.November: {"november", "nov"}, time.December: {"december", "dec", "desember", "des"},
+	}
+	result := make(map[string]time.Month)
+	for month, list := range names {
+		for _, name := range list {
+			result[name] = month
+		}
+	}
+	return result
+}()
+
+var (
+	isoDate       = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	dayMonthYear  = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\s+([a-z]{3,9})\.?,?\s+(\d{4})\b`)
+	monthDayYear  = regexp.MustCompile(`(?i)\b([a-z]{3,9})\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+	trailingPunct = ".,;:!?)]}\"'”’"
+)
+
+// Extract returns the tags of text, most frequent first within each kind
+func Extract(text string) []Tag {
+	counts := map[string]map[string]int{}
+	add := func(kind, name string) {
+		if counts[kind] == nil {
+			counts[kind] = map[string]int{}
+		}
+		counts[kind][name]++
+	}
+
+	for _, date := range dates(text) {
+		add(KindDate, date)
+	}
+
+	lowercase := lowercaseWords(text)
+	entityWords := map[string]bool{}
+	for _, entity := range entities(text, lowercase) {
+		add(entity.Kind, entity.Name)
+		for _, word := range strings.Fields(strings.ToLower(entity.Name)) {
+			entityWords[word] = true
+		}
+	}
+
+	for _, sentence := range extractive.Sentences(text) {
+		var previous string
+		for _, word := range words(sentence) {
+			if !isKeyword(word) || entityWords[word] {
+				previous = ""
+				continue
+			}
+			add(KindKeyword, word)
+			if previous != "" {
+				add(KindTopic, previous+" "+word)
+			}
+			previous = word
+		}
+	}
+
+	var tags []Tag
+	for _, kind := range Kinds {
+		tags = append(tags, top(kind, counts[kind])...)
+	}
+	return tags
+}
+
+// top returns the most frequent names of a kind as tags
+func top(kind string, counts map[string]int) []Tag {
+	threshold := 1
+	if kind == KindTopic || kind == KindKeyword {
+		threshold = minCount
+	}
+
+	var names []string
+	maxCount := 0
+	for name, count := range counts {
+		if count >= threshold {
+			names = append(names, name)
+			maxCount = max(maxCount, count)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > maxTags[kind] {
+		names = names[:maxTags[kind]]
+	}
+
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{Kind: kind, Name: name, Score: float64(counts[name]) / float64(maxCount)}
+	}
+	return tags
+}
+
+// dates finds the dates of text written as 2025-01-31, 31 January 2025 or
+// January 31, 2025 (English or Indonesian month names), as YYYY-MM-DD
+func dates(text string) []string {
+	var result []string
+	addDate := func(year, month, day string) {
+		if date, ok := parseDate(year, month, day); ok {
+			result = append(result, date)
+		}
+	}
+	for _, match := range isoDate.FindAllStringSubmatch(text, -1) {
+		addDate(match[1], match[2], match[3])
+	}
+	for _, match := range dayMonthYear.FindAllStringSubmatch(text, -1) {
+		addDate(match[3], match[2], match[1])
+	}
+	for _, match := range monthDayYear.FindAllStringSubmatch(text, -1) {
+		addDate(match[3], match[1], match[2])
+	}
+	return result
+}
+
+// parseDate validates a date whose month is a number or a month name
+func parseDate(year, month, day string) (string, bool) {
+	m, ok := months[strings.ToLower(month)]
+	if !ok {
+		number, err := strconv.Atoi(month)
+		if err != nil || number < 1 || number > 12 {
+			return "", false
+		}
+		m = time.Month(number)
+	}
+	y, _ := strconv.Atoi(year)
+	d, _ := strconv.Atoi(day)
+
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if date.Day() != d || date.Month() != m || y < 1900 || y > 2200 {
+		return "", false
+	}
+	return date.Format("2006-01-02"), true
+}
+
+// entities finds runs of capitalized words and classifies them as people or
+// organizations
+func entities(text string, lowercase map[string]bool) []Tag {
+	var result []Tag
+	tokens := strings.Fields(text)
+	for i := 0; i < len(tokens); i++ {
+		if !isCapitalized(cleanToken(tokens[i])) {
+			continue
+		}
+
+		run := []string{cleanToken(tokens[i])}
+		for !endsRun(tokens[i]) && !endsOrganization(run) && i+1 < len(tokens) {
+			next := cleanToken(tokens[i+1])
+			if isCapitalized(next) {
+				run = append(run, next)
+				i++
+				continue
+			}
+			// A connector joins two capitalized words, e.g. "Bank of America"
+			if connectors[strings.ToLower(next)] && !endsRun(tokens[i+1]) && i+2 < len(tokens) && isCapitalized(cleanToken(tokens[i+2])) {
+				run = append(run, next, cleanToken(tokens[i+2]))
+				i += 2
+				continue
+			}
+			break
+		}
+
+		if tag := classify(run, lowercase); tag != nil {
+			result = append(result, *tag)
+		}
+	}
+	return result
+}
+
+// classify decides whether a run of capitalized words is a person or an
+// organization, or neither. Without a title, company suffix or prefix, a run
+// counts as a person's name only when it has two or three words, none of
+// which the text also uses in lowercase; otherwise it is more likely a heading.
+func classify(run []string, lowercase map[string]bool) *Tag {
+	titled := false
+	for len(run) > 0 {
+		first := strings.ToLower(run[0])
+		if titles[first] {
+			titled = true
+		} else if !extractive.IsStopword(first) && !shortWords[first] && !connectors[first] {
+			break
+		}
+		// A title, or a capitalized function word opening a sentence, is not part of the name
+		run = run[1:]
+	}
+	for len(run) > 0 && connectors[strings.ToLower(run[len(run)-1])] {
+		run = run[:len(run)-1]
+	}
+	if len(run) == 0 {
+		return nil
+	}
+
+	name := strings.Join(run, " ")
+	first := strings.ToLower(run[0])
+	last := strings.ToLower(run[len(run)-1])
+	switch {
+	case len(run) > 1 && (orgSuffixes[last] || orgPrefixes[first]):
+		return &Tag{Kind: KindOrganization, Name: name}
+	case titled && len(run) <= 4:
+		return &Tag{Kind: KindPerson, Name: name}
+	case len(run) < 2 || len(run) > 3:
+		return nil
+	}
+
+	for _, word := range run {
+		lower := strings.ToLower(word)
+		if _, month := months[lower]; month || lowercase[lower] || connectors[lower] || !isName(word) {
+			return nil
+		}
+	}
+	return &Tag{Kind: KindPerson, Name: name}
+}
+
+// endsOrganization reports whether a run already is a complete organization
+// name, e.g. "Acme Corp"; "Bank" alone may continue as "Bank of America"
+func endsOrganization(run []string) bool {
+	return len(run) > 1 && orgSuffixes[strings.ToLower(run[len(run)-1])]
+}
+
+// cleanToken strips the punctuation around a word
+func cleanToken(token string) string {
+	return strings.Trim(token, trailingPunct+"(\"'“‘[")
+}
+
+// lowercaseWords returns the words text uses in lowercase
+func lowercaseWords(text string) map[string]bool {
+	result := map[string]bool{}
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if strings.ToLower(word) == word {
+			result[word] = true
+		}
+	}
+	return result
+}
+
+// words splits a sentence into lowercase words, dropping punctuation
+func words(sentence string) []string {
+	return strings.FieldsFunc(strings.ToLower(sentence), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+}
+
+// isKeyword reports whether a lowercase word may be a keyword
+func isKeyword(word string) bool {
+	word = strings.Trim(word, "-")
+	if len([]rune(word)) < 4 || extractive.IsStopword(word) || extraStopwords[word] {
+		return false
+	}
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCapitalized reports whether word starts with an uppercase letter and has
+// a lowercase one, or is an abbreviation such as "Inc." or "PT"
+func isCapitalized(word string) bool {
+	runes := []rune(word)
+	if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+		return false
+	}
+	if orgPrefixes[strings.ToLower(word)] || orgSuffixes[strings.ToLower(strings.TrimRight(word, "."))] {
+		return true
+	}
+	for _, r := range runes[1:] {
+		if unicode.IsLower(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isName reports whether word looks like part of a personal name: letters,
+// hyphens and apostrophes only
+func isName(word string) bool {
+	for _, r := range word {
+		if !unicode.IsLetter(r) && r != '-' && r != '\'' && r != '’' {
+			return false
+		}
+	}
+	return len([]rune(word)) > 1
+}
+
+// endsRun reports whether punctuation after token ends a name
+func endsRun(token string) bool {
+	trimmed := strings.TrimRight(token, "\"'”’)]")
+	if trimmed == "" {
+		return true
+	}
+	if strings.HasSuffix(trimmed, ".") && abbreviations[strings.ToLower(strings.Trim(trimmed, ".(\"'“‘["))] {
+		return false
+	}
+	return strings.ContainsAny(trimmed[len(trimmed)-1:], ".,;:!?")
+}
+
+// endsSentence reports whether token ends a sentence
+func endsSentence(token string) bool {
+	trimmed := strings.TrimRight(token, "\"'”’)]")
+	if trimmed == "" || !strings.ContainsAny(trimmed[len(trimmed)-1:], ".!?") {
+		return false
+	}
+	return !abbreviations[strings.ToLower(strings.Trim(trimmed, ".(\"'“‘["))]
+}
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,99 @@
+package tagging
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDates(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "No dates in here, only 2025 and 31.", nil},
+		{"iso", "Signed on 2025-01-31.", []string{"2025-01-31"}},
+		{"day month year", "Signed on 31st January 2025 and 1 Feb. 2024.", []string{"2025-01-31", "2024-02-01"}},
+		{"month day year", "Signed on January 31, 2025.", []string{"2025-01-31"}},
+		{"indonesian", "Ditandatangani 17 Agustus 2025.", []string{"2025-08-17"}},
+		{"invalid day", "Due on 31 February 2025 or 2025-02-30.", nil},
+		{"invalid month", "Due on 2025-13-01 or 3 Smarch 2025.", nil},
+		{"year out of range", "Due on 1 January 1850.", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dates(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dates(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntities(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Tag
+	}{
+		{"person", "The lease was signed by John Smith yesterday.", []Tag{{Kind: KindPerson, Name: "John Smith"}}},
+		{"titled person", "Payment goes to Dr. Jane Doe.", []Tag{{Kind: KindPerson, Name: "Jane Doe"}}},
+		{"organization suffix", "The landlord is Acme Holdings Ltd. in this lease.", []Tag{{Kind: KindOrganization, Name: "Acme Holdings"}}},
+		{"organization prefix", "Rent is paid to PT Maju Jaya every month.", []Tag{{Kind: KindOrganization, Name: "PT Maju Jaya"}}},
+		{"connector", "Funds are held at Bank of America for the tenant.", []Tag{{Kind: KindOrganization, Name: "Bank of America"}}},
+		{"sentence start dropped", "The Jane Doe estate pays.", []Tag{{Kind: KindPerson, Name: "Jane Doe"}}},
+		{"word also used in lowercase", "Rent Payment is due. The payment is late.", nil},
+		{"month is not a name", "Rent is due in March Smith.", nil},
+		{"long heading", "Terms And Conditions Of Rental Agreement", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := entities(tt.text, lowercaseWords(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entities(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   string
+		counts map[string]int
+		want   []Tag
+	}{
+		{"empty", KindKeyword, nil, []Tag{}},
+		{"keywords need two occurrences", KindKeyword, map[string]int{"rent": 4, "tenant": 2, "roof": 1},
+			[]Tag{{KindKeyword, "rent", 1}, {KindKeyword, "tenant", 0.5}}},
+		{"entities need one", KindPerson, map[string]int{"Jane Doe": 1}, []Tag{{KindPerson, "Jane Doe", 1}}},
+		{"ties by name", KindOrganization, map[string]int{"Beta Ltd": 2, "Acme Ltd": 2}, []Tag{{KindOrganization, "Acme Ltd", 1}, {KindOrganization, "Beta Ltd", 1}}},
+		{"capped", KindTopic, map[string]int{"a b": 9, "c d": 8, "e f": 7, "g h": 6, "i j": 5, "k l": 4, "m n": 3, "o p": 2, "q r": 2},
+			[]Tag{{KindTopic, "a b", 1}, {KindTopic, "c d", 8.0 / 9}, {KindTopic, "e f", 7.0 / 9}, {KindTopic, "g h", 6.0 / 9},
+				{KindTopic, "i j", 5.0 / 9}, {KindTopic, "k l", 4.0 / 9}, {KindTopic, "m n", 3.0 / 9}, {KindTopic, "o p", 2.0 / 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := top(tt.kind, tt.counts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("top(%s) = %+v, want %+v", tt.kind, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	text := "John Smith rents the apartment from Acme Holdings Ltd. on 1 March 2025. " +
+		"The monthly rent for the apartment is 100 euros. " +
+		"John Smith pays the monthly rent before the fifth day."
+
+	want := []Tag{
+		{KindPerson, "John Smith", 1},
+		{KindOrganization, "Acme Holdings", 1},
+		{KindDate, "2025-03-01", 1},
+		{KindTopic, "monthly rent", 1},
+		{KindKeyword, "apartment", 1},
+		{KindKeyword, "monthly", 1},
+		{KindKeyword, "rent", 1},
+	}
+	if got := Extract(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() = %+v, want %+v", got, want)
+	}
+}
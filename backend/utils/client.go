@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"pdf-summarizer-backend/config"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientID identifies the caller by API key when it is one of API_KEYS,
+// otherwise by IP. Unknown keys are ignored: a caller could otherwise send a
+// new key with every request to get a fresh rate limit bucket.
+func ClientID(c *fiber.Ctx) string {
+	apiKey := c.Get("X-API-Key")
+	if apiKey == "" {
+		apiKey = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	}
+	if apiKey != "" {
+		// Never store raw keys, only a stable hash
+		sum := sha256.Sum256([]byte(apiKey))
+		hash := hex.EncodeToString(sum[:])
+		if config.AppConfig.APIKeyHashes[hash] {
+			return "key:" + hash[:16]
+		}
+	}
+	return "ip:" + c.IP()
+}
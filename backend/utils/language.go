@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageHits is how many function words text needs before its language is trusted
+const minLanguageHits = 3
+
+// languageWords - Frequent function words of the supported document languages
+var languageWords = map[string][]string{
+	"english":    {"the", "and", "of", "to", "in", "is", "that", "for", "with", "as", "on", "are", "this", "be", "by", "from", "or", "which", "will", "shall"},
+	"indonesian": {"yang", "dan", "di", "ke", "dari", "untuk", "dengan", "ini", "itu", "dalam", "pada", "adalah", "tidak", "akan", "atau", "oleh", "sebagai", "juga", "dapat", "bahwa"},
+	"spanish":    {"el", "la", "de", "que", "y", "en", "los", "las", "del", "se", "por", "con", "una", "para", "es", "al", "lo", "como", "más", "pero"},
+	"french":     {"le", "la", "les", "de", "des", "et", "est", "que", "une", "un", "du", "dans", "pour", "pas", "sur", "qui", "au", "avec", "ce", "sont"},
+	"german":     {"der", "die", "das", "und", "ist", "nicht", "mit", "den", "von", "zu", "ein", "eine", "auf", "für", "dem", "sich", "des", "im", "auch", "wird"},
+}
+
+// languageSets is languageWords as sets, built once
+var languageSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(languageWords))
+	for language, words := range languageWords {
+		sets[language] = toWordSet(words)
+	}
+	return sets
+}()
+
+// DetectLanguage guesses the language of text from its function words and
+// returns its lowercase name, or "" when the text gives too little to go on
+func DetectLanguage(text string) string {
+	hits := make(map[string]int, len(languageSets))
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for language, set := range languageSets {
+			if set[word] {
+				hits[language]++
+			}
+		}
+	}
+
+	best, bestHits := "", 0
+	for language, count := range hits {
+		// Ties go to the alphabetically first language, so the result is stable
+		if count > bestHits || (count == bestHits && language < best) {
+			best, bestHits = language, count
+		}
+	}
+	if bestHits < minLanguageHits {
+		return ""
+	}
+	return best
+}
+
+func toWordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsePageRange parses a page range like "1-5, 7, 9" into sorted 1-based page numbers.
+// An empty range selects every page. Mirrors parse_page_range in the AI service.
+func ParsePageRange(pageRange string, totalPages int) []int {
+	if strings.TrimSpace(pageRange) == "" {
+		pages := make([]int, totalPages)
+		for i := range pages {
+			pages[i] = i + 1
+		}
+		return pages
+	}
+
+	selected := make(map[int]bool)
+	for _, part := range strings.Split(pageRange, ",") {
+		part = strings.TrimSpace(part)
+		if bounds := strings.SplitN(part, "-", 2); len(bounds) == 2 {
+			start, err1 := strconv.Atoi(strings.TrimSpace(bounds[0]))
+			end, err2 := strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			start = clampPage(start, totalPages)
+			end = clampPage(end, totalPages)
+			for p := start; p <= end; p++ {
+				selected[p] = true
+			}
+		} else if page, err := strconv.Atoi(part); err == nil && page >= 1 && page <= totalPages {
+			selected[page] = true
+		}
+	}
+
+	pages := make([]int, 0, len(selected))
+	for p := range selected {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+// FormatPageRange compacts sorted page numbers into a range like "1-5,7,9"
+func FormatPageRange(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(pages[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+func clampPage(page, totalPages int) int {
+	if page < 1 {
+		return 1
+	}
+	if page > totalPages {
+		return totalPages
+	}
+	return page
+}
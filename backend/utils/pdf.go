@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// CountPDFPages returns the number of pages in a PDF document
+func CountPDFPages(data []byte) (total int, err error) {
+	// The PDF reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("corrupted PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid file format: %v", err)
+	}
+
+	return reader.NumPage(), nil
+}
+
+// ExtractPDFPages returns the plain text of every page, "" for pages without text
+func ExtractPDFPages(data []byte) ([]string, error) {
+	contents, err := ReadPDFPages(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]string, len(contents))
+	for i, content := range contents {
+		pages[i] = content.Text
+	}
+	return pages, nil
+}
+
+// PDFPageContent - The plain text of one page and whether it draws images
+type PDFPageContent struct {
+	Text      string
+	HasImages bool
+}
+
+// ReadPDFPages returns the content of every page. A page with images but no
+// text is most likely a scan.
+func ReadPDFPages(data []byte) (pages []PDFPageContent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("corrupted PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid file format: %v", err)
+	}
+
+	pages = make([]PDFPageContent, reader.NumPage())
+	for i := range pages {
+		page := reader.Page(i + 1)
+		if page.V.IsNull() {
+			continue
+		}
+		if pageText, err := page.GetPlainText(nil); err == nil {
+			pages[i].Text = strings.TrimSpace(pageText)
+		}
+		pages[i].HasImages = hasImages(page.Resources(), 0)
+	}
+	return pages, nil
+}
+
+// hasImages reports whether resources hold an image, looking into form
+// XObjects a few levels deep
+func hasImages(resources pdf.Value, depth int) bool {
+	xobjects := resources.Key("XObject")
+	for _, name := range xobjects.Keys() {
+		object := xobjects.Key(name)
+		switch object.Key("Subtype").Name() {
+		case "Image":
+			return true
+		case "Form":
+			if depth < 3 && hasImages(object.Key("Resources"), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
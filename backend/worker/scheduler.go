@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"context"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
+	"pdf-summarizer-backend/database"
+	"pdf-summarizer-backend/models"
+	"time"
+)
+
+const (
+	// fairShareWindow is how far back finished jobs count toward a submitter's share
+	fairShareWindow = time.Hour
+
+	// delayedPollInterval is how often a message looks again for a job to run
+	// while the only pending jobs wait out a rate limit
+	delayedPollInterval = 5 * time.Second
+)
+
+// Job messages are tickets rather than assignments: each pending job was
+// published with one, and whichever ticket a worker receives, it runs the
+// job picked here from every pending job in the database. A client that
+// queued thousands of jobs ahead of everyone else therefore gets no more
+// than its share, however far back in the queue the other jobs are.
+
+// candidate - The oldest pending job of a submitter
+type candidate struct {
+	ID          uint
+	SubmitterID string
+	Provider    string
+	Mode        models.SummaryMode
+	CreatedAt   time.Time
+}
+
+// usage - What a submitter has running and has recently run
+type usage struct {
+	SubmitterID string
+	Processing  int64
+	Recent      int64
+}
+
+// claimJob marks the next job to run as processing and returns its ID, or 0
+// when nothing is pending. Jobs delayed by a rate limit are not picked before
+// their retry_at. token is the job ID the message was published
+// for; a redelivered message first resumes the job it was running when its
+// worker died.
+func claimJob(token uint, redelivered bool) (uint, error) {
+	if redelivered {
+		var resumed models.SummarizationJob
+		err := database.DB.Select("id").
+			Where("status = ? AND (claim_token = ? OR (id = ? AND claim_token IS NULL))", models.JobStatusProcessing, token, token).
+			Limit(1).Find(&resumed).Error
+		if err != nil {
+			return 0, err
+		}
+		if resumed.ID != 0 {
+			return resumed.ID, nil
+		}
+	}
+
+	for {
+		next, err := pickJob()
+		if err != nil {
+			return 0, err
+		}
+		if next == nil {
+			// Keep the message while rate-limited jobs wait, so they still have one
+			var delayed int64
+			err := database.DB.Model(&models.SummarizationJob{}).
+				Where("status = ? AND retry_at > ?", models.JobStatusPending, time.Now()).
+				Count(&delayed).Error
+			if err != nil || delayed == 0 {
+				return 0, err
+			}
+			time.Sleep(delayedPollInterval)
+			continue
+		}
+
+		// Hold the job while its AI provider's circuit is open instead of failing it,
+		// unless open circuits fall back to the extractive summarizer (never for extract mode)
+		if !config.AppConfig.ExtractiveFallback || next.Mode == models.ModeExtract {
+			ai.WaitAvailable(context.Background(), next.Provider)
+		}
+
+		// Another worker may have claimed it meanwhile; pick again
+		now := time.Now()
+		result := database.DB.Model(&models.SummarizationJob{}).
+			Where("id = ? AND status = ?", next.ID, models.JobStatusPending).
+			Updates(map[string]interface{}{"status": models.JobStatusProcessing, "started_at": now, "claim_token": token})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return next.ID, nil
+		}
+	}
+}
+
+// pickJob chooses among the oldest pending job of each submitter: the
+// submitter with the fewest jobs processing relative to its weight goes
+// first, then the one that ran the fewest jobs in the last hour, then the
+// one waiting longest
+func pickJob() (*candidate, error) {
+	var candidates []candidate
+	err := database.DB.Raw(`SELECT DISTINCT ON (submitter_id) id, submitter_id, provider, mode, created_at
+		FROM summarization_jobs
+		WHERE status = ? AND deleted_at IS NULL AND (retry_at IS NULL OR retry_at <= ?)
+		ORDER BY submitter_id, created_at, id`, models.JobStatusPending, time.Now()).
+		Scan(&candidates).Error
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	since := time.Now().Add(-fairShareWindow)
+	var usages []usage
+	err = database.DB.Raw(`SELECT submitter_id,
+			COUNT(*) FILTER (WHERE status = ?) AS processing,
+			COUNT(*) FILTER (WHERE completed_at > ?) AS recent
+		FROM summarization_jobs
+		WHERE deleted_at IS NULL AND (status = ? OR completed_at > ?)
+		GROUP BY submitter_id`, models.JobStatusProcessing, since, models.JobStatusProcessing, since).
+		Scan(&usages).Error
+	if err != nil {
+		return nil, err
+	}
+	bySubmitter := make(map[string]usage, len(usages))
+	for _, u := range usages {
+		bySubmitter[u.SubmitterID] = u
+	}
+
+	best := 0
+	for i := 1; i < len(candidates); i++ {
+		if before(candidates[i], candidates[best], bySubmitter) {
+			best = i
+		}
+	}
+	return &candidates[best], nil
+}
+
+// before reports whether a's submitter is further below its share than b's
+func before(a, b candidate, usages map[string]usage) bool {
+	ua, ub := usages[a.SubmitterID], usages[b.SubmitterID]
+	wa, wb := weight(a.SubmitterID), weight(b.SubmitterID)
+
+	if pa, pb := float64(ua.Processing)/wa, float64(ub.Processing)/wb; pa != pb {
+		return pa < pb
+	}
+	if ra, rb := float64(ua.Recent)/wa, float64(ub.Recent)/wb; ra != rb {
+		return ra < rb
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// weight returns a submitter's fair-share weight (default 1)
+func weight(submitter string) float64 {
+	if w, ok := config.AppConfig.SubmitterWeights[submitter]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
@@ -1,11 +1,15 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"pdf-summarizer-backend/ai"
+	"pdf-summarizer-backend/config"
 	"pdf-summarizer-backend/handlers"
 	"pdf-summarizer-backend/queue"
 	"strings"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -14,6 +18,11 @@ import (
 func StartWorker() {
 	log.Println("Starting RabbitMQ job consumer...")
 
+	// One message per worker: which job runs is picked from the database, not the queue order
+	if err := queue.Channel.Qos(config.AppConfig.WorkerConcurrency, 0, false); err != nil {
+		log.Fatal("Failed to set consumer prefetch:", err)
+	}
+
 	// Get messages from queue
 	msgs, err := queue.Channel.Consume(
 		queue.QueueName, // queue
@@ -31,13 +40,16 @@ func StartWorker() {
 	// Process messages
 	forever := make(chan bool)
 
-	go func() {
-		for msg := range msgs {
-			processMessage(msg)
-		}
-	}()
+	// Worker pool
+	for i := 0; i < config.AppConfig.WorkerConcurrency; i++ {
+		go func() {
+			for msg := range msgs {
+				processMessage(msg)
+			}
+		}()
+	}
 
-	log.Println("Worker started. Waiting for jobs...")
+	log.Printf("Worker started with %d workers. Waiting for jobs...", config.AppConfig.WorkerConcurrency)
 	<-forever
 }
 
@@ -51,53 +63,61 @@ func processMessage(msg amqp.Delivery) {
 		return
 	}
 
-	log.Printf("Processing job %d (attempt %d)", jobMsg.JobID, msg.Headers["x-delivery-count"])
+	if jobMsg.CollectionSummaryID != 0 {
+		// Hold the summary while its AI provider's circuit is open instead of failing it,
+		// unless open circuits fall back to the extractive summarizer
+		if !config.AppConfig.ExtractiveFallback {
+			ai.WaitAvailable(context.Background(), jobMsg.Provider)
+		}
+
+		log.Printf("Processing collection summary %d (attempt %d)", jobMsg.CollectionSummaryID, msg.Headers["x-delivery-count"])
+		err = handlers.ProcessCollectionSummary(jobMsg.CollectionSummaryID)
+
+		// A rate-limited provider said when to come back; hold the message until then
+		if aiErr, ok := ai.AsError(err); ok && aiErr.RetryAfter > 0 && !ai.IsPermanent(err) {
+			time.Sleep(aiErr.RetryAfter)
+		}
+		settle(msg, "Collection summary", jobMsg.CollectionSummaryID, err)
+		return
+	}
+
+	// The message is a ticket: run the job that is fairly next, not necessarily its own
+	jobID, err := claimJob(jobMsg.JobID, msg.Redelivered)
+	if err != nil {
+		log.Printf("❌ Failed to claim a job: %v", err)
+		msg.Nack(false, true)
+		return
+	}
+	if jobID == 0 {
+		log.Printf("No pending job left for message of job %d", jobMsg.JobID)
+		msg.Ack(false)
+		return
+	}
+
+	log.Printf("Processing job %d (message of job %d, attempt %d)", jobID, jobMsg.JobID, msg.Headers["x-delivery-count"])
 
 	// Process the job with checkpoint/resume capability
-	err = handlers.ProcessJobWithCheckpoint(jobMsg.JobID)
-	
+	err = handlers.ProcessJobWithCheckpoint(jobID)
+	settle(msg, "Job", jobID, err)
+}
+
+// settle acknowledges a processed message, or rejects it: to the DLQ on a
+// permanent error, back to the queue for a retry otherwise
+func settle(msg amqp.Delivery, kind string, id uint, err error) {
 	if err != nil {
-		log.Printf("Job %d failed: %v", jobMsg.JobID, err)
-		
-		// Check if error is permanent (don't requeue)
-		errMsg := err.Error()
-		isPermanent := false
+		log.Printf("%s %d failed: %v", kind, id, err)
 		
-		permanentErrors := []string{
-			"specified key does not exist",
-			"file not found",
-			"invalid file format",
-			"file too large",
-			"could not extract text",
-			"corrupted",
-			"encrypted",
-		}
-		
-		for _, permErr := range permanentErrors {
-			if contains(errMsg, permErr) {
-				isPermanent = true
-				log.Printf("Permanent error - not requeuing job %d", jobMsg.JobID)
-				break
-			}
-		}
-		
-		if isPermanent {
+		if ai.IsPermanent(err) {
 			// Don't requeue permanent errors - send to DLQ
+			log.Printf("Permanent error - not requeuing %s %d", strings.ToLower(kind), id)
 			msg.Nack(false, false)
 		} else {
 			// Requeue for retry
 			msg.Nack(false, true)
 		}
 	} else {
-		log.Printf("Job %d completed successfully", jobMsg.JobID)
+		log.Printf("%s %d completed successfully", kind, id)
 		// Acknowledge successful processing
 		msg.Ack(false)
 	}
 }
-
-// Helper function to check if string contains substring (case-insensitive)
-func contains(s, substr string) bool {
-	s = strings.ToLower(s)
-	substr = strings.ToLower(substr)
-	return strings.Contains(s, substr)
-}